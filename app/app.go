@@ -2,11 +2,17 @@
 package Dingo
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/luohao-brian/SimplePosts/app/handler"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/utils"
 	"github.com/dinever/golf"
 )
 
@@ -27,10 +33,86 @@ func Init(privKey, pubKey string) {
 	fmt.Printf("Database is used at ")
 }
 
-// Run starts our HTTP server on the given port.
+// Backup writes a backup archive of the whole site into the given directory,
+// which defaults to "backup".
+func Backup(dir string) {
+	if dir == "" {
+		dir = "backup"
+	}
+	file, err := model.Backup(dir, "upload")
+	utils.FailOnError(err, "Unable to back up the site.", true)
+	utils.Output("The site is backed up at " + file)
+}
+
+// Restore restores the given backup archive into an empty database.
+func Restore(file string) {
+	if file == "" {
+		utils.FailOnError(fmt.Errorf("no backup file given"), "Usage: SimplePosts restore <file>", true)
+	}
+	err := model.RestoreBackup(file, "upload")
+	utils.FailOnError(err, "Unable to restore the backup.", true)
+	utils.Output("The site is restored from " + file)
+}
+
+// Export writes every post and page as a markdown file with front matter into
+// the given directory, along with a JSON document of the whole site.
+func Export(dir string) {
+	if dir == "" {
+		dir = "export"
+	}
+	err := model.ExportToDir(dir)
+	utils.FailOnError(err, "Unable to export the site.", true)
+	utils.Output("The site is exported to " + dir)
+}
+
+// Rerender renders the markdown of every post again with the configured
+// pipeline.
+func Rerender() {
+	handler.RegisterThemeShortcodes(model.GetSettingValue("theme"))
+	n, err := model.RerenderPosts()
+	utils.FailOnError(err, "Unable to render the posts.", true)
+	utils.Output(fmt.Sprintf("%d posts rendered again.", n))
+}
+
+// Build renders the site as static files into the given directory.
+func Build(dir string, full bool) {
+	if dir == "" {
+		dir = "public"
+	}
+	app := golf.New()
+	app = handler.Initialize(app)
+	report, err := handler.Build(app, dir, full)
+	utils.FailOnError(err, "Unable to build the site.", true)
+	for _, e := range report.Errors {
+		utils.Output("[Error]: " + e)
+	}
+	utils.Output(fmt.Sprintf("The site is built in %s: %d files rendered, %d unchanged, %d removed", dir, report.Rendered, report.Unchanged, report.Removed))
+}
+
+// Run starts our HTTP server on the given port, along with the workers of the
+// background jobs. On SIGINT or SIGTERM, the server stops taking requests and
+// the running jobs are given some time to finish before it exits.
 func Run(portNumber string) {
 	app := golf.New()
 	app = handler.Initialize(app)
+	workers, _ := app.Config.GetInt("app.job_workers", 2)
+	utils.FailOnError(model.StartJobWorkers(workers), "Unable to start the job workers.", true)
+	server := &http.Server{Addr: ":" + portNumber, Handler: app}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-stop
+		fmt.Println("Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+		close(stopped)
+	}()
 	fmt.Printf("Application Started on port %s\n", portNumber)
-	app.Run(":" + portNumber)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		utils.FailOnError(err, "Unable to start the server.", true)
+	}
+	<-stopped
+	model.StopJobWorkers(30 * time.Second)
 }
@@ -0,0 +1,288 @@
+// Package feed renders syndication feeds in the RSS 2.0, Atom 1.0 and JSON
+// Feed 1.1 formats. A Feed is built once from the posts to syndicate, and can
+// then be rendered in any of the formats.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// The formats a feed can be rendered in.
+const (
+	RSS  = "rss"
+	Atom = "atom"
+	JSON = "json"
+)
+
+// ContentTypes maps every format to the content type it is served with.
+var ContentTypes = map[string]string{
+	RSS:  "application/rss+xml; charset=utf-8",
+	Atom: "application/atom+xml; charset=utf-8",
+	JSON: "application/feed+json; charset=utf-8",
+}
+
+// A Feed is a list of items, along with the site it belongs to. All the links
+// must be absolute URLs.
+type Feed struct {
+	Title       string
+	Link        string
+	FeedLink    string
+	Description string
+	Language    string
+	Updated     time.Time
+	Items       []*Item
+}
+
+// An Item is a single entry of a feed. Content is the full HTML of the entry
+// and Summary a shorter HTML version, either of which may be empty.
+type Item struct {
+	Id        string
+	Title     string
+	Link      string
+	Author    string
+	AuthorUrl string
+	Summary   string
+	Content   string
+	Image     string
+	Tags      []string
+	Published time.Time
+	Updated   time.Time
+}
+
+// Render renders the feed in the given format.
+func (f *Feed) Render(format string) ([]byte, error) {
+	switch format {
+	case RSS:
+		return f.RSS()
+	case Atom:
+		return f.Atom()
+	case JSON:
+		return f.JSON()
+	}
+	return nil, fmt.Errorf("Unknown feed format %q", format)
+}
+
+type rssFeed struct {
+	XMLName      xml.Name `xml:"rss"`
+	Version      string   `xml:"version,attr"`
+	XmlnsAtom    string   `xml:"xmlns:atom,attr"`
+	XmlnsContent string   `xml:"xmlns:content,attr"`
+	XmlnsDc      string   `xml:"xmlns:dc,attr"`
+	Channel      struct {
+		Title         string     `xml:"title"`
+		Link          string     `xml:"link"`
+		Description   string     `xml:"description"`
+		Language      string     `xml:"language,omitempty"`
+		LastBuildDate string     `xml:"lastBuildDate"`
+		Self          atomLink   `xml:"atom:link"`
+		Items         []*rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	Description string   `xml:"description,omitempty"`
+	Content     *cdata   `xml:"content:encoded,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// RSS renders the feed as RSS 2.0. The summary is used as the description,
+// and the full content, if any, is added with the content module.
+func (f *Feed) RSS() ([]byte, error) {
+	r := &rssFeed{
+		Version:      "2.0",
+		XmlnsAtom:    "http://www.w3.org/2005/Atom",
+		XmlnsContent: "http://purl.org/rss/1.0/modules/content/",
+		XmlnsDc:      "http://purl.org/dc/elements/1.1/",
+	}
+	r.Channel.Title = f.Title
+	r.Channel.Link = f.Link
+	r.Channel.Description = f.Description
+	r.Channel.Language = f.Language
+	r.Channel.LastBuildDate = f.Updated.Format(time.RFC1123Z)
+	r.Channel.Self = atomLink{Href: f.FeedLink, Rel: "self", Type: ContentTypes[RSS]}
+	for _, item := range f.Items {
+		ri := &rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Guid:        rssGuid{IsPermaLink: item.Id == item.Link, Value: item.Id},
+			Description: item.Summary,
+			Creator:     item.Author,
+			Categories:  item.Tags,
+			PubDate:     item.Published.Format(time.RFC1123Z),
+		}
+		if item.Content != "" {
+			ri.Content = &cdata{item.Content}
+		}
+		r.Channel.Items = append(r.Channel.Items, ri)
+	}
+	return marshalXML(r)
+}
+
+type atomFeed struct {
+	XMLName  xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string       `xml:"xml:lang,attr,omitempty"`
+	Id       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle,omitempty"`
+	Updated  string       `xml:"updated"`
+	Links    []atomLink   `xml:"link"`
+	Entries  []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom renders the feed as Atom 1.0.
+func (f *Feed) Atom() ([]byte, error) {
+	a := &atomFeed{
+		Lang:     f.Language,
+		Id:       f.FeedLink,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  f.Updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+			{Href: f.FeedLink, Rel: "self", Type: ContentTypes[Atom]},
+		},
+	}
+	for _, item := range f.Items {
+		e := &atomEntry{
+			Id:        item.Id,
+			Title:     item.Title,
+			Link:      atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Updated.Format(time.RFC3339),
+		}
+		if item.Author != "" {
+			e.Author = &atomAuthor{Name: item.Author, Uri: item.AuthorUrl}
+		}
+		for _, t := range item.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: t})
+		}
+		if item.Summary != "" {
+			e.Summary = &atomText{Type: "html", Value: item.Summary}
+		}
+		if item.Content != "" {
+			e.Content = &atomText{Type: "html", Value: item.Content}
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return marshalXML(a)
+}
+
+type jsonFeed struct {
+	Version     string      `json:"version"`
+	Title       string      `json:"title"`
+	HomePageUrl string      `json:"home_page_url"`
+	FeedUrl     string      `json:"feed_url"`
+	Description string      `json:"description,omitempty"`
+	Language    string      `json:"language,omitempty"`
+	Items       []*jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	Id            string        `json:"id"`
+	Url           string        `json:"url"`
+	Title         string        `json:"title"`
+	ContentHtml   string        `json:"content_html,omitempty"`
+	Summary       string        `json:"summary,omitempty"`
+	Image         string        `json:"image,omitempty"`
+	DatePublished string        `json:"date_published"`
+	DateModified  string        `json:"date_modified"`
+	Authors       []*jsonAuthor `json:"authors,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+	Url  string `json:"url,omitempty"`
+}
+
+// JSON renders the feed as JSON Feed 1.1. As JSON Feed requires every item
+// to have content, the summary is used as the content when there is none.
+func (f *Feed) JSON() ([]byte, error) {
+	j := &jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageUrl: f.Link,
+		FeedUrl:     f.FeedLink,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       make([]*jsonItem, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		ji := &jsonItem{
+			Id:            item.Id,
+			Url:           item.Link,
+			Title:         item.Title,
+			ContentHtml:   item.Content,
+			Summary:       item.Summary,
+			Image:         item.Image,
+			DatePublished: item.Published.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+			Tags:          item.Tags,
+		}
+		if ji.ContentHtml == "" {
+			ji.ContentHtml = item.Summary
+		}
+		if item.Author != "" {
+			ji.Authors = []*jsonAuthor{{Name: item.Author, Url: item.AuthorUrl}}
+		}
+		j.Items = append(j.Items, ji)
+	}
+	return json.MarshalIndent(j, "", "  ")
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/translit"
 	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
@@ -24,30 +27,68 @@ func AdminHandler(ctx *golf.Context) {
 func ProfileHandler(ctx *golf.Context) {
 	userObj, _ := ctx.Session.Get("user")
 	u := userObj.(*model.User)
+	tokens := new(model.APITokens)
+	if err := tokens.GetAPITokensByUserId(u.Id); err != nil {
+		ctx.Abort(500)
+		return
+	}
 	ctx.Loader("admin").Render("profile.html", map[string]interface{}{
-		"Title": "用户详情",
-		"User":  u,
+		"Title":  "用户详情",
+		"User":   u,
+		"Tokens": tokens,
+		"Scopes": model.APITokenScopes,
 	})
 }
 
+// ProfileChangeHandler updates the profile of the current user. The avatar
+// and the cover image may be uploaded along with the form, and are stored in
+// the media library.
 func ProfileChangeHandler(ctx *golf.Context) {
 	userObj, _ := ctx.Session.Get("user")
 	u := userObj.(*model.User)
+	maxSize, _ := ctx.App.Config.GetInt("app.upload_size", 1024*1024*10)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Response, ctx.Request.Body, 2*int64(maxSize)+4096)
 	if u.Email != ctx.Request.FormValue("email") && u.UserEmailExist() {
 		ctx.JSON(map[string]interface{}{"status": "error", "msg": "A user with that email address already exists."})
 		return
 	}
 	u.Name = ctx.Request.FormValue("name")
-	u.Slug = ctx.Request.FormValue("slug")
+	if slug := ctx.Request.FormValue("slug"); slug == "" {
+		u.Slug = model.GenerateSlugFor(u.Name, "users", u.Id)
+	} else if slug != u.Slug {
+		u.Slug = model.GenerateSlugFor(slug, "users", u.Id)
+	}
 	u.Email = ctx.Request.FormValue("email")
 	u.Website = ctx.Request.FormValue("url")
 	u.Bio = ctx.Request.FormValue("bio")
-	err := u.Update()
+	u.Location = ctx.Request.FormValue("location")
+	avatar, err := saveProfileImage(ctx, "image", u.Id)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{"status": "error", "msg": err.Error()})
+		return
+	}
+	if avatar != nil {
+		u.Image = avatar.VariantUrl("thumbnail")
+	} else if ctx.Request.FormValue("remove_image") == "on" {
+		u.Image = ""
+	}
+	cover, err := saveProfileImage(ctx, "cover", u.Id)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{"status": "error", "msg": err.Error()})
+		return
+	}
+	if cover != nil {
+		u.Cover = cover.VariantUrl("large")
+	} else if ctx.Request.FormValue("remove_cover") == "on" {
+		u.Cover = ""
+	}
+	err = u.Update()
 	if err != nil {
 		ctx.JSON(map[string]interface{}{
 			"status": "error",
 			"msg":    err.Error(),
 		})
+		return
 	}
 	ctx.JSON(map[string]interface{}{"status": "success"})
 }
@@ -268,6 +309,16 @@ func SettingUpdateHandler(ctx *golf.Context) {
 	var err error
 	ctx.Request.ParseForm()
 	for key, value := range ctx.Request.Form {
+		if key == "permalink" {
+			if err = model.SetPermalink(model.Permalink(value[0])); err != nil {
+				ctx.JSON(map[string]interface{}{
+					"status": "error",
+					"msg":    err.Error(),
+				})
+				return
+			}
+			continue
+		}
 		s := model.NewSetting(key, value[0], "")
 		s.CreatedBy = u.Id
 		if err = s.Save(); err != nil {
@@ -355,3 +406,80 @@ func AdminPasswordChange(ctx *golf.Context) {
 		"status": "success",
 	})
 }
+
+// SlugPreviewHandler returns the slug that would be generated for the given
+// title, so the editor can show it before the post is saved. "type" is
+// "posts" (the default), "tags" or "users", and "id" is the ID of the post or
+// user being edited, which may keep its own slug.
+func SlugPreviewHandler(ctx *golf.Context) {
+	table := ctx.Request.FormValue("type")
+	switch table {
+	case "":
+		table = "posts"
+	case "posts", "tags", "users":
+	default:
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    "Unknown slug type: " + table,
+		})
+		return
+	}
+	id, _ := strconv.ParseInt(ctx.Request.FormValue("id"), 10, 64)
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"slug":   model.GenerateSlugFor(ctx.Request.FormValue("title"), table, id),
+	})
+}
+
+// PermalinkViewHandler shows the form used to choose the permalink of posts.
+func PermalinkViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	ctx.Loader("admin").Render("permalink.html", map[string]interface{}{
+		"Title":           "固定链接",
+		"User":            user,
+		"Permalink":       model.GetPermalink(),
+		"Transliteration": model.GetSettingValue("slug_transliteration"),
+		"Transliterators": translit.Names(),
+		"Presets": []string{
+			model.DefaultPermalink,
+			"/:year/:month/:slug/",
+			"/:year/:month/:day/:slug/",
+			"/posts/:id/",
+			"/:category/:slug/",
+		},
+	})
+}
+
+// SlugTransliterationSaveHandler changes how the titles written in other
+// scripts are transliterated into slugs.
+func SlugTransliterationSaveHandler(ctx *golf.Context) {
+	if err := model.SetSlugTransliteration(ctx.Request.FormValue("transliteration")); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// PermalinkSaveHandler changes the permalink of posts. The URLs following the
+// previous permalink are redirected to the new ones.
+func PermalinkSaveHandler(ctx *golf.Context) {
+	pl := ctx.Request.FormValue("permalink")
+	if pl == "custom" {
+		pl = strings.TrimSpace(ctx.Request.FormValue("custom"))
+	}
+	if err := model.SetPermalink(model.Permalink(pl)); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
@@ -46,8 +46,9 @@ func APIDocumentationHandler(routes map[string]map[string]interface{}) golf.Hand
 	}
 }
 
-// handleErr sends the staus code and error message formatted as JSON.
+// handleErr sends the status code and error message formatted as JSON.
 func handleErr(ctx *golf.Context, statusCode int, err error) {
+	ctx.SendStatus(statusCode)
 	ctx.JSONIndent(map[string]interface{}{
 		"statusCode": statusCode,
 		"error":      err.Error(),
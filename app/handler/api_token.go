@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// APITokenCreateHandler creates a personal API token for the current user,
+// with the "scope"s checked in the form, expiring at the end of the day
+// "expires_at" if it is given. The token is sent back once, and can't be
+// found again.
+func APITokenCreateHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	if err := ctx.Request.ParseForm(); err != nil {
+		ctx.JSON(map[string]interface{}{"status": "error", "msg": err.Error()})
+		return
+	}
+	var expiresAt *time.Time
+	if s := strings.TrimSpace(ctx.Request.FormValue("expires_at")); s != "" {
+		day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			ctx.JSON(map[string]interface{}{"status": "error", "msg": "Invalid expiry date: " + s})
+			return
+		}
+		day = day.AddDate(0, 0, 1)
+		expiresAt = &day
+	}
+	t, value, err := model.NewAPIToken(u.Id, ctx.Request.FormValue("name"), ctx.Request.Form["scope"], expiresAt)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{"status": "error", "msg": err.Error()})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"token":  value,
+		"scopes": t.ScopeList(),
+	})
+}
+
+// APITokenRemoveHandler revokes a personal API token of the current user.
+func APITokenRemoveHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	if err := model.DeleteAPIToken(int64(id), u.Id); err != nil {
+		ctx.JSON(map[string]interface{}{"status": "error", "msg": err.Error()})
+		return
+	}
+	ctx.JSON(map[string]interface{}{"status": "success"})
+}
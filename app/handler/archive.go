@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// The segments of the date archive URLs, such as "/2017/03/05/". The month and
+// day are always two digits, so every archive has a single URL.
+var (
+	rxArchiveYear  = regexp.MustCompile(`^[0-9]{4}$`)
+	rxArchiveMonth = regexp.MustCompile(`^[0-9]{2}$`)
+)
+
+// ArchiveIndexHandler lists every published post, grouped by month.
+func ArchiveIndexHandler(ctx *golf.Context) {
+	posts := new(model.Posts)
+	if err := posts.GetAllPostList(false, true, "published_at DESC"); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	archives := make([]*model.Archive, 0)
+	var current *model.Archive
+	for _, p := range *posts {
+		if p.PublishedAt == nil {
+			continue
+		}
+		t := p.PublishedAt.UTC()
+		if current == nil || current.Year != t.Year() || current.Month != t.Month() {
+			current = &model.Archive{Year: t.Year(), Month: t.Month()}
+			archives = append(archives, current)
+		}
+		current.Posts = append(current.Posts, p)
+		current.Count++
+	}
+	ctx.Loader("theme").Render("archives.html", map[string]interface{}{
+		"Title":     "Archive",
+		"Archives":  archives,
+		"Canonical": "/archive/",
+	})
+}
+
+// ArchiveHandler lists the published posts of a year, a month or a day. The
+// year shares the first segment of the path with the post slugs, so it is
+// read from the "slug" parameter, and ContentHandler hands the year archives
+// over to this handler.
+func ArchiveHandler(ctx *golf.Context) {
+	archive := archiveFromContext(ctx)
+	if archive == nil {
+		ctx.Abort(404)
+		return
+	}
+	p := ctx.Param("page")
+
+	var page int
+	if p == "" {
+		page = 1
+	} else {
+		page, _ = strconv.Atoi(p)
+	}
+	posts := new(model.Posts)
+	pager, err := posts.GetPostsByDate(archive, int64(page), homePageSize)
+	if err != nil || pager.Total == 0 {
+		ctx.Abort(404)
+		return
+	}
+	canonical := archive.Url() + "/"
+	if page > 1 {
+		canonical = fmt.Sprintf("%spage/%d/", canonical, page)
+	}
+	ctx.Loader("theme").Render("archive.html", map[string]interface{}{
+		"Title":     archive.Title(),
+		"Archive":   archive,
+		"Posts":     posts,
+		"Pager":     pager,
+		"Canonical": canonical,
+	})
+}
+
+// archiveFromContext returns the archive of the date in the URL, or nil if
+// the URL isn't a valid date.
+func archiveFromContext(ctx *golf.Context) *model.Archive {
+	y, m, d := ctx.Param("slug"), ctx.Param("month"), ctx.Param("day")
+	if !rxArchiveYear.MatchString(y) ||
+		(m != "" && !rxArchiveMonth.MatchString(m)) ||
+		(d != "" && !rxArchiveMonth.MatchString(d)) {
+		return nil
+	}
+	year, _ := strconv.Atoi(y)
+	month, _ := strconv.Atoi(m)
+	day, _ := strconv.Atoi(d)
+	if (m != "" && month == 0) || (d != "" && day == 0) {
+		return nil
+	}
+	archive, err := model.NewArchive(year, time.Month(month), day)
+	if err != nil {
+		return nil
+	}
+	return archive
+}
@@ -113,6 +113,7 @@ func AuthSignUpHandler(ctx *golf.Context) {
 	}
 	ctx.SetCookie("token-user", strconv.Itoa(int(t.UserId)), exp)
 	ctx.SetCookie("token-value", t.Value, exp)
+	model.Emit(model.UserLoggedIn{User: user, Ip: ctx.ClientIP(), Via: "admin"})
 	ctx.JSON(map[string]interface{}{
 		"status": "success",
 	})
@@ -149,6 +150,7 @@ func AuthLoginHandler(ctx *golf.Context) {
 	}
 	ctx.SetCookie("token-user", strconv.Itoa(int(t.UserId)), exp)
 	ctx.SetCookie("token-value", t.Value, exp)
+	model.Emit(model.UserLoggedIn{User: user, Ip: ctx.ClientIP(), Via: "admin"})
 	ctx.JSON(map[string]interface{}{"status": "success"})
 }
 
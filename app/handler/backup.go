@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// BackupViewHandler lists the existing backups, along with the backup
+// schedule.
+func BackupViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	backupDir, _ := ctx.App.Config.GetString("app/backup_dir", "backup")
+	ctx.Loader("admin").Render("backup.html", map[string]interface{}{
+		"Title":    "备份",
+		"User":     user,
+		"Backups":  model.GetBackupFiles(backupDir),
+		"Interval": model.GetSettingValue("backup_interval"),
+	})
+}
+
+// BackupCreateHandler queues a backup of the site, whose job the page waits
+// for.
+func BackupCreateHandler(ctx *golf.Context) {
+	backupDir, _ := ctx.App.Config.GetString("app/backup_dir", "backup")
+	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
+	job, err := model.EnqueueBackup(backupDir, uploadDir)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"job":    job.Id,
+	})
+}
+
+// BackupDownloadHandler sends a backup archive to the browser.
+func BackupDownloadHandler(ctx *golf.Context) {
+	name := ctx.Param("file")
+	if name != path.Base(name) || !strings.HasSuffix(name, ".zip") {
+		ctx.Abort(403)
+		return
+	}
+	backupDir, _ := ctx.App.Config.GetString("app/backup_dir", "backup")
+	file := filepath.Join(backupDir, name)
+	ctx.SetHeader("Content-Type", "application/zip")
+	ctx.SetHeader("Content-Disposition", "attachment; filename="+name)
+	http.ServeFile(ctx.Response, ctx.Request, file)
+}
+
+// BackupScheduleHandler changes how often the site is backed up.
+func BackupScheduleHandler(ctx *golf.Context) {
+	interval, err := strconv.Atoi(ctx.Request.FormValue("interval"))
+	if err != nil || interval < 0 {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    "The interval should be a number of hours.",
+		})
+		return
+	}
+	model.NewSetting("backup_interval", strconv.Itoa(interval), "backup").Save()
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// buildStateFile keeps track of what a static build rendered, so the next
+// build only renders what changed. It is stored in the output directory.
+const buildStateFile = ".build.json"
+
+// A BuildReport describes the outcome of a static build.
+type BuildReport struct {
+	Rendered  int
+	Unchanged int
+	Removed   int
+	Errors    []string
+}
+
+// buildState is the fingerprint of everything the last build rendered.
+// Layout covers the theme and the settings, which show up on every page,
+// List covers the published posts, tags and authors, which show up on the
+// index, tag, author and feed pages, and Posts holds the version of every
+// post page by its path.
+type buildState struct {
+	Layout string            `json:"layout"`
+	List   string            `json:"list"`
+	Posts  map[string]string `json:"posts"`
+}
+
+type builder struct {
+	app    *golf.Application
+	out    string
+	report *BuildReport
+}
+
+// Build renders the site into the out directory, so that it can be served by
+// any static file server. Pages are rendered by the same handlers, theme and
+// template functions as the live site. Unless full is set, only the pages
+// whose content changed since the last build are rendered again: a post page
+// when the post changes, and the index, tag and feed pages when any post or
+// tag does. Widgets on a post page that list other posts are therefore only
+// refreshed by a full build, or by a change to the theme or settings.
+func Build(app *golf.Application, out string, full bool) (*BuildReport, error) {
+	b := &builder{app: app, out: out, report: &BuildReport{Errors: make([]string, 0)}}
+	if err := os.MkdirAll(out, os.ModePerm); err != nil {
+		return nil, err
+	}
+	old := &buildState{Posts: make(map[string]string)}
+	if data, err := ioutil.ReadFile(filepath.Join(out, buildStateFile)); err == nil && !full {
+		json.Unmarshal(data, old)
+	}
+
+	theme := model.GetSettingValue("theme")
+	posts := new(model.Posts)
+	if err := posts.GetAllPostList(false, true, "published_at DESC"); err != nil {
+		return nil, err
+	}
+	pages := new(model.Posts)
+	if err := pages.GetAllPostList(true, true, "published_at DESC"); err != nil {
+		return nil, err
+	}
+	tags := new(model.Tags)
+	if err := tags.GetAllTags(); err != nil {
+		return nil, err
+	}
+	state := &buildState{
+		Layout: layoutFingerprint(theme),
+		Posts:  make(map[string]string),
+	}
+	authors := make([]*model.User, 0)
+	seen := make(map[int64]bool)
+	for _, p := range append(*posts, *pages...) {
+		state.Posts[strings.Trim(p.Url(), "/")] = postVersion(p)
+		if !p.IsPage && !seen[p.CreatedBy] {
+			seen[p.CreatedBy] = true
+			if u := (&model.User{Id: p.CreatedBy}); u.GetUserById() == nil {
+				authors = append(authors, u)
+			}
+		}
+	}
+	state.List = listFingerprint(state.Posts, *tags, authors)
+	all := old.Layout != state.Layout
+
+	for key := range old.Posts {
+		if _, ok := state.Posts[key]; !ok {
+			dir := filepath.Join(out, filepath.FromSlash(key))
+			if os.Remove(filepath.Join(dir, "index.html")) == nil {
+				os.Remove(dir)
+				b.report.Removed++
+			}
+		}
+	}
+
+	if all || old.List != state.List {
+		// Paginated pages are rendered from scratch, as there may now be
+		// fewer of them.
+		os.RemoveAll(filepath.Join(out, "page"))
+		os.RemoveAll(filepath.Join(out, "tag"))
+		os.RemoveAll(filepath.Join(out, "author"))
+		os.RemoveAll(filepath.Join(out, "sitemaps"))
+		pager, err := new(model.Posts).GetPostList(1, homePageSize, false, true, "published_at DESC")
+		if err != nil {
+			return nil, err
+		}
+		b.render("/", "", http.StatusOK)
+		for i := int64(2); i <= pager.Pages; i++ {
+			b.render(fmt.Sprintf("/page/%d/", i), "", http.StatusOK)
+		}
+		b.render("/tags/", "", http.StatusOK)
+		for _, t := range *tags {
+			pager, err := new(model.Posts).GetPostsByTag(t.Id, 1, tagPageSize, true)
+			if err != nil || pager.Total == 0 {
+				continue
+			}
+			b.render(t.Url()+"/", "", http.StatusOK)
+			for i := int64(2); i <= pager.Pages; i++ {
+				b.render(fmt.Sprintf("%s/page/%d/", t.Url(), i), "", http.StatusOK)
+			}
+		}
+		archives, err := model.GetArchives()
+		if err != nil {
+			return nil, err
+		}
+		clearArchives(out, state.Posts)
+		b.render("/archive/", "", http.StatusOK)
+		years := make(map[int]bool)
+		for _, a := range archives {
+			if !years[a.Year] {
+				years[a.Year] = true
+				b.renderArchive(&model.Archive{Year: a.Year}, state.Posts)
+			}
+			b.renderArchive(a, state.Posts)
+		}
+		for _, u := range authors {
+			pager, err := new(model.Posts).GetPostsByAuthor(u.Id, 1, authorPageSize, true)
+			if err != nil {
+				continue
+			}
+			b.render(u.Url()+"/", "", http.StatusOK)
+			for i := int64(2); i <= pager.Pages; i++ {
+				b.render(fmt.Sprintf("%s/page/%d/", u.Url(), i), "", http.StatusOK)
+			}
+		}
+		b.render("/feed/", "rss.xml", http.StatusOK)
+		b.render("/feed/atom/", "atom.xml", http.StatusOK)
+		b.render("/feed/json/", "feed.json", http.StatusOK)
+		b.render("/sitemap.xml", "sitemap.xml", http.StatusOK)
+		sitemaps, err := buildSitemaps()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sitemaps {
+			b.render("/sitemaps/"+s.Name+".xml", "sitemaps/"+s.Name+".xml", http.StatusOK)
+		}
+	}
+	// The posts are rendered last, so that they win over any list page which
+	// has the same path.
+	for _, p := range append(*posts, *pages...) {
+		if key := strings.Trim(p.Url(), "/"); all || old.Posts[key] != state.Posts[key] {
+			b.render(p.Url()+"/", "", http.StatusOK)
+		} else {
+			b.report.Unchanged++
+		}
+	}
+	if all {
+		b.render("/404/not-found/", "404.html", http.StatusNotFound)
+		b.render("/robots.txt", "robots.txt", http.StatusOK)
+		b.render("/highlight.css", "highlight.css", http.StatusOK)
+	}
+
+	uploadDir, _ := app.Config.GetString("app/upload_dir", "upload")
+	if err := copyTree(filepath.Join("view", theme, "assets", "dist"), out); err != nil {
+		return nil, err
+	}
+	if err := copyTree(uploadDir, filepath.Join(out, "upload")); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return b.report, ioutil.WriteFile(filepath.Join(out, buildStateFile), data, 0644)
+}
+
+// renderArchive renders every page of a date archive, unless its URL is
+// taken by a post, such as an old post with a year as its slug.
+func (b *builder) renderArchive(a *model.Archive, posts map[string]string) {
+	if _, ok := posts[strings.Trim(a.Url(), "/")]; ok {
+		return
+	}
+	pager, err := new(model.Posts).GetPostsByDate(a, 1, homePageSize)
+	if err != nil {
+		return
+	}
+	b.render(a.Url()+"/", "", http.StatusOK)
+	for i := int64(2); i <= pager.Pages; i++ {
+		b.render(fmt.Sprintf("%s/page/%d/", a.Url(), i), "", http.StatusOK)
+	}
+}
+
+// clearArchives removes the pages of the date archives, which are rendered
+// from scratch as there may now be fewer of them. The year directories may
+// also hold the posts, when the permalinks start with the date, so only the
+// index pages which aren't posts and the "page" directories are removed.
+func clearArchives(out string, posts map[string]string) {
+	dirs, err := ioutil.ReadDir(out)
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		if _, err := strconv.Atoi(d.Name()); !d.IsDir() || len(d.Name()) != 4 || err != nil {
+			continue
+		}
+		filepath.Walk(filepath.Join(out, d.Name()), func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(out, p)
+			key := filepath.ToSlash(rel)
+			if _, ok := posts[key]; ok && info.IsDir() {
+				return nil
+			}
+			if info.IsDir() && info.Name() == "page" {
+				os.RemoveAll(p)
+				return filepath.SkipDir
+			}
+			if _, ok := posts[filepath.ToSlash(filepath.Dir(rel))]; !ok && info.Name() == "index.html" {
+				os.Remove(p)
+			}
+			return nil
+		})
+	}
+}
+
+// render requests the given URL from the app, and writes the response to
+// file, relative to the output directory. An empty file name is derived from
+// the URL, so that "/about/" is written to "about/index.html".
+func (b *builder) render(url, file string, status int) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		b.report.Errors = append(b.report.Errors, fmt.Sprintf("%s: %v", url, err))
+		return
+	}
+	rec := httptest.NewRecorder()
+	b.app.ServeHTTP(rec, req)
+	if rec.Code != status {
+		b.report.Errors = append(b.report.Errors, fmt.Sprintf("%s: unexpected status %d", url, rec.Code))
+		return
+	}
+	if file == "" {
+		file = strings.TrimPrefix(url, "/") + "index.html"
+	}
+	dest := filepath.Join(b.out, filepath.FromSlash(file))
+	if old, err := ioutil.ReadFile(dest); err == nil && bytes.Equal(old, rec.Body.Bytes()) {
+		b.report.Unchanged++
+		return
+	}
+	os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err := ioutil.WriteFile(dest, rec.Body.Bytes(), 0644); err != nil {
+		b.report.Errors = append(b.report.Errors, fmt.Sprintf("%s: %v", url, err))
+		return
+	}
+	b.report.Rendered++
+}
+
+// postVersion changes whenever the page of the post needs to be rendered
+// again.
+func postVersion(p *model.Post) string {
+	var updated int64
+	if p.UpdatedAt != nil {
+		updated = p.UpdatedAt.UnixNano()
+	}
+	return strconv.FormatInt(updated, 10) + "-" + strconv.FormatInt(p.CommentNum, 10)
+}
+
+// layoutFingerprint hashes the theme templates and the settings that are
+// shown on every page.
+func layoutFingerprint(theme string) string {
+	h := sha1.New()
+	fmt.Fprintln(h, theme)
+	for _, t := range []string{"general", "content", "navigation", "custom", "feed", "permalink", "markdown"} {
+		if settings := model.GetSettingsByType(t); settings != nil {
+			for _, s := range *settings {
+				fmt.Fprintln(h, s.Ke, s.Value)
+			}
+		}
+	}
+	filepath.Walk(filepath.Join("view", theme), func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(p, ".html") {
+			hashFile(h, p)
+		}
+		return nil
+	})
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// listFingerprint hashes the published posts, the tags and the profiles of
+// the authors.
+func listFingerprint(posts map[string]string, tags model.Tags, authors []*model.User) string {
+	h := sha1.New()
+	slugs := make([]string, 0, len(posts))
+	for slug := range posts {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		fmt.Fprintln(h, slug, posts[slug])
+	}
+	for _, t := range tags {
+		fmt.Fprintln(h, t.Id, t.Slug, t.Name, t.Hidden)
+	}
+	for _, u := range authors {
+		fmt.Fprintln(h, u.Id, u.Slug, u.Name, u.Bio, u.Image, u.Cover, u.Website, u.Location)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func hashFile(h hash.Hash, p string) {
+	if f, err := os.Open(p); err == nil {
+		io.Copy(h, f)
+		f.Close()
+	}
+}
+
+// copyTree copies the files below src into dest, skipping the files that
+// haven't changed since they were last copied.
+func copyTree(src, dest string) error {
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if t, err := os.Stat(target); err == nil && t.Size() == info.Size() && !t.ModTime().Before(info.ModTime()) {
+			return nil
+		}
+		return copyFile(p, target, info.ModTime())
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func copyFile(src, dest string, modTime time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, modTime, modTime)
+}
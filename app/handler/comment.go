@@ -1,28 +1,51 @@
 package handler
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
-func registerCommentsHandlers(app *golf.Application, routes map[string]map[string]interface{}) {
-	app.Get("/api/comments", APICommentsHandler)
-	routes["GET"]["comments_url"] = "/api/comments"
+func registerCommentsHandlers(api *apiRegistry) {
+	comment := api.doc.SchemaOf(model.Comment{})
+	api.handle(apiRoute{
+		Name: "comments", Method: "GET", Path: "/api/comments", Tag: "comments",
+		Summary: "List the approved comments, newest first",
+		Query: []*openapi.Parameter{
+			apiQuery("page", "The page, starting at 1.", openapi.Integer()),
+		},
+		Response: openapi.Object(map[string]*openapi.Schema{
+			"comments": api.doc.SchemaOf(model.Comments{}),
+			"pager":    api.doc.SchemaOf(utils.Pager{}),
+		}),
+		Errors: []int{http.StatusNotFound},
+	}, APICommentsHandler)
 
-	app.Get("/api/comments/:comment_id", APICommentHandler)
-	routes["GET"]["comment_url"] = "/api/comments/:comment_id"
+	api.handle(apiRoute{
+		Name: "comment", Method: "GET", Path: "/api/comments/:comment_id", Tag: "comments",
+		Summary:  "Get a comment by ID",
+		Response: comment,
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APICommentHandler)
 
-	app.Get("/api/comments/post/:post_id", APICommentPostHandler) // This can be removed. Use /api/posts/:post_id/comments instead.
-	routes["GET"]["comment_post_url"] = "/api/comments/post/:post_id"
+	// This can be removed. Use /api/posts/:post_id/comments instead.
+	api.handle(apiRoute{
+		Name: "comment_post", Method: "GET", Path: "/api/comments/post/:post_id", Tag: "comments",
+		Summary:  "List the comments of a post",
+		Response: api.doc.SchemaOf(model.Comments{}),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APICommentPostHandler)
 }
 
 // APICommentHandler retrieves a comment with the given comment id.
 func APICommentHandler(ctx *golf.Context) {
 	id, err := strconv.Atoi(ctx.Param("comment_id"))
 	if err != nil {
-		handleErr(ctx, 500, err)
+		handleErr(ctx, 400, err)
 		return
 	}
 	comment := &model.Comment{Id: int64(id)}
@@ -38,7 +61,7 @@ func APICommentHandler(ctx *golf.Context) {
 func APICommentPostHandler(ctx *golf.Context) {
 	id, err := strconv.Atoi(ctx.Param("post_id"))
 	if err != nil {
-		handleErr(ctx, 500, err)
+		handleErr(ctx, 400, err)
 		return
 	}
 	comments := new(model.Comments)
@@ -50,9 +73,20 @@ func APICommentPostHandler(ctx *golf.Context) {
 	ctx.JSONIndent(comments, "", "  ")
 }
 
-// APICommentsHandler retrieves all the comments.
+// APICommentsHandler retrieves a page of the approved comments, newest first.
 func APICommentsHandler(ctx *golf.Context) {
+	page, _ := strconv.ParseInt(ctx.Request.FormValue("page"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	comments := new(model.Comments)
+	pager, err := comments.GetCommentList(page, 10, true)
+	if err != nil {
+		handleErr(ctx, 404, err)
+		return
+	}
 	ctx.JSONIndent(map[string]interface{}{
-		"message": "Not implemented",
+		"comments": comments,
+		"pager":    pager,
 	}, "", "  ")
 }
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// ExportHandler sends the whole site to the browser as a zip archive of
+// markdown files with front matter, plus a JSON document of everything.
+func ExportHandler(ctx *golf.Context) {
+	name := "SimplePosts-export-" + time.Now().Format("20060102-150405") + ".zip"
+	ctx.SetHeader("Content-Type", "application/zip")
+	ctx.SetHeader("Content-Disposition", "attachment; filename="+name)
+	if err := model.ExportToZip(ctx.Response); err != nil {
+		ctx.Abort(500)
+	}
+}
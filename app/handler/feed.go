@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/feed"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// rxRelativeUrl matches the site relative links and images in post HTML,
+// which have to be made absolute to work in feed readers.
+var rxRelativeUrl = regexp.MustCompile(`(\s(?:src|href)=["'])/([^/])`)
+
+// FeedHandler serves the feed of the latest posts, as RSS unless another
+// format is given.
+func FeedHandler(ctx *golf.Context) {
+	posts := new(model.Posts)
+	if _, err := posts.GetPostList(1, feedSize(), false, true, "published_at DESC"); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	title := model.GetSettingValue("site_title")
+	serveFeed(ctx, title, "/", "/feed/", posts)
+}
+
+// TagFeedHandler serves the feed of the latest posts with the given tag.
+func TagFeedHandler(ctx *golf.Context) {
+	tagSlug, _ := url.QueryUnescape(ctx.Param("tag"))
+	tag := &model.Tag{Slug: tagSlug}
+	if err := tag.GetTagBySlug(); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	posts := new(model.Posts)
+	if _, err := posts.GetPostsByTag(tag.Id, 1, feedSize(), true); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	title := model.GetSettingValue("site_title") + " - " + tag.Name
+	serveFeed(ctx, title, tag.Url()+"/", tag.Url()+"/feed/", posts)
+}
+
+// AuthorFeedHandler serves the feed of the latest posts by the given author.
+func AuthorFeedHandler(ctx *golf.Context) {
+	user := &model.User{Slug: ctx.Param("author")}
+	if err := user.GetUserBySlug(); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	posts := new(model.Posts)
+	if _, err := posts.GetPostsByAuthor(user.Id, 1, feedSize(), true); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	title := model.GetSettingValue("site_title") + " - " + user.Name
+	serveFeed(ctx, title, "/author/"+user.Slug+"/", "/author/"+user.Slug+"/feed/", posts)
+}
+
+func feedSize() int64 {
+	size, err := strconv.ParseInt(model.GetSettingValue("feed_size"), 10, 64)
+	if err != nil || size <= 0 {
+		return 20
+	}
+	return size
+}
+
+// serveFeed renders the posts in the format given by the "format" parameter,
+// and answers conditional requests with 304 Not Modified.
+func serveFeed(ctx *golf.Context, title, link, feedPath string, posts *model.Posts) {
+	format := ctx.Param("format")
+	if format == "" {
+		format = feed.RSS
+	} else {
+		feedPath += format + "/"
+	}
+	if _, ok := feed.ContentTypes[format]; !ok {
+		ctx.Abort(404)
+		return
+	}
+
+	f := &feed.Feed{
+		Title:       title,
+		Link:        model.SiteUrl(link),
+		FeedLink:    model.SiteUrl(feedPath),
+		Description: model.GetSettingValue("site_description"),
+	}
+	full := model.GetSettingValue("feed_content") == "full"
+	for _, p := range *posts {
+		item := feedItem(p, full)
+		if item.Updated.After(f.Updated) {
+			f.Updated = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+	if f.Updated.IsZero() {
+		f.Updated = time.Now()
+	}
+	body, err := f.Render(format)
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(body))
+	lastModified := f.Updated.UTC().Truncate(time.Second)
+	ctx.SetHeader("ETag", etag)
+	ctx.SetHeader("Last-Modified", lastModified.Format(http.TimeFormat))
+	if match := ctx.Request.Header.Get("If-None-Match"); match != "" {
+		if match == etag {
+			ctx.SendStatus(http.StatusNotModified)
+			return
+		}
+	} else if since, err := http.ParseTime(ctx.Request.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		ctx.SendStatus(http.StatusNotModified)
+		return
+	}
+	ctx.SetHeader("Content-Type", feed.ContentTypes[format])
+	ctx.Send(body)
+}
+
+func feedItem(p *model.Post, full bool) *feed.Item {
+	link := model.SiteUrl(p.Url() + "/")
+	item := &feed.Item{
+		Id:      feedItemId(p),
+		Title:   p.Title,
+		Link:    link,
+		Author:  p.Author().Name,
+		Summary: absoluteHtml(postSummary(p)),
+	}
+	if full {
+		item.Content = absoluteHtml(p.Html)
+	}
+	item.Image = model.AbsoluteUrl(p.Image)
+	for _, t := range p.Tags() {
+		item.Tags = append(item.Tags, t.Name)
+	}
+	if p.PublishedAt != nil {
+		item.Published = *p.PublishedAt
+	} else if p.CreatedAt != nil {
+		item.Published = *p.CreatedAt
+	}
+	item.Updated = item.Published
+	if p.UpdatedAt != nil && p.UpdatedAt.After(item.Updated) {
+		item.Updated = *p.UpdatedAt
+	}
+	return item
+}
+
+// feedItemId returns a tag URI (RFC 4151) identifying the post, built from
+// its ID and creation date, so that it doesn't change when the post is edited
+// or its permalink changes.
+func feedItemId(p *model.Post) string {
+	host := "localhost"
+	if u, err := url.Parse(model.SiteUrl("/")); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	date := "2000-01-01"
+	if p.CreatedAt != nil {
+		date = p.CreatedAt.Format("2006-01-02")
+	}
+	return fmt.Sprintf("tag:%s,%s:post-%d", host, date, p.Id)
+}
+
+// postSummary returns the part of the post before the "<!--more-->" marker,
+// or an excerpt of it if there is no marker.
+func postSummary(p *model.Post) string {
+	if strings.Contains(p.Markdown, "<!--more-->") {
+		return p.Summary()
+	}
+	return utils.Html2Excerpt(p.Html, 255)
+}
+
+func absoluteHtml(html string) string {
+	return rxRelativeUrl.ReplaceAllString(html, "${1}"+model.SiteUrl("/")+"${2}")
+}
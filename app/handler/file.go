@@ -1,11 +1,12 @@
 package handler
 
 import (
+	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-	"path"
+	"strconv"
 	"strings"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
@@ -14,72 +15,94 @@ import (
 	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
-func OssSetting() *oss.Bucket {
+func OssSetting() (*oss.Bucket, error) {
 	client, err := oss.New(model.Endpoint, model.Accesskey, model.Secretkey)
 	if err != nil {
-		log.Fatal("OSS设置错误", err)
+		log.Println("OSS设置错误", err)
+		return nil, err
 	}
 	bucket, err := client.Bucket(model.Bucket)
 	if err != nil {
-		log.Fatal("空间打开失败", err)
+		log.Println("空间打开失败", err)
+		return nil, err
 	}
-	return bucket
+	return bucket, nil
 }
+
+// ossEnabled loads the OSS credentials from the site settings, returning
+// false if they have not been configured.
+func ossEnabled() bool {
+	o := model.GetOssSetting()
+	if o == nil || o.Endpoint == "" || o.Bucket == "" {
+		return false
+	}
+	model.Accesskey, model.Secretkey = o.Accesskey, o.Secretkey
+	model.Endpoint, model.Bucket = o.Endpoint, o.Bucket
+	return true
+}
+
+// FileViewHandler shows the media library.
 func FileViewHandler(ctx *golf.Context) {
 	user, _ := ctx.Session.Get("user")
-	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
-	uploadDir = path.Clean(uploadDir)
-	ctx.Request.ParseForm()
-	dir, err := ctx.Query("dir")
-	dir = path.Clean(dir)
-	var (
-		ParentDir  string
-		IsChildDir bool
-	)
-	if err == nil && dir != uploadDir {
-		IsChildDir = true
-		ParentDir = path.Join(dir, "..")
+	p := ctx.Request.FormValue("page")
+	var page int
+	if p == "" {
+		page = 1
 	} else {
-		IsChildDir = false
-		dir = uploadDir
+		page, _ = strconv.Atoi(p)
 	}
-	var files []*model.File
-	if model.CheckSafe(dir, uploadDir) {
-		files = model.GetFileList(dir)
-	} else {
-		ctx.Abort(403)
+	media := new(model.MediaList)
+	pager, err := media.GetMediaList(int64(page), 20)
+	if err != nil {
+		ctx.Abort(404)
 		return
 	}
 	ctx.Loader("admin").Render("files.html", map[string]interface{}{
-		"Title":      "Files",
-		"Files":      files,
-		"User":       user,
-		"CurrentDir": dir,
-		"IsChildDir": IsChildDir,
-		"ParentDir":  ParentDir,
+		"Title": "媒体库",
+		"Media": media,
+		"User":  user,
+		"Pager": pager,
 	})
 }
 
 //从aliyun删除文件
-func delete_aliyun(filename string) {
-	bucket := OssSetting()
-	err := bucket.DeleteObject(filename)
+func delete_aliyun(m *model.Media) error {
+	bucket, err := OssSetting()
 	if err != nil {
-		log.Fatal("删除失败", err)
+		return err
 	}
+	for _, v := range m.Variants() {
+		bucket.DeleteObject(v.Path)
+	}
+	return bucket.DeleteObject(m.Path)
 }
+
+// FileRemoveHandler deletes a media file. If the file is still referenced by
+// any post, it answers with a warning instead, unless "force" is set.
 func FileRemoveHandler(ctx *golf.Context) {
-	p := ctx.Request.FormValue("path")
-	filename := strings.Split(p, "/")[1]
-	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
-	if model.CheckSafe(p, uploadDir) {
-		delete_aliyun(filename)
-		err := model.RemoveFile(p)
-		if err != nil {
-			panic(err)
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	m := &model.Media{Id: int64(id)}
+	if err := m.GetMediaById(); err != nil {
+		ctx.Abort(404)
+		return
+	}
+	if posts := m.Posts(); len(posts) > 0 && ctx.Request.FormValue("force") != "true" {
+		titles := make([]string, len(posts))
+		for i, p := range posts {
+			titles[i] = p.Title
 		}
-	} else {
-		ctx.Abort(403)
+		ctx.JSON(map[string]interface{}{
+			"status": "warning",
+			"msg":    "This file is still used by: " + strings.Join(titles, ", "),
+			"posts":  titles,
+		})
+		return
+	}
+	if err := deleteMedia(m); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
 		return
 	}
 	ctx.JSON(map[string]interface{}{
@@ -87,79 +110,187 @@ func FileRemoveHandler(ctx *golf.Context) {
 	})
 }
 
-//上传aliyun
-func upload_aliyun(filename string, body io.Reader) {
-	bucket := OssSetting()
-	err := bucket.PutObject(filename, body)
-	if err != nil {
-		log.Fatal("文件上传失败", err)
+// deleteMedia deletes a media file, along with its copy on OSS if it is
+// enabled.
+func deleteMedia(m *model.Media) error {
+	if ossEnabled() {
+		if err := delete_aliyun(m); err != nil {
+			log.Printf("[Error]: unable to delete %s from OSS: %v", m.Path, err)
+		}
 	}
+	return m.Delete()
 }
 
-func FileUploadHandler(ctx *golf.Context) {
-	req := ctx.Request
-	req.ParseMultipartForm(32 << 20)
-	f, h, e := req.FormFile("file")
-	if e != nil {
-		ctx.JSON(map[string]interface{}{
-			"status": "error",
-			"msg":    e.Error(),
-		})
+// FileUpdateHandler updates the alt text of a media file.
+func FileUpdateHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	m := &model.Media{Id: int64(id)}
+	if err := m.GetMediaById(); err != nil {
+		ctx.Abort(404)
 		return
 	}
-	data, _ := ioutil.ReadAll(f)
-	maxSize, _ := ctx.App.Config.GetInt("app.upload_size", 1024*1024*10)
-	defer func() {
-		f.Close()
-		data = nil
-		h = nil
-	}()
-	upload_aliyun(h.Filename, f)
-	if len(data) >= maxSize {
+	m.Alt = ctx.Request.FormValue("alt")
+	m.UpdatedAt = utils.Now()
+	m.UpdatedBy = u.Id
+	if err := m.Save(); err != nil {
 		ctx.JSON(map[string]interface{}{
 			"status": "error",
-			"msg":    "File size should be smaller than 10MB.",
+			"msg":    err.Error(),
 		})
 		return
 	}
-	fileExt, _ := ctx.App.Config.GetString("app.upload_files", ".jpg,.png,.gif,.zip,.txt,.doc,.docx,.xls,.xlsx,.ppt,.pptx")
-	if !strings.Contains(fileExt, path.Ext(h.Filename)) {
-		ctx.JSON(map[string]interface{}{
-			"status": "error",
-			"msg":    "Only supports documents, images and zip files.",
-		})
-		return
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+//上传aliyun
+func upload_aliyun(m *model.Media) error {
+	bucket, err := OssSetting()
+	if err != nil {
+		return err
 	}
+	paths := []string{m.Path}
+	for _, v := range m.Variants() {
+		paths = append(paths, v.Path)
+	}
+	return putOSSFiles(bucket, paths)
+}
+
+// putOSSFiles copies the given files to OSS, under the same paths.
+func putOSSFiles(bucket *oss.Bucket, paths []string) error {
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		err = bucket.PutObject(p, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileUploadHandler streams the uploaded file into the media library. The
+// request body is capped at the configured upload size before anything is
+// read, and the file never has to fit in memory.
+func FileUploadHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	maxSize, _ := ctx.App.Config.GetInt("app.upload_size", 1024*1024*10)
+	fileExt, _ := ctx.App.Config.GetString("app.upload_files", ".jpg,.png,.gif,.zip,.txt,.doc,.docx,.xls,.xlsx,.ppt,.pptx")
 	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
-	Url := model.CreateFilePath(uploadDir, h.Filename)
-	e = ioutil.WriteFile(Url, data, os.ModePerm)
-	if e != nil {
-		ctx.JSON(map[string]interface{}{
-			"status": "error",
-			"msg":    e.Error(),
-		})
-		return
+	// Leave some room for the multipart headers around the file itself.
+	ctx.Request.Body = http.MaxBytesReader(ctx.Response, ctx.Request.Body, int64(maxSize)+4096)
+	m, e := saveUploadPart(ctx.Request, uploadDir, int64(maxSize), strings.Split(fileExt, ","), u.Id)
+	if e == nil {
+		e = publishUpload(m)
 	}
-	fi, err := os.Stat(Url)
-	if err != nil {
+	if e != nil {
 		ctx.JSON(map[string]interface{}{
 			"status": "error",
 			"msg":    e.Error(),
 		})
 		return
 	}
-
-	fSize := utils.FileSize(fi.Size())
-	fileModTime := fi.ModTime()
-	fModTime := utils.DateFormat(&fileModTime, "%Y-%m-%d %H:%M")
 	ctx.JSON(map[string]interface{}{
 		"status": "success",
-		"file": map[string]interface{}{
-			"url":  Url,
-			"name": h.Filename,
-			"size": fSize,
-			"type": "File",
-			"time": fModTime,
-		},
+		"file":   mediaJSON(m),
 	})
 }
+
+// imageUploadExts are the extensions allowed for uploads which must be images.
+var imageUploadExts = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// publishUpload copies a stored upload to OSS, if it is enabled.
+func publishUpload(m *model.Media) error {
+	if ossEnabled() {
+		return upload_aliyun(m)
+	}
+	return nil
+}
+
+// publishVariants copies the variants of a stored upload to OSS, if it is
+// enabled. They are generated after the upload itself was published.
+func publishVariants(m *model.Media) error {
+	if !ossEnabled() {
+		return nil
+	}
+	bucket, err := OssSetting()
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, v := range m.Variants() {
+		paths = append(paths, v.Path)
+	}
+	return putOSSFiles(bucket, paths)
+}
+
+// saveProfileImage stores the image uploaded in the given field of the profile
+// form in the media library. It returns nil if no image was uploaded.
+func saveProfileImage(ctx *golf.Context, field string, by int64) (*model.Media, error) {
+	file, header, err := ctx.Request.FormFile(field)
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	maxSize, _ := ctx.App.Config.GetInt("app.upload_size", 1024*1024*10)
+	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
+	m, err := model.SaveUpload(uploadDir, header.Filename, file, int64(maxSize), imageUploadExts, by)
+	if err != nil {
+		return nil, err
+	}
+	return m, publishUpload(m)
+}
+
+// saveUploadPart finds the "file" part of a multipart request and streams it
+// into the upload directory.
+func saveUploadPart(req *http.Request, uploadDir string, maxSize int64, allowedExts []string, by int64) (*model.Media, error) {
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No file was uploaded.")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+		return model.SaveUpload(uploadDir, part.FileName(), part, maxSize, allowedExts, by)
+	}
+}
+
+// mediaJSON returns a media file as a map, in order to be encoded as JSON.
+func mediaJSON(m *model.Media) map[string]interface{} {
+	variants := make(map[string]string)
+	for _, v := range m.Variants() {
+		variants[v.Name] = "/" + v.Path
+	}
+	return map[string]interface{}{
+		"id":       m.Id,
+		"url":      m.Url(),
+		"name":     m.Name,
+		"size":     utils.FileSize(m.Size),
+		"type":     m.MimeType,
+		"width":    m.Width,
+		"height":   m.Height,
+		"alt":      m.Alt,
+		"variants": variants,
+		"time":     utils.DateFormat(m.CreatedAt, "%Y-%m-%d %H:%M"),
+	}
+}
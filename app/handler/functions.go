@@ -10,8 +10,45 @@ func getAllTags() []*model.Tag {
 	return tags.GetAll()
 }
 
+// getArchives returns the months with published posts, newest first, along
+// with the number of posts in each of them.
+func getArchives() []*model.Archive {
+	archives, _ := model.GetArchives()
+	return archives
+}
+
 func getRecentPosts() []*model.Post {
 	posts := new(model.Posts)
 	_, _ = posts.GetPostList(1, 5, false, true, "published_at DESC")
 	return *posts
 }
+
+// getPrevPost returns the post published before the given one, or nil. If a
+// tag slug is given, only the posts with that tag are considered.
+func getPrevPost(p *model.Post, tag ...string) *model.Post {
+	if len(tag) > 0 {
+		t := &model.Tag{Slug: tag[0]}
+		if err := t.GetTagBySlug(); err != nil {
+			return nil
+		}
+		return p.PrevPost(t.Id)
+	}
+	return p.PrevPost()
+}
+
+// getNextPost returns the post published after the given one, or nil. If a
+// tag slug is given, only the posts with that tag are considered.
+func getNextPost(p *model.Post, tag ...string) *model.Post {
+	if len(tag) > 0 {
+		t := &model.Tag{Slug: tag[0]}
+		if err := t.GetTagBySlug(); err != nil {
+			return nil
+		}
+		return p.NextPost(t.Id)
+	}
+	return p.NextPost()
+}
+
+func getRelatedPosts(p *model.Post, size int) []*model.Post {
+	return p.RelatedPosts(size)
+}
@@ -3,17 +3,26 @@ package handler
 import (
 	"net/url"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
-	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// The number of posts on each page of the home page, the tag pages and the
+// author pages.
+const (
+	homePageSize   = 10
+	tagPageSize    = 5
+	authorPageSize = 10
 )
 
 func RegisterFunctions(app *golf.Application) {
 	app.View.FuncMap["Tags"] = getAllTags
 	app.View.FuncMap["RecentPosts"] = getRecentPosts
+	app.View.FuncMap["Archives"] = getArchives
+	app.View.FuncMap["PrevPost"] = getPrevPost
+	app.View.FuncMap["NextPost"] = getNextPost
+	app.View.FuncMap["RelatedPosts"] = getRelatedPosts
 }
 
 func HomeHandler(ctx *golf.Context) {
@@ -26,7 +35,7 @@ func HomeHandler(ctx *golf.Context) {
 		page, _ = strconv.Atoi(p)
 	}
 	posts := new(model.Posts)
-	pager, err := posts.GetPostList(int64(page), 10, false, true, "published_at DESC")
+	pager, err := posts.GetPostList(int64(page), homePageSize, false, true, "published_at DESC")
 	if err != nil {
 		ctx.Abort(404)
 		return
@@ -45,10 +54,31 @@ func ContentHandler(ctx *golf.Context) {
 	slug := ctx.Param("slug")
 	post := new(model.Post)
 	err := post.GetPostBySlug(slug)
+	if err != nil {
+		// The slug may have been changed since the link was published.
+		if current, err := model.GetPostBySlugHistory(slug); err == nil && current.IsPublished {
+			ctx.Redirect301(current.Url() + "/")
+			return
+		}
+		if rxArchiveYear.MatchString(slug) {
+			ArchiveHandler(ctx)
+			return
+		}
+	}
 	if err != nil || !post.IsPublished {
 		ctx.Abort(404)
 		return
 	}
+	// Posts live elsewhere unless the permalink is the default one.
+	if u := post.Url() + "/"; u != "/"+slug+"/" {
+		ctx.Redirect301(u)
+		return
+	}
+	renderPost(ctx, post)
+}
+
+// renderPost shows a post or a page.
+func renderPost(ctx *golf.Context, post *model.Post) {
 	post.Hits++
 	data := map[string]interface{}{
 		"Title":   post.Title,
@@ -75,52 +105,13 @@ func TagsHandler(ctx *golf.Context) {
 		return
 	}
 	data := map[string]interface{}{
-		"Tags":  tags,
-		"Posts": posts,
+		"Tags":      tags,
+		"Posts":     posts,
+		"Canonical": "/tags/",
 	}
 	ctx.Loader("theme").Render("tags.html", data)
 }
 
-func SiteMapHandler(ctx *golf.Context) {
-	baseUrl := model.GetSettingValue("site_url")
-	posts := new(model.Posts)
-	_, _ = posts.GetPostList(1, 50, false, true, "published_at DESC")
-	navigators := model.GetNavigators()
-	now := utils.Now().Format(time.RFC3339)
-
-	articleMap := make([]map[string]string, posts.Len())
-	for i := 0; i < posts.Len(); i++ {
-		m := make(map[string]string)
-		m["Link"] = strings.Replace(baseUrl+posts.Get(i).Url(), baseUrl+"/", baseUrl, -1)
-		m["Created"] = posts.Get(i).PublishedAt.Format(time.RFC3339)
-		articleMap[i] = m
-	}
-
-	navMap := make([]map[string]string, 0)
-	for _, n := range navigators {
-		m := make(map[string]string)
-		if n.Url == "/" {
-			continue
-		}
-		if strings.HasPrefix(n.Url, "/") {
-			m["Link"] = strings.Replace(baseUrl+n.Url, baseUrl+"/", baseUrl, -1)
-		} else {
-			m["Link"] = n.Url
-		}
-		m["Created"] = now
-		navMap = append(navMap, m)
-	}
-
-	ctx.SetHeader("Content-Type", "application/rss+xml;charset=UTF-8")
-	ctx.Loader("base").Render("sitemap.xml", map[string]interface{}{
-		"Title":      model.GetSettingValue("site_title"),
-		"Link":       baseUrl,
-		"Created":    now,
-		"Posts":      articleMap,
-		"Navigators": navMap,
-	})
-}
-
 func TagHandler(ctx *golf.Context) {
 	p := ctx.Param("page")
 
@@ -140,7 +131,7 @@ func TagHandler(ctx *golf.Context) {
 		return
 	}
 	posts := new(model.Posts)
-	pager, err := posts.GetPostsByTag(tag.Id, int64(page), 5, true)
+	pager, err := posts.GetPostsByTag(tag.Id, int64(page), tagPageSize, true)
 	data := map[string]interface{}{
 		"Posts": posts,
 		"Pager": pager,
@@ -150,27 +141,36 @@ func TagHandler(ctx *golf.Context) {
 	ctx.Loader("theme").Render("tag.html", data)
 }
 
-func RssHandler(ctx *golf.Context) {
-	baseUrl := model.GetSettingValue("site_url")
-	posts := new(model.Posts)
-	_, _ = posts.GetPostList(1, 20, false, true, "published_at DESC")
-	articleMap := make([]map[string]string, posts.Len())
-	for i := 0; i < posts.Len(); i++ {
-		m := make(map[string]string)
-		m["Title"] = posts.Get(i).Title
-		m["Link"] = posts.Get(i).Url()
-		m["Author"] = posts.Get(i).Author().Name
-		m["Desc"] = posts.Get(i).Excerpt()
-		m["Created"] = posts.Get(i).CreatedAt.Format(time.RFC822)
-		articleMap[i] = m
-	}
-	ctx.SetHeader("Content-Type", "text/xml; charset=utf-8")
+// AuthorHandler shows the profile of an author along with their published
+// posts.
+func AuthorHandler(ctx *golf.Context) {
+	p := ctx.Param("page")
+
+	var page int
+	if p == "" {
+		page = 1
+	} else {
+		page, _ = strconv.Atoi(p)
+	}
 
-	ctx.Loader("base").Loader("base").Render("rss.xml", map[string]interface{}{
-		"Title":   model.GetSettingValue("site_title"),
-		"Link":    baseUrl,
-		"Desc":    model.GetSettingValue("site_description"),
-		"Created": utils.Now().Format(time.RFC822),
-		"Posts":   articleMap,
-	})
+	authorSlug, _ := url.QueryUnescape(ctx.Param("author"))
+	author := &model.User{Slug: authorSlug}
+	err := author.GetUserBySlug()
+	if err != nil {
+		NotFoundHandler(ctx)
+		return
+	}
+	posts := new(model.Posts)
+	pager, err := posts.GetPostsByAuthor(author.Id, int64(page), authorPageSize, true)
+	if err != nil {
+		ctx.Abort(404)
+		return
+	}
+	data := map[string]interface{}{
+		"Posts":  posts,
+		"Pager":  pager,
+		"Author": author,
+		"Title":  author.Name,
+	}
+	ctx.Loader("theme").Render("author.html", data)
 }
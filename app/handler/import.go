@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/importer"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// ImportViewHandler shows the form used to import content from other blogging
+// platforms.
+func ImportViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	ctx.Loader("admin").Render("import.html", map[string]interface{}{
+		"Title":     "导入",
+		"User":      user,
+		"Importers": importer.Names(),
+	})
+}
+
+// ImportHandler imports an uploaded export file, or only reports what would be
+// imported if "dry_run" is set. The dry runs are quick, so their report is
+// returned at once; the imports themselves are run by an "import" job, whose
+// result is the report.
+func ImportHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	maxSize, _ := ctx.App.Config.GetInt("app.import_size", 1024*1024*100)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Response, ctx.Request.Body, int64(maxSize))
+	file, header, err := ctx.Request.FormFile("file")
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+	path, err := saveImportFile(file, header.Filename)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+
+	name := ctx.Request.FormValue("importer")
+	if ctx.Request.FormValue("dry_run") == "" {
+		job, err := model.EnqueueJob("import", importJob{Importer: name, Path: path, By: u.Id})
+		if err != nil {
+			os.Remove(path)
+			ctx.JSON(map[string]interface{}{
+				"status": "error",
+				"msg":    err.Error(),
+			})
+			return
+		}
+		ctx.JSON(map[string]interface{}{
+			"status": "success",
+			"job":    job.Id,
+		})
+		return
+	}
+	defer os.Remove(path)
+	report, err := importer.Import(name, path, importer.Options{
+		DryRun:    true,
+		By:        u.Id,
+		SaveImage: importImageSaver(ctx.App, u.Id),
+	})
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"report": report,
+	})
+}
+
+// importJob is the payload of the "import" jobs.
+type importJob struct {
+	Importer string `json:"importer"`
+	Path     string `json:"path"` // The uploaded file, removed once it is imported
+	By       int64  `json:"by"`
+}
+
+// runImportJob imports the file of an "import" job, and returns the report of
+// the import as JSON.
+func runImportJob(app *golf.Application, j *model.Job) (string, error) {
+	var p importJob
+	if err := j.Decode(&p); err != nil {
+		return "", model.PermanentJobError(err)
+	}
+	defer os.Remove(p.Path)
+	report, err := importer.Import(p.Importer, p.Path, importer.Options{
+		By:        p.By,
+		SaveImage: importImageSaver(app, p.By),
+	})
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(report)
+	return string(b), err
+}
+
+// saveImportFile copies an uploaded export into a temporary file. Importers
+// read from a path, and some of them tell formats apart by the extension, so
+// the file keeps the extension of its original name.
+func saveImportFile(r io.Reader, name string) (string, error) {
+	tmp, err := ioutil.TempFile("", "import-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	path := tmp.Name() + strings.ToLower(filepath.Ext(name))
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// importImageSaver stores the images downloaded by an import the same way as
+// uploads from the media library.
+func importImageSaver(app *golf.Application, by int64) func(string, io.Reader) (string, error) {
+	maxSize, _ := app.Config.GetInt("app.upload_size", 1024*1024*10)
+	uploadDir, _ := app.Config.GetString("upload_dir", "upload")
+	return func(name string, r io.Reader) (string, error) {
+		m, err := model.SaveUpload(uploadDir, name, r, int64(maxSize), imageUploadExts, by)
+		if err != nil {
+			return "", err
+		}
+		if err = publishUpload(m); err != nil {
+			return "", err
+		}
+		return m.Url(), nil
+	}
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/seo"
 	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
@@ -13,11 +15,14 @@ func Initialize(app *golf.Application) *golf.Application {
 	app.Config.Set("app/static_dir", "static")
 	app.Config.Set("app.log_dir", "tmp/log")
 	app.Config.Set("app/upload_dir", "upload")
+	app.Config.Set("app/backup_dir", "backup")
 	upload_dir, _ := app.Config.GetString("app/upload_dir", "upload")
+	backup_dir, _ := app.Config.GetString("app/backup_dir", "backup")
 	registerMiddlewares(app)
 	registerFuncMap(app)
 	RegisterFunctions(app)
 	theme := model.GetSettingValue("theme")
+	RegisterThemeShortcodes(theme)
 	app.View.SetTemplateLoader("base", "view")
 	app.View.SetTemplateLoader("admin", filepath.Join("view", "admin"))
 	app.View.SetTemplateLoader("theme", filepath.Join("view", theme))
@@ -29,6 +34,10 @@ func Initialize(app *golf.Application) *golf.Application {
 	registerAdminURLHandlers(app)
 	registerHomeHandler(app)
 	registerAPIHandler(app)
+	registerJobHandlers(app)
+	if err := model.ScheduleBackups(backup_dir, upload_dir); err != nil {
+		log.Printf("[Error]: can not schedule the backups: %v", err)
+	}
 
 	return app
 }
@@ -40,13 +49,17 @@ func registerFuncMap(app *golf.Application) {
 	app.View.FuncMap["Setting"] = model.GetSettingValue
 	app.View.FuncMap["Navigator"] = model.GetNavigators
 	app.View.FuncMap["Md2html"] = utils.Markdown2HtmlTemplate
+	app.View.FuncMap["FileSize"] = utils.FileSize
+	app.View.FuncMap["SEO"] = seo.Tags
 }
 
 func registerMiddlewares(app *golf.Application) {
 	app.Use(
 		golf.LoggingMiddleware(os.Stdout),
 		golf.RecoverMiddleware,
+		RedirectMiddleware,
 		golf.SessionMiddleware,
+		PermalinkMiddleware,
 	)
 }
 
@@ -60,12 +73,43 @@ func registerAdminURLHandlers(app *golf.Application) {
 	app.Get("/admin/", authChain.Final(AdminHandler))
 	app.Get("/admin/profile/", authChain.Final(ProfileHandler))
 	app.Post("/admin/profile/", authChain.Final(ProfileChangeHandler))
+	app.Post("/admin/profile/tokens/", authChain.Final(APITokenCreateHandler))
+	app.Delete("/admin/profile/tokens/:id/", authChain.Final(APITokenRemoveHandler))
 	app.Get("/admin/editor/post/", authChain.Final(PostCreateHandler))
 	app.Post("/admin/editor/post/", authChain.Final(PostSaveHandler))
+	app.Get("/admin/slug/", authChain.Final(SlugPreviewHandler))
 	app.Get("/admin/posts/", authChain.Final(AdminPostHandler))
 	app.Get("/admin/editor/:id/", authChain.Final(ContentEditHandler))
 	app.Post("/admin/editor/:id/", authChain.Final(ContentSaveHandler))
 	app.Delete("/admin/editor/:id/", authChain.Final(ContentRemoveHandler))
+	app.Get("/admin/files/", authChain.Final(FileViewHandler))
+	app.Post("/admin/files/upload/", authChain.Final(FileUploadHandler))
+	app.Post("/admin/files/:id/", authChain.Final(FileUpdateHandler))
+	app.Delete("/admin/files/:id/", authChain.Final(FileRemoveHandler))
+	app.Get("/admin/backup/", authChain.Final(BackupViewHandler))
+	app.Post("/admin/backup/", authChain.Final(BackupCreateHandler))
+	app.Post("/admin/backup/schedule/", authChain.Final(BackupScheduleHandler))
+	app.Get("/admin/backup/download/:file", authChain.Final(BackupDownloadHandler))
+	app.Get("/admin/export/", authChain.Final(ExportHandler))
+	app.Get("/admin/import/", authChain.Final(ImportViewHandler))
+	app.Post("/admin/import/", authChain.Final(ImportHandler))
+	app.Get("/admin/permalink/", authChain.Final(PermalinkViewHandler))
+	app.Post("/admin/permalink/", authChain.Final(PermalinkSaveHandler))
+	app.Post("/admin/permalink/transliteration/", authChain.Final(SlugTransliterationSaveHandler))
+	app.Get("/admin/markdown/", authChain.Final(MarkdownViewHandler))
+	app.Post("/admin/markdown/", authChain.Final(MarkdownSaveHandler))
+	app.Post("/admin/markdown/rerender/", authChain.Final(MarkdownRerenderHandler))
+	app.Get("/admin/redirects/", authChain.Final(RedirectViewHandler))
+	app.Post("/admin/redirects/", authChain.Final(RedirectSaveHandler))
+	app.Delete("/admin/redirects/:id/", authChain.Final(RedirectRemoveHandler))
+	app.Get("/admin/webhooks/", authChain.Final(WebhookViewHandler))
+	app.Post("/admin/webhooks/", authChain.Final(WebhookSaveHandler))
+	app.Delete("/admin/webhooks/:id/", authChain.Final(WebhookRemoveHandler))
+	app.Post("/admin/webhooks/deliveries/:id/redeliver/", authChain.Final(WebhookRedeliverHandler))
+	app.Get("/admin/jobs/", authChain.Final(JobViewHandler))
+	app.Get("/admin/jobs/:id/", authChain.Final(JobHandler))
+	app.Post("/admin/jobs/:id/retry/", authChain.Final(JobRetryHandler))
+	app.Post("/admin/jobs/:id/cancel/", authChain.Final(JobCancelHandler))
 	app.Get("/admin/password/", authChain.Final(AdminPasswordPage))
 	app.Post("/admin/password/", authChain.Final(AdminPasswordChange))
 }
@@ -78,8 +122,26 @@ func registerHomeHandler(app *golf.Application) {
 	app.Get("/tags/", TagsHandler)
 	app.Get("/tag/:tag/", TagHandler)
 	app.Get("/tag/:tag/page/:page/", TagHandler)
-	app.Get("/feed/", RssHandler)
-	app.Get("/sitemap.xml", SiteMapHandler)
+	app.Get("/tag/:tag/feed/", TagFeedHandler)
+	app.Get("/tag/:tag/feed/:format/", TagFeedHandler)
+	app.Get("/author/:author/", AuthorHandler)
+	app.Get("/author/:author/page/:page/", AuthorHandler)
+	app.Get("/author/:author/feed/", AuthorFeedHandler)
+	app.Get("/author/:author/feed/:format/", AuthorFeedHandler)
+	app.Get("/feed/", FeedHandler)
+	app.Get("/feed/:format/", FeedHandler)
+	app.Get("/sitemap.xml", SitemapIndexHandler)
+	app.Get("/sitemaps/:name", SitemapHandler)
+	app.Get("/robots.txt", RobotsHandler)
+	app.Get("/highlight.css", HighlightCSSHandler)
+	app.Get("/archive/", ArchiveIndexHandler)
+	// The year of the date archives takes the place of the post slug, see
+	// ArchiveHandler.
+	app.Get("/:slug/page/:page/", ArchiveHandler)
+	app.Get("/:slug/:month/", ArchiveHandler)
+	app.Get("/:slug/:month/page/:page/", ArchiveHandler)
+	app.Get("/:slug/:month/:day/", ArchiveHandler)
+	app.Get("/:slug/:month/:day/page/:page/", ArchiveHandler)
 	app.Get("/:slug/", statsChain.Final(ContentHandler))
 }
 
@@ -89,9 +151,32 @@ func registerAPIHandler(app *golf.Application) {
 	routes["POST"] = map[string]interface{}{}
 	routes["PUT"] = map[string]interface{}{}
 	routes["DELETE"] = map[string]interface{}{}
-	registerJWTHandlers(app, routes)
-	registerPostHandlers(app, routes)
-	registerTagHandlers(app, routes)
-	registerUserHandlers(app, routes)
+	routes["PATCH"] = map[string]interface{}{}
+	doc := newAPIDocument()
+	v1 := &apiRegistry{
+		app:    app,
+		routes: routes,
+		doc:    doc,
+		auth:   JWTScopeMiddleware,
+		errors: apiv1ErrorSchema(doc),
+	}
+	registerJWTHandlers(v1)
+	registerPostHandlers(v1)
+	registerTagHandlers(v1)
+	registerUserHandlers(v1)
+	registerCommentsHandlers(v1)
+	v2 := &apiRegistry{
+		app:       app,
+		routes:    routes,
+		doc:       doc,
+		auth:      APIv2ScopeMiddleware,
+		errors:    apiv2ErrorSchema(doc),
+		authError: apiv2ErrorSchema(doc),
+	}
+	registerAPIv2Handlers(v2)
 	app.Get("/api", APIDocumentationHandler(routes))
+	app.Get("/api/openapi.json", OpenAPIHandler(doc))
+	routes["GET"]["openapi_url"] = "/api/openapi.json"
+	app.Get("/api/docs", APIDocsHandler)
+	routes["GET"]["docs_url"] = "/api/docs"
 }
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// jobListSize is the number of jobs shown on the jobs page.
+const jobListSize = 100
+
+// registerJobHandlers registers the job types which need the handlers, such
+// as the imports and the publishing of uploads.
+func registerJobHandlers(app *golf.Application) {
+	model.RegisterJobType(model.JobType{
+		Name:        "posts.rerender",
+		MaxAttempts: 1,
+		Run: func(ctx context.Context, j *model.Job) (string, error) {
+			n, err := model.RerenderPosts()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d posts rendered again.", n), nil
+		},
+	})
+	model.RegisterJobType(model.JobType{
+		Name:        "import",
+		MaxAttempts: 1,
+		Run: func(ctx context.Context, j *model.Job) (string, error) {
+			return runImportJob(app, j)
+		},
+	})
+	model.RegisterJobType(model.JobType{
+		Name: "media.variants",
+		Run: func(ctx context.Context, j *model.Job) (string, error) {
+			var p model.MediaJob
+			if err := j.Decode(&p); err != nil {
+				return "", model.PermanentJobError(err)
+			}
+			m := &model.Media{Id: p.MediaId}
+			if err := m.GetMediaById(); err != nil {
+				return "", model.PermanentJobError(err)
+			}
+			if err := m.GenerateVariants(); err == model.ErrImageNotDecodable {
+				return "Skipped, the image can not be decoded.", nil
+			} else if err != nil {
+				return "", err
+			}
+			if err := publishVariants(m); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d variants generated.", len(m.Variants())), nil
+		},
+	})
+}
+
+// JobViewHandler lists the jobs of the status given by "status", the queued
+// ones by default, along with the number of jobs of every status.
+func JobViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	status := ctx.Request.URL.Query().Get("status")
+	if status == "" {
+		status = model.JobQueued
+	}
+	jobs := new(model.Jobs)
+	if err := jobs.GetJobsByStatus(status, jobListSize); err != nil {
+		ctx.Abort(500)
+		return
+	}
+	counts, err := model.CountJobsByStatus()
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+	ctx.Loader("admin").Render("jobs.html", map[string]interface{}{
+		"Title":    "任务",
+		"User":     user,
+		"Jobs":     jobs,
+		"Status":   status,
+		"Statuses": model.JobStatuses,
+		"Counts":   counts,
+	})
+}
+
+// JobHandler sends a job as JSON, so that the pages which queued it can wait
+// for its result.
+func JobHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	j := &model.Job{Id: int64(id)}
+	if err := j.GetJobById(); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    "Job not found.",
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"job":    j,
+	})
+}
+
+// JobRetryHandler queues a failed or canceled job again.
+func JobRetryHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	jobActionResponse(ctx, model.RetryJob(int64(id)))
+}
+
+// JobCancelHandler cancels a queued or running job.
+func JobCancelHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	jobActionResponse(ctx, model.CancelJob(int64(id)))
+}
+
+func jobActionResponse(ctx *golf.Context, err error) {
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
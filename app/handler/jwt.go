@@ -16,14 +16,23 @@ type JWTPostBody struct {
 	Password string `json:"password"`
 }
 
-func registerJWTHandlers(app *golf.Application, routes map[string]map[string]interface{}) {
-	adminChain := golf.NewChain(JWTAuthMiddleware)
-	// Auth
-	app.Post("/auth", JWTAuthLoginHandler)
-	routes["POST"]["auth_new_url"] = "/auth"
+func registerJWTHandlers(api *apiRegistry) {
+	jwt := api.doc.SchemaOf(model.JWT{})
+	api.handle(apiRoute{
+		Name: "auth_new", Method: "POST", Path: "/auth", Tag: "auth",
+		Summary:   "Sign in, and get a token for the X-SESSION-TOKEN header",
+		Body:      api.doc.SchemaOf(JWTPostBody{}),
+		BodyTypes: []string{"application/json", "application/x-www-form-urlencoded"},
+		Response:  jwt,
+		Errors:    []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError},
+	}, JWTAuthLoginHandler)
 
-	app.Get("/auth", adminChain.Final(JWTDecryptHandler))
-	routes["GET"]["auth_decrypt_url"] = "/auth"
+	api.handle(apiRoute{
+		Name: "auth_decrypt", Method: "GET", Path: "/auth", Tag: "auth",
+		Summary:  "Decode the token of the request",
+		Auth:     authRequired,
+		Response: jwt,
+	}, JWTDecryptHandler)
 }
 
 func JWTAuthLoginHandler(ctx *golf.Context) {
@@ -72,6 +81,7 @@ func JWTAuthLoginHandler(ctx *golf.Context) {
 		ctx.JSON(map[string]interface{}{"status": "error"})
 		return
 	}
+	model.Emit(model.UserLoggedIn{User: user, Ip: ctx.ClientIP(), Via: "api"})
 
 	ctx.SendStatus(http.StatusOK)
 	ctx.JSON(token)
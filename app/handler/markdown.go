@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/markdown"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// MarkdownViewHandler shows the form used to configure the markdown pipeline.
+func MarkdownViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	ctx.Loader("admin").Render("markdown.html", map[string]interface{}{
+		"Title":          "Markdown",
+		"User":           user,
+		"Config":         markdown.GetConfig(),
+		"Extensions":     markdown.ExtensionNames(),
+		"Sanitizers":     markdown.SanitizerNames(),
+		"PostProcessors": markdown.PostProcessorNames(),
+		"Shortcodes":     markdown.ShortcodeNames(),
+		"Style":          model.GetHighlightStyle(),
+		"Styles":         markdown.HighlightStyles(),
+	})
+}
+
+// MarkdownSaveHandler changes the markdown pipeline, and renders every post
+// again if asked to.
+func MarkdownSaveHandler(ctx *golf.Context) {
+	ctx.Request.ParseForm()
+	c := markdown.Config{
+		Extensions:     ctx.Request.Form["extension"],
+		Sanitizer:      ctx.Request.FormValue("sanitizer"),
+		PostProcessors: ctx.Request.Form["postprocessor"],
+	}
+	err := model.SetMarkdownConfig(c)
+	if err == nil {
+		err = model.SetHighlightStyle(ctx.Request.FormValue("highlight_style"))
+	}
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	if ctx.Request.FormValue("rerender") != "on" {
+		ctx.JSON(map[string]interface{}{
+			"status": "success",
+		})
+		return
+	}
+	MarkdownRerenderHandler(ctx)
+}
+
+// MarkdownRerenderHandler queues a "posts.rerender" job, which renders every
+// post again with the current markdown pipeline.
+func MarkdownRerenderHandler(ctx *golf.Context) {
+	job, err := model.EnqueueJob("posts.rerender", nil)
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"job":    job.Id,
+	})
+}
+
+// HighlightCSSHandler serves the CSS of the highlighted code, in the style
+// chosen by the "highlight_style" setting, or by the style query parameter.
+func HighlightCSSHandler(ctx *golf.Context) {
+	style := ctx.Request.URL.Query().Get("style")
+	if style == "" {
+		style = model.GetHighlightStyle()
+	}
+	css, err := markdown.HighlightCSS(style)
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+	ctx.SetHeader("Content-Type", "text/css; charset=utf-8")
+	ctx.Send(css)
+}
+
+// RegisterThemeShortcodes registers the shortcodes of the theme, which are the
+// templates in its "shortcodes" directory, named after the shortcode. They
+// replace the built-in shortcodes of the same name. The templates are given
+// the Name, Args, Params and Inner of the shortcode call.
+func RegisterThemeShortcodes(theme string) {
+	files, _ := filepath.Glob(filepath.Join("view", theme, "shortcodes", "*.html"))
+	for _, f := range files {
+		t, err := template.ParseFiles(f)
+		if err != nil {
+			log.Printf("[Error] Can not parse shortcode %s: %v", f, err)
+			continue
+		}
+		markdown.RegisterShortcode(strings.TrimSuffix(filepath.Base(f), ".html"), func(c *markdown.ShortcodeCall) (string, error) {
+			var b bytes.Buffer
+			err := t.Execute(&b, map[string]interface{}{
+				"Name":   c.Name,
+				"Args":   c.Args,
+				"Params": c.Params,
+				"Inner":  template.HTML(c.Inner),
+			})
+			return b.String(), err
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
@@ -44,19 +47,108 @@ func AuthMiddleware(next golf.HandlerFunc) golf.HandlerFunc {
 	return fn
 }
 
+// errAPIToken is the error of the API requests without a valid token.
+var errAPIToken = errors.New("A valid X-SESSION-TOKEN or \"Authorization: Bearer\" header is required.")
+
+// apiScopeError returns the error of an API request whose token lacks the
+// scope of the route.
+func apiScopeError(scope string) error {
+	if scope == "" {
+		return errors.New("This route needs a session token, not a personal API token.")
+	}
+	return fmt.Errorf("This token lacks the %s scope.", scope)
+}
+
+// apiRequestToken returns the token of an API request, if it has a valid one:
+// either a session token, returned by POST /auth, in the X-SESSION-TOKEN
+// header, or a personal API token in the "Authorization: Bearer" header.
+func apiRequestToken(ctx *golf.Context) (model.JWT, bool) {
+	if tokenHeader := ctx.Header("X-SESSION-TOKEN"); tokenHeader != "" {
+		token, err := model.ValidateJWT(tokenHeader)
+		if err != nil {
+			return model.JWT{}, false
+		}
+		return model.NewJWTFromToken(token), true
+	}
+	auth := ctx.Header("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return model.JWT{}, false
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	if !model.IsAPIToken(value) {
+		return model.JWT{}, false
+	}
+	t, err := model.GetAPITokenByValue(value)
+	if err != nil {
+		return model.JWT{}, false
+	}
+	token, err := t.JWT()
+	if err != nil {
+		return model.JWT{}, false
+	}
+	t.Touch()
+	return token, true
+}
+
+// JWTAuthMiddleware lets only the requests with a session token through.
 func JWTAuthMiddleware(next golf.HandlerFunc) golf.HandlerFunc {
+	return JWTScopeMiddleware("")(next)
+}
+
+// JWTScopeMiddleware lets the requests with a session token through, along
+// with the ones with a personal API token of the given scope. The requests
+// without a valid token get a 401, and the ones whose token lacks the scope a
+// 403.
+func JWTScopeMiddleware(scope string) golf.MiddlewareHandlerFunc {
+	return func(next golf.HandlerFunc) golf.HandlerFunc {
+		return func(ctx *golf.Context) {
+			token, ok := apiRequestToken(ctx)
+			if !ok {
+				ctx.SendStatus(http.StatusUnauthorized)
+				return
+			}
+			if !token.Allows(scope) {
+				ctx.SendStatus(http.StatusForbidden)
+				return
+			}
+			ctx.Session.Set("jwt", token)
+			next(ctx)
+		}
+	}
+}
+
+// PermalinkMiddleware shows the posts at the URLs given by the permalink
+// setting, and redirects the URLs of previous permalink settings to them. The
+// default permalink is left to ContentHandler.
+func PermalinkMiddleware(next golf.HandlerFunc) golf.HandlerFunc {
 	return func(ctx *golf.Context) {
-		tokenHeader := ctx.Header("X-SESSION-TOKEN")
-		if tokenHeader == "" {
-			ctx.SendStatus(http.StatusUnauthorized)
-			return
+		if ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead {
+			if post, ok := model.GetPostByUrl(ctx.Request.URL.Path); ok && post.IsPublished {
+				if u := post.Url() + "/"; u != ctx.Request.URL.Path {
+					ctx.Redirect301(u)
+				} else {
+					renderPost(ctx, post)
+				}
+				return
+			}
 		}
-		token, err := model.ValidateJWT(tokenHeader)
-		if err != nil {
-			ctx.SendStatus(http.StatusUnauthorized)
-			return
+		next(ctx)
+	}
+}
+
+// RedirectMiddleware sends GET requests matching a redirect rule added by the
+// admin to the rule's target with a 301, keeping the query string.
+func RedirectMiddleware(next golf.HandlerFunc) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		if ctx.Request.Method == http.MethodGet || ctx.Request.Method == http.MethodHead {
+			if target, ok := model.FindRedirect(ctx.Request.URL.Path); ok {
+				if q := ctx.Request.URL.RawQuery; q != "" {
+					target += "?" + q
+				}
+				ctx.Redirect301(target)
+				return
+			}
 		}
-		ctx.Session.Set("jwt", model.NewJWTFromToken(token))
 		next(ctx)
 	}
 }
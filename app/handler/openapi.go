@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+)
+
+// apiVersion is the version of the API given in its OpenAPI document.
+const apiVersion = "2.0"
+
+// The names of the security schemes of the session tokens and of the
+// personal API tokens in the OpenAPI document.
+const (
+	apiSecurity      = "sessionToken"
+	apiTokenSecurity = "apiToken"
+)
+
+// An apiAuth tells whether a route of the API needs a token.
+type apiAuth int
+
+const (
+	// authNone routes ignore the token.
+	authNone apiAuth = iota
+	// authOptional routes show more with a token, such as drafts.
+	authOptional
+	// authRequired routes refuse the requests without a token.
+	authRequired
+)
+
+// An apiRoute is a route of the API, both as registered and as documented in
+// the OpenAPI document. The parameters of its path are documented as integers
+// when their names end with "_id", and as strings otherwise.
+type apiRoute struct {
+	Name      string   // The key of the route in /api, without "_url", and its operation ID
+	Method    string   // The method listed in /api
+	Aliases   []string // Other methods the route answers, such as PUT for PATCH
+	Path      string
+	Tag       string
+	Summary   string
+	Auth      apiAuth
+	Scope     string // The scope personal API tokens need, none if they can't call the route
+	Query     []*openapi.Parameter
+	Body      *openapi.Schema
+	BodyTypes []string        // The media types of the body, JSON by default
+	Status    int             // The status code of success, 200 by default
+	Created   bool            // Whether the route answers 201 when it adds the resource
+	Response  *openapi.Schema // The body of success, nil if it is empty
+	Errors    []int
+}
+
+// An apiRegistry registers the routes of a version of the API, and documents
+// them in the OpenAPI document as it goes.
+type apiRegistry struct {
+	app       *golf.Application
+	routes    map[string]map[string]interface{}
+	doc       *openapi.Document
+	errors    *openapi.Schema // The body of the errors
+	authError *openapi.Schema // The body of the errors of auth, nil if it is empty
+	// auth returns the middleware refusing the requests without a token
+	// allowed the given scope.
+	auth func(scope string) golf.MiddlewareHandlerFunc
+}
+
+// newAPIDocument returns the OpenAPI document the routes of every version of
+// the API are added to.
+func newAPIDocument() *openapi.Document {
+	doc := openapi.New("SimplePosts API", apiVersion)
+	doc.Info.Description = "The API of the blog. Reading public content needs no token; " +
+		"the other requests need either the token returned by POST /auth in the X-SESSION-TOKEN header, " +
+		"or a personal API token with the scope of the operation in the \"Authorization: Bearer\" header."
+	doc.Components.SecuritySchemes[apiSecurity] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-SESSION-TOKEN",
+		Description: "The token returned by POST /auth.",
+	}
+	doc.Components.SecuritySchemes[apiTokenSecurity] = &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "A personal API token, created on the profile page. It may only call the operations of its scopes.",
+	}
+	return doc
+}
+
+// handle registers the handler of the route, behind the auth middleware if
+// the route needs a token, and documents it.
+func (api *apiRegistry) handle(r apiRoute, h golf.HandlerFunc) {
+	if r.Auth == authRequired {
+		h = golf.NewChain(api.auth(r.Scope)).Final(h)
+	}
+	for i, method := range append([]string{r.Method}, r.Aliases...) {
+		switch method {
+		case "GET":
+			api.app.Get(r.Path, h)
+		case "POST":
+			api.app.Post(r.Path, h)
+		case "PUT":
+			api.app.Put(r.Path, h)
+		case "PATCH":
+			api.app.Patch(r.Path, h)
+		case "DELETE":
+			api.app.Delete(r.Path, h)
+		}
+		op := api.operation(r)
+		if i > 0 {
+			op.OperationId += strings.Title(strings.ToLower(method))
+		}
+		api.doc.AddOperation(method, r.Path, op)
+	}
+	api.routes[r.Method][r.Name+"_url"] = r.Path
+}
+
+// operation returns the OpenAPI operation of the route.
+func (api *apiRegistry) operation(r apiRoute) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationId: operationId(r.Name),
+		Summary:     r.Summary,
+		Tags:        []string{r.Tag},
+		Responses:   make(map[string]*openapi.Response),
+	}
+	for _, name := range openapi.PathParams(r.Path) {
+		s := openapi.String()
+		if strings.HasSuffix(name, "_id") {
+			s = openapi.Integer()
+		}
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: name, In: "path", Required: true, Schema: s})
+	}
+	op.Parameters = append(op.Parameters, r.Query...)
+	if r.Body != nil {
+		types := r.BodyTypes
+		if len(types) == 0 {
+			types = []string{"application/json"}
+		}
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: make(map[string]*openapi.MediaType)}
+		for _, t := range types {
+			op.RequestBody.Content[t] = &openapi.MediaType{Schema: r.Body}
+		}
+	}
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	op.Responses[strconv.Itoa(status)] = apiResponse(status, r.Response)
+	if r.Created {
+		op.Responses[strconv.Itoa(http.StatusCreated)] = apiResponse(http.StatusCreated, r.Response)
+	}
+	for _, code := range r.Errors {
+		op.Responses[strconv.Itoa(code)] = apiResponse(code, api.errors)
+	}
+	if r.Auth == authNone {
+		return op
+	}
+	if r.Auth == authOptional {
+		op.Security = append(op.Security, map[string][]string{})
+	}
+	op.Security = append(op.Security, map[string][]string{apiSecurity: {}})
+	if r.Scope != "" {
+		op.Security = append(op.Security, map[string][]string{apiTokenSecurity: {}})
+		op.Description = "Personal API tokens need the " + r.Scope + " scope."
+		if r.Auth == authOptional {
+			op.Description = "Personal API tokens need the " + r.Scope + " scope to see more than the public content."
+		}
+		op.Responses[strconv.Itoa(http.StatusForbidden)] = apiResponse(http.StatusForbidden, api.authError)
+	}
+	if r.Auth == authRequired {
+		op.Responses[strconv.Itoa(http.StatusUnauthorized)] = apiResponse(http.StatusUnauthorized, api.authError)
+	}
+	return op
+}
+
+func apiResponse(status int, body *openapi.Schema) *openapi.Response {
+	resp := &openapi.Response{Description: http.StatusText(status)}
+	if body != nil {
+		resp.Content = map[string]*openapi.MediaType{"application/json": {Schema: body}}
+	}
+	return resp
+}
+
+// operationId turns the name of a route, such as "post_tag_string", into an
+// operation ID, such as "postTagString".
+func operationId(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.Title(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+// apiQuery returns a query parameter of the given schema.
+func apiQuery(name, description string, s *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+// apiv1Body returns the schema of the envelope of the responses of the API v1
+// holding the given data.
+func apiv1Body(doc *openapi.Document, data *openapi.Schema) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"data":   data,
+		"status": doc.SchemaOf(APIStatusJSON{}),
+	}, "data", "status")
+}
+
+// apiv1ErrorSchema returns the schema of the errors of the API v1, which are
+// sent either by handleErr or in the envelope with an error status.
+func apiv1ErrorSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("APIv1Error", openapi.Object(map[string]*openapi.Schema{
+		"statusCode": openapi.Integer(),
+		"error":      openapi.String(),
+		"status":     openapi.Any(),
+		"data":       openapi.Any(),
+	}).Describe("Either the status code and the message of the error, or the envelope with an error status."))
+}
+
+// apiv2Body returns the schema of the envelope of the responses of the API v2
+// holding the given data.
+func apiv2Body(data *openapi.Schema) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{"data": data}, "data")
+}
+
+// apiv2ListBody returns the schema of a page of a list of the API v2.
+func apiv2ListBody(doc *openapi.Document, item *openapi.Schema) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"data": openapi.ArrayOf(item),
+		"meta": doc.SchemaOf(APIv2Meta{}),
+	}, "data", "meta")
+}
+
+// apiv2ErrorSchema returns the schema of the errors of the API v2.
+func apiv2ErrorSchema(doc *openapi.Document) *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{"error": doc.SchemaOf(APIv2Error{})}, "error")
+}
+
+// apiv2ListParams returns the parameters of the lists of the given table,
+// which can be sorted by the keys of model.SortKeys.
+func apiv2ListParams(table string) []*openapi.Parameter {
+	var sorts []string
+	for _, k := range model.SortKeys(table) {
+		sorts = append(sorts, k, "-"+k)
+	}
+	limit := openapi.Integer()
+	limit.Format = "int32"
+	return []*openapi.Parameter{
+		apiQuery("limit", "The size of the page, "+strconv.Itoa(apiv2DefaultLimit)+" by default and at most "+strconv.Itoa(apiv2MaxLimit)+".", limit),
+		apiQuery("cursor", "The next_cursor of the previous page.", openapi.String()),
+		apiQuery("sort", "The sort key, prefixed by \"-\" to sort in descending order.", openapi.Enum(sorts...)),
+		apiv2FieldsParam(),
+	}
+}
+
+// apiv2FieldsParam returns the parameter of the sparse fieldsets.
+func apiv2FieldsParam() *openapi.Parameter {
+	return apiQuery("fields", "The fields to send, separated by commas, such as \"id,title,url\".", openapi.String())
+}
+
+// OpenAPIHandler serves the OpenAPI document of the API.
+func OpenAPIHandler(doc *openapi.Document) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		ctx.SetHeader("Access-Control-Allow-Origin", "*")
+		ctx.JSONIndent(doc, "", "  ")
+	}
+}
+
+// APIDocsHandler shows the interactive documentation of the API, made from
+// its OpenAPI document.
+func APIDocsHandler(ctx *golf.Context) {
+	ctx.Loader("admin").Render("api_docs.html", map[string]interface{}{
+		"SpecUrl": "/api/openapi.json",
+	})
+}
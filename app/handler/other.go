@@ -11,5 +11,6 @@ func NotFoundHandler(ctx *golf.Context, data ...map[string]interface{}) {
 	} else {
 		renderData = data[0]
 	}
+	renderData["Robots"] = "noindex"
 	ctx.Loader("theme").Render("404.html", renderData)
 }
@@ -7,53 +7,117 @@ import (
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
 	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
-func registerPostHandlers(app *golf.Application, routes map[string]map[string]interface{}) {
-	adminChain := golf.NewChain(JWTAuthMiddleware)
-	app.Get("/api/posts", APIPostsHandler(0, 10))
-	routes["GET"]["posts_url"] = "/api/posts"
+func registerPostHandlers(api *apiRegistry) {
+	post := api.doc.SchemaOf(model.Post{})
+	// Post.MarshalJSON adds the URL of the post to its fields.
+	api.doc.Components.Schemas["Post"].Properties["Url"] = openapi.String()
+	api.handle(apiRoute{
+		Name: "posts", Method: "GET", Path: "/api/posts", Tag: "posts",
+		Summary: "List the posts, starting at offset",
+		Query: []*openapi.Parameter{
+			apiQuery("offset", "The number of posts to skip, 0 by default.", openapi.Integer()),
+			apiQuery("limit", "The maximum number of posts, 10 by default.", openapi.Integer()),
+			apiQuery("published", "Only the published posts if true, only the drafts if false.", openapi.Boolean()),
+		},
+		Response: apiv1Body(api.doc, openapi.ArrayOf(post)),
+		Errors:   []int{http.StatusBadRequest},
+	}, APIPostsHandler(0, 10))
 
-	app.Get("/api/posts/:post_id", APIPostHandler)
-	routes["GET"]["post_url"] = "/api/posts/:post_id"
+	api.handle(apiRoute{
+		Name: "post", Method: "GET", Path: "/api/posts/:post_id", Tag: "posts",
+		Summary:  "Get a post by ID",
+		Response: apiv1Body(api.doc, post),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostHandler)
 
-	app.Get("/api/posts/slug/:slug", APIPostSlugHandler)
-	routes["GET"]["post_slug_url"] = "/api/posts/slug/:slug"
+	api.handle(apiRoute{
+		Name: "post_slug", Method: "GET", Path: "/api/posts/slug/:slug", Tag: "posts",
+		Summary:  "Get a post by slug",
+		Response: apiv1Body(api.doc, post),
+		Errors:   []int{http.StatusNotFound},
+	}, APIPostSlugHandler)
 
-	app.Get("/api/posts/:post_id/author", APIPostAuthorHandler)
-	routes["GET"]["post_author_url"] = "/api/posts/:post_id/author"
+	api.handle(apiRoute{
+		Name: "post_author", Method: "GET", Path: "/api/posts/:post_id/author", Tag: "posts",
+		Summary:  "Get the author of a post",
+		Response: apiv1Body(api.doc, api.doc.SchemaOf(model.User{})),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostAuthorHandler)
 
-	app.Get("/api/posts/:post_id/excerpt", APIPostExcerptHandler)
-	routes["GET"]["post_excerpt_url"] = "/api/posts/:post_id/excerpt"
+	api.handle(apiRoute{
+		Name: "post_excerpt", Method: "GET", Path: "/api/posts/:post_id/excerpt", Tag: "posts",
+		Summary:  "Get the excerpt of a post",
+		Response: apiv1Body(api.doc, openapi.String()),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostExcerptHandler)
 
-	app.Get("/api/posts/:post_id/summary", APIPostSummaryHandler)
-	routes["GET"]["post_summary_url"] = "/api/posts/:post_id/summary"
+	api.handle(apiRoute{
+		Name: "post_summary", Method: "GET", Path: "/api/posts/:post_id/summary", Tag: "posts",
+		Summary:  "Get the summary of a post",
+		Response: apiv1Body(api.doc, openapi.String()),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostSummaryHandler)
 
-	app.Get("/api/posts/:post_id/tag_string", APIPostTagStringHandler)
-	routes["GET"]["post_tag_string_url"] = "/api/posts/:post_id/tag_string"
+	api.handle(apiRoute{
+		Name: "post_tag_string", Method: "GET", Path: "/api/posts/:post_id/tag_string", Tag: "posts",
+		Summary:  "Get the tags of a post, separated by commas",
+		Response: apiv1Body(api.doc, openapi.String()),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostTagStringHandler)
 
-	app.Get("/api/posts/:post_id/tags", APIPostTagsHandler)
-	routes["GET"]["post_tags_url"] = "/api/posts/:post_id/tags"
+	api.handle(apiRoute{
+		Name: "post_tags", Method: "GET", Path: "/api/posts/:post_id/tags", Tag: "posts",
+		Summary:  "Get the tags of a post",
+		Response: apiv1Body(api.doc, api.doc.SchemaOf(model.Tags{})),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostTagsHandler)
 
-	app.Put("/api/posts", adminChain.Final(APIPostSaveHandler))
-	routes["PUT"]["post_save_url"] = "/api/posts"
+	api.handle(apiRoute{
+		Name: "post_toc", Method: "GET", Path: "/api/posts/:post_id/toc", Tag: "posts",
+		Summary:  "Get the table of contents of a post",
+		Response: apiv1Body(api.doc, api.doc.SchemaOf(model.Outline{})),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIPostTOCHandler)
 
-	app.Post("/api/posts/:post_id/publish", adminChain.Final(APIPostPublishHandler))
-	routes["POST"]["post_publish_url"] = "/api/posts/:post_id/publish"
+	api.handle(apiRoute{
+		Name: "post_save", Method: "PUT", Path: "/api/posts", Tag: "posts",
+		Summary:  "Save a post",
+		Auth:     authRequired,
+		Scope:    model.ScopePostsWrite,
+		Body:     post,
+		Response: apiv1Body(api.doc, post),
+		Errors:   []int{http.StatusInternalServerError},
+	}, APIPostSaveHandler)
 
-	app.Delete("/api/posts/:post_id", adminChain.Final(APIPostDeleteHandler))
-	routes["DELETE"]["post_delete_url"] = "/api/posts/:post_id"
+	api.handle(apiRoute{
+		Name: "post_publish", Method: "POST", Path: "/api/posts/:post_id/publish", Tag: "posts",
+		Summary:  "Publish a post",
+		Auth:     authRequired,
+		Scope:    model.ScopePostsWrite,
+		Response: apiv1Body(api.doc, post),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	}, APIPostPublishHandler)
+
+	api.handle(apiRoute{
+		Name: "post_delete", Method: "DELETE", Path: "/api/posts/:post_id", Tag: "posts",
+		Summary: "Delete a post",
+		Auth:    authRequired,
+		Scope:   model.ScopePostsWrite,
+		Errors:  []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	}, APIPostDeleteHandler)
 }
 
 func getPostFromContext(ctx *golf.Context, param ...string) (post *model.Post) {
 	post = new(model.Post)
 	if len(param) == 0 {
-		for _, p := range []string{"post_id", "slug"} {
-			post = getPostFromContext(ctx, p)
-			if post != nil {
-				return post
-			}
+		if ctx.Param("post_id") != "" {
+			param = []string{"post_id"}
+		} else {
+			param = []string{"slug"}
 		}
 	}
 	var err error
@@ -61,7 +125,7 @@ func getPostFromContext(ctx *golf.Context, param ...string) (post *model.Post) {
 	case "post_id":
 		id, convErr := strconv.Atoi(ctx.Param("post_id"))
 		if convErr != nil {
-			handleErr(ctx, 500, convErr)
+			handleErr(ctx, 400, convErr)
 			return nil
 		}
 		err = post.GetPostById(int64(id))
@@ -79,12 +143,18 @@ func getPostFromContext(ctx *golf.Context, param ...string) (post *model.Post) {
 // APIPostHandler retrieves the post with the given ID.
 func APIPostHandler(ctx *golf.Context) {
 	post := getPostFromContext(ctx, "post_id")
+	if post == nil {
+		return
+	}
 	ctx.JSON(NewAPISuccessResponse(post))
 }
 
 // APIPostSlugHandler retrieves the post with the given slug.
 func APIPostSlugHandler(ctx *golf.Context) {
 	post := getPostFromContext(ctx, "slug")
+	if post == nil {
+		return
+	}
 	ctx.JSON(NewAPISuccessResponse(post))
 }
 
@@ -186,6 +256,15 @@ func APIPostTagsHandler(ctx *golf.Context) {
 	ctx.JSON(NewAPISuccessResponse(tags))
 }
 
+// APIPostTOCHandler gets the table of contents of the given post.
+func APIPostTOCHandler(ctx *golf.Context) {
+	post := getPostFromContext(ctx)
+	if post == nil {
+		return
+	}
+	ctx.JSON(NewAPISuccessResponse(post.TOC))
+}
+
 // APIPostSaveHandler saves the post given in the json-formatted request body.
 func APIPostSaveHandler(ctx *golf.Context) {
 	token, err := ctx.Session.Get("jwt")
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// RedirectViewHandler lists the redirect rules and the slug history of the
+// posts.
+func RedirectViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	rules := new(model.Redirects)
+	if err := rules.GetRedirectRules(); err != nil {
+		ctx.Abort(500)
+		return
+	}
+	history := new(model.Redirects)
+	if err := history.GetSlugHistory(); err != nil {
+		ctx.Abort(500)
+		return
+	}
+	ctx.Loader("admin").Render("redirects.html", map[string]interface{}{
+		"Title":   "重定向",
+		"User":    user,
+		"Rules":   rules,
+		"History": history,
+	})
+}
+
+// RedirectSaveHandler adds a redirect rule, matching either the exact source
+// path or, if "prefix" is set, every path starting with it.
+func RedirectSaveHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	r := model.NewRedirect(ctx.Request.FormValue("source"), ctx.Request.FormValue("target"), ctx.Request.FormValue("prefix") == "on")
+	r.CreatedBy = u.Id
+	if err := r.Save(); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// RedirectRemoveHandler deletes a redirect rule or a slug history entry.
+func RedirectRemoveHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	if err := model.DeleteRedirectById(int64(id)); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
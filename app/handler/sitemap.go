@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/sitemap"
+)
+
+// SitemapIndexHandler serves the sitemap index, which lists the sitemaps of
+// the posts, pages, tags and authors.
+func SitemapIndexHandler(ctx *golf.Context) {
+	sitemaps, err := buildSitemaps()
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+	b, err := sitemap.Index(sitemaps, sitemapUrl)
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+	ctx.SetHeader("Content-Type", "application/xml; charset=utf-8")
+	ctx.Send(b)
+}
+
+// SitemapHandler serves a single sitemap listed in the sitemap index.
+func SitemapHandler(ctx *golf.Context) {
+	name := strings.TrimSuffix(ctx.Param("name"), ".xml")
+	sitemaps, err := buildSitemaps()
+	if err != nil {
+		ctx.Abort(500)
+		return
+	}
+	for _, s := range sitemaps {
+		if s.Name == name {
+			ctx.SetHeader("Content-Type", "application/xml; charset=utf-8")
+			ctx.Send(s.XML())
+			return
+		}
+	}
+	ctx.Abort(404)
+}
+
+// RobotsHandler serves robots.txt, which keeps crawlers out of the admin and
+// points them to the sitemap index.
+func RobotsHandler(ctx *golf.Context) {
+	ctx.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	ctx.Send("User-agent: *\n" +
+		"Disallow: /admin/\n" +
+		"Disallow: /login/\n" +
+		"Disallow: /signup/\n" +
+		"\n" +
+		"Sitemap: " + model.SiteUrl("/sitemap.xml") + "\n")
+}
+
+func sitemapUrl(s *sitemap.Sitemap) string {
+	return model.SiteUrl("/sitemaps/" + s.Name + ".xml")
+}
+
+// buildSitemaps collects every published post and page, every tag in use and
+// every author with published posts.
+func buildSitemaps() ([]*sitemap.Sitemap, error) {
+	posts := new(model.Posts)
+	if err := posts.GetAllPostList(false, true, "published_at DESC"); err != nil {
+		return nil, err
+	}
+	pages := new(model.Posts)
+	if err := pages.GetAllPostList(true, true, "published_at DESC"); err != nil {
+		return nil, err
+	}
+
+	var latest *time.Time
+	authors := make(map[int64]*time.Time)
+	postUrls := make([]*sitemap.URL, 0, len(*posts))
+	for _, p := range *posts {
+		u := postSitemapUrl(p, "monthly", 0.8)
+		postUrls = append(postUrls, u)
+		if u.LastMod != nil {
+			if latest == nil || u.LastMod.After(*latest) {
+				latest = u.LastMod
+			}
+			if last := authors[p.CreatedBy]; last == nil || u.LastMod.After(*last) {
+				authors[p.CreatedBy] = u.LastMod
+			}
+		} else if _, ok := authors[p.CreatedBy]; !ok {
+			authors[p.CreatedBy] = nil
+		}
+	}
+
+	pageUrls := []*sitemap.URL{{Loc: model.SiteUrl("/"), LastMod: latest, ChangeFreq: "daily", Priority: 1.0}}
+	for _, p := range *pages {
+		pageUrls = append(pageUrls, postSitemapUrl(p, "monthly", 0.6))
+	}
+	for _, n := range model.GetNavigators() {
+		// Navigation links to posts and pages are already listed.
+		if !strings.HasPrefix(n.Url, "/") || strings.HasPrefix(n.Url, "//") || n.Url == "/" {
+			continue
+		}
+		post := new(model.Post)
+		if post.GetPostBySlug(strings.Trim(n.Url, "/")) == nil {
+			continue
+		}
+		pageUrls = append(pageUrls, &sitemap.URL{Loc: model.SiteUrl(n.Url), ChangeFreq: "weekly", Priority: 0.5})
+	}
+
+	tags := new(model.Tags)
+	if err := tags.GetAllTags(); err != nil {
+		return nil, err
+	}
+	tagsLastMod, err := model.GetTagsLastModified()
+	if err != nil {
+		return nil, err
+	}
+	tagUrls := make([]*sitemap.URL, 0)
+	for _, t := range *tags {
+		last, ok := tagsLastMod[t.Id]
+		if !ok || t.Hidden {
+			continue
+		}
+		tagUrls = append(tagUrls, &sitemap.URL{Loc: model.SiteUrl(t.Url() + "/"), LastMod: &last, ChangeFreq: "weekly", Priority: 0.4})
+	}
+
+	ids := make([]int64, 0, len(authors))
+	for id := range authors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	authorUrls := make([]*sitemap.URL, 0)
+	for _, id := range ids {
+		last := authors[id]
+		u := &model.User{Id: id}
+		if u.GetUserById() != nil {
+			continue
+		}
+		authorUrls = append(authorUrls, &sitemap.URL{Loc: model.SiteUrl("/author/" + u.Slug + "/"), LastMod: last, ChangeFreq: "weekly", Priority: 0.3})
+	}
+
+	result := make([]*sitemap.Sitemap, 0)
+	for _, group := range []struct {
+		name string
+		urls []*sitemap.URL
+	}{
+		{"pages", pageUrls},
+		{"posts", postUrls},
+		{"tags", tagUrls},
+		{"authors", authorUrls},
+	} {
+		sitemaps, err := sitemap.Split(group.name, group.urls)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sitemaps...)
+	}
+	return result, nil
+}
+
+func postSitemapUrl(p *model.Post, changeFreq string, priority float64) *sitemap.URL {
+	u := &sitemap.URL{
+		Loc:        model.SiteUrl(p.Url() + "/"),
+		LastMod:    p.UpdatedAt,
+		ChangeFreq: changeFreq,
+		Priority:   priority,
+	}
+	if u.LastMod == nil {
+		u.LastMod = p.PublishedAt
+	}
+	if p.Image != "" {
+		u.Images = []string{model.AbsoluteUrl(p.Image)}
+	}
+	return u
+}
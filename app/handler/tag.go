@@ -1,28 +1,42 @@
 package handler
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
 )
 
-func registerTagHandlers(app *golf.Application, routes map[string]map[string]interface{}) {
-	app.Get("/api/tags", APITagsHandler)
-	routes["GET"]["tags_url"] = "/api/tags"
+func registerTagHandlers(api *apiRegistry) {
+	tag := api.doc.SchemaOf(model.Tag{})
+	api.handle(apiRoute{
+		Name: "tags", Method: "GET", Path: "/api/tags", Tag: "tags",
+		Summary:  "List the tags",
+		Response: api.doc.SchemaOf(model.Tags{}),
+		Errors:   []int{http.StatusNotFound},
+	}, APITagsHandler)
 
-	app.Get("/api/tags/:tag_id", APITagHandler)
-	routes["GET"]["tag_url"] = "/api/tags/:tag_id"
+	api.handle(apiRoute{
+		Name: "tag", Method: "GET", Path: "/api/tags/:tag_id", Tag: "tags",
+		Summary:  "Get a tag by ID",
+		Response: tag,
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APITagHandler)
 
-	app.Get("/api/tags/slug/:slug", APITagSlugHandler)
-	routes["GET"]["tag_slug_url"] = "/api/tags/:slug"
+	api.handle(apiRoute{
+		Name: "tag_slug", Method: "GET", Path: "/api/tags/slug/:slug", Tag: "tags",
+		Summary:  "Get a tag by slug",
+		Response: tag,
+		Errors:   []int{http.StatusNotFound},
+	}, APITagSlugHandler)
 }
 
 // APITagHandler retrieves the tag with the given id.
 func APITagHandler(ctx *golf.Context) {
 	id, err := strconv.Atoi(ctx.Param("tag_id"))
 	if err != nil {
-		handleErr(ctx, 500, err)
+		handleErr(ctx, 400, err)
 		return
 	}
 	tag := &model.Tag{Id: int64(id)}
@@ -39,7 +53,7 @@ func APITagsHandler(ctx *golf.Context) {
 	tags := new(model.Tags)
 	err := tags.GetAllTags()
 	if err != nil {
-		handleErr(ctx, 404, err)
+		handleErr(ctx, 500, err)
 		return
 	}
 	ctx.JSONIndent(tags, "", "  ")
@@ -51,7 +65,7 @@ func APITagSlugHandler(ctx *golf.Context) {
 	tags := &model.Tag{Slug: slug}
 	err := tags.GetTagBySlug()
 	if err != nil {
-		handleErr(ctx, 500, err)
+		handleErr(ctx, 404, err)
 		return
 	}
 	ctx.JSONIndent(tags, "", "  ")
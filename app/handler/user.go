@@ -1,31 +1,66 @@
 package handler
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/dinever/golf"
 	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
-func registerUserHandlers(app *golf.Application, routes map[string]map[string]interface{}) {
-	app.Get("/api/users", APIUsersHandler)
-	routes["GET"]["users_url"] = "/api/users"
+func registerUserHandlers(api *apiRegistry) {
+	user := api.doc.SchemaOf(model.User{})
+	api.handle(apiRoute{
+		Name: "users", Method: "GET", Path: "/api/users", Tag: "users",
+		Summary:  "List the users",
+		Auth:     authRequired,
+		Response: openapi.ArrayOf(user),
+		Errors:   []int{http.StatusInternalServerError},
+	}, APIUsersHandler)
 
-	app.Get("/api/users/:user_id", APIUserHandler)
-	routes["GET"]["user_url"] = "/api/users/:user_id"
+	api.handle(apiRoute{
+		Name: "user", Method: "GET", Path: "/api/users/:user_id", Tag: "users",
+		Summary:  "Get a user by ID",
+		Response: user,
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIUserHandler)
 
-	app.Get("/api/users/slug/:slug", APIUserSlugHandler)
-	routes["GET"]["user_slug_url"] = "/api/users/slug/:slug"
+	api.handle(apiRoute{
+		Name: "user_posts", Method: "GET", Path: "/api/users/:user_id/posts", Tag: "users",
+		Summary: "List the published posts of a user, as on their author page",
+		Query: []*openapi.Parameter{
+			apiQuery("page", "The page, starting at 1.", openapi.Integer()),
+		},
+		Response: apiv1Body(api.doc, openapi.Object(map[string]*openapi.Schema{
+			"author": openapi.String().Describe("The URL of the author page."),
+			"posts":  api.doc.SchemaOf(model.Posts{}),
+			"pager":  api.doc.SchemaOf(utils.Pager{}),
+		})),
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+	}, APIUserPostsHandler)
 
-	app.Get("/api/users/email/:email", APIUserEmailHandler)
-	routes["GET"]["user_email_url"] = "/api/users/email/:email"
+	api.handle(apiRoute{
+		Name: "user_slug", Method: "GET", Path: "/api/users/slug/:slug", Tag: "users",
+		Summary:  "Get a user by slug",
+		Response: user,
+		Errors:   []int{http.StatusNotFound},
+	}, APIUserSlugHandler)
+
+	api.handle(apiRoute{
+		Name: "user_email", Method: "GET", Path: "/api/users/email/:email", Tag: "users",
+		Summary:  "Get a user by email",
+		Response: user,
+		Errors:   []int{http.StatusNotFound},
+	}, APIUserEmailHandler)
 }
 
 // APIUserHandler retrieves the user with the given id.
 func APIUserHandler(ctx *golf.Context) {
 	id, err := strconv.Atoi(ctx.Param("user_id"))
 	if err != nil {
-		handleErr(ctx, 500, err)
+		handleErr(ctx, 400, err)
 		return
 	}
 	user := &model.User{Id: int64(id)}
@@ -37,6 +72,37 @@ func APIUserHandler(ctx *golf.Context) {
 	ctx.JSONIndent(user, "", "  ")
 }
 
+// APIUserPostsHandler retrieves a page of the published posts by the user with
+// the given id, as shown on their author page.
+func APIUserPostsHandler(ctx *golf.Context) {
+	id, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		handleErr(ctx, 400, err)
+		return
+	}
+	user := &model.User{Id: int64(id)}
+	err = user.GetUserById()
+	if err != nil {
+		handleErr(ctx, 404, err)
+		return
+	}
+	page, _ := strconv.ParseInt(ctx.Request.FormValue("page"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	posts := new(model.Posts)
+	pager, err := posts.GetPostsByAuthor(user.Id, page, authorPageSize, true)
+	if err != nil {
+		handleErr(ctx, 404, err)
+		return
+	}
+	ctx.JSON(NewAPISuccessResponse(map[string]interface{}{
+		"author": user.Url() + "/",
+		"posts":  posts,
+		"pager":  pager,
+	}))
+}
+
 // APIUserSlugHandler retrives the user with the given slug.
 func APIUserSlugHandler(ctx *golf.Context) {
 	slug := ctx.Param("slug")
@@ -61,9 +127,14 @@ func APIUserEmailHandler(ctx *golf.Context) {
 	ctx.JSONIndent(user, "", "  ")
 }
 
-// APIUsersHandler retrieves all users.
+// APIUsersHandler retrieves all users. It needs a session token, as the users
+// are sent with their email addresses.
 func APIUsersHandler(ctx *golf.Context) {
-	ctx.JSONIndent(map[string]interface{}{
-		"message": "Not implemented",
-	}, "", "  ")
+	users := new(model.Users)
+	err := users.GetAllUsers()
+	if err != nil {
+		handleErr(ctx, 500, err)
+		return
+	}
+	ctx.JSONIndent(users, "", "  ")
 }
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// The sizes of the pages of the lists of the API v2.
+const (
+	apiv2DefaultLimit = 20
+	apiv2MaxLimit     = 100
+)
+
+// An APIv2Body is the envelope of every response of the API v2: either the
+// data, along with the pagination of lists, or the error.
+type APIv2Body struct {
+	Data  interface{} `json:"data,omitempty"`
+	Meta  *APIv2Meta  `json:"meta,omitempty"`
+	Error *APIv2Error `json:"error,omitempty"`
+}
+
+// An APIv2Meta describes a page of a list. The next page is found by passing
+// NextCursor as the "cursor" parameter, or by following Next.
+type APIv2Meta struct {
+	Count      int    `json:"count"`
+	Limit      int    `json:"limit,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+}
+
+// An APIv2Error is an error of the API v2. Its code is made from the HTTP
+// status, such as "not_found" or "unprocessable_entity".
+type APIv2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func registerAPIv2Handlers(api *apiRegistry) {
+	registerAPIv2PostHandlers(api)
+	registerAPIv2TagHandlers(api)
+	registerAPIv2CommentHandlers(api)
+	registerAPIv2UserHandlers(api)
+	registerAPIv2SettingHandlers(api)
+	registerAPIv2MediaHandlers(api)
+}
+
+func apiv2Send(ctx *golf.Context, status int, body APIv2Body) {
+	ctx.SendStatus(status)
+	ctx.JSON(body)
+}
+
+// apiv2Data sends the data with the given status code.
+func apiv2Data(ctx *golf.Context, status int, data interface{}) {
+	apiv2Send(ctx, status, APIv2Body{Data: data})
+}
+
+// apiv2Created sends a resource created at the given API URL.
+func apiv2Created(ctx *golf.Context, url string, data interface{}) {
+	ctx.SetHeader("Location", url)
+	apiv2Data(ctx, http.StatusCreated, data)
+}
+
+// apiv2NoContent answers a request which has nothing to send back, such as a
+// deletion.
+func apiv2NoContent(ctx *golf.Context) {
+	ctx.SendStatus(http.StatusNoContent)
+	ctx.Send("")
+}
+
+// apiv2Error sends the error with the given status code.
+func apiv2Error(ctx *golf.Context, status int, err error) {
+	code := strings.ToLower(strings.Replace(http.StatusText(status), " ", "_", -1))
+	apiv2Send(ctx, status, APIv2Body{Error: &APIv2Error{Status: status, Code: code, Message: err.Error()}})
+}
+
+// apiv2ListError sends the error of listing a page, which is the client's
+// fault if it asked for an unknown sort key.
+func apiv2ListError(ctx *golf.Context, err error) {
+	if _, ok := err.(model.SortError); ok {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	apiv2Error(ctx, http.StatusInternalServerError, err)
+}
+
+// apiv2List sends a page of a list, linking to the next page if there is one.
+func apiv2List(ctx *golf.Context, items []map[string]interface{}, q *model.ListQuery, next *model.Cursor) {
+	meta := &APIv2Meta{Count: len(items), Limit: q.Limit}
+	if next != nil {
+		meta.NextCursor = next.String()
+		u := *ctx.Request.URL
+		v := u.Query()
+		v.Set("cursor", meta.NextCursor)
+		u.RawQuery = v.Encode()
+		meta.Next = u.RequestURI()
+	}
+	apiv2Send(ctx, http.StatusOK, APIv2Body{Data: items, Meta: meta})
+}
+
+// apiv2ListQuery reads the pagination and sorting parameters of a list:
+// "limit", "cursor", and "sort", which is a sort key prefixed by "-" to sort
+// in descending order.
+func apiv2ListQuery(ctx *golf.Context, defaultSort string) (*model.ListQuery, error) {
+	q := &model.ListQuery{Limit: apiv2DefaultLimit}
+	if s := ctx.Request.FormValue("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > apiv2MaxLimit {
+			return nil, fmt.Errorf("The limit must be between 1 and %d.", apiv2MaxLimit)
+		}
+		q.Limit = limit
+	}
+	if s := ctx.Request.FormValue("cursor"); s != "" {
+		c, err := model.ParseCursor(s)
+		if err != nil {
+			return nil, err
+		}
+		q.After = c
+	}
+	sort := ctx.Request.FormValue("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	q.Desc = strings.HasPrefix(sort, "-")
+	q.Sort = strings.TrimPrefix(sort, "-")
+	return q, nil
+}
+
+// A fieldSet is the sparse fieldset asked for by the "fields" parameter, as in
+// "fields=id,title,url". A nil fieldSet has every field.
+type fieldSet map[string]bool
+
+func apiv2Fields(ctx *golf.Context) fieldSet {
+	s := ctx.Request.FormValue("fields")
+	if s == "" {
+		return nil
+	}
+	f := make(fieldSet)
+	for _, name := range strings.Split(s, ",") {
+		f[strings.TrimSpace(name)] = true
+	}
+	return f
+}
+
+// has returns whether the field is asked for, so that the fields which need
+// more queries are only looked up when needed.
+func (f fieldSet) has(name string) bool {
+	return f == nil || f[name]
+}
+
+// pick returns the fields of the resource which are asked for.
+func (f fieldSet) pick(r map[string]interface{}) map[string]interface{} {
+	if f == nil {
+		return r
+	}
+	for name := range r {
+		if !f[name] {
+			delete(r, name)
+		}
+	}
+	return r
+}
+
+// apiv2Allowed returns whether the request has a valid token allowed the
+// given scope. Reading public content needs no token.
+func apiv2Allowed(ctx *golf.Context, scope string) bool {
+	token, ok := apiRequestToken(ctx)
+	return ok && token.Allows(scope)
+}
+
+// apiv2Authorize checks that the request has a valid token allowed the given
+// scope, and sends the error otherwise.
+func apiv2Authorize(ctx *golf.Context, scope string) (model.JWT, bool) {
+	token, ok := apiRequestToken(ctx)
+	return token, apiv2AuthorizeToken(ctx, token, ok, scope)
+}
+
+// apiv2AuthorizeToken checks that the token of the request, if ok, is allowed
+// the given scope, and sends the error otherwise.
+func apiv2AuthorizeToken(ctx *golf.Context, token model.JWT, ok bool, scope string) bool {
+	if !ok {
+		apiv2Error(ctx, http.StatusUnauthorized, errAPIToken)
+		return false
+	}
+	if !token.Allows(scope) {
+		apiv2Error(ctx, http.StatusForbidden, apiScopeError(scope))
+		return false
+	}
+	return true
+}
+
+// APIv2ScopeMiddleware is JWTScopeMiddleware for the API v2: it answers the
+// requests it refuses in the envelope of the API v2.
+func APIv2ScopeMiddleware(scope string) golf.MiddlewareHandlerFunc {
+	return func(next golf.HandlerFunc) golf.HandlerFunc {
+		return func(ctx *golf.Context) {
+			if token, ok := apiv2Authorize(ctx, scope); ok {
+				ctx.Session.Set("jwt", token)
+				next(ctx)
+			}
+		}
+	}
+}
+
+// apiv2UserId returns the ID of the user authenticated by APIv2ScopeMiddleware.
+func apiv2UserId(ctx *golf.Context) int64 {
+	token, err := ctx.Session.Get("jwt")
+	if err != nil {
+		return 0
+	}
+	return token.(model.JWT).UserID
+}
+
+// apiv2Decode reads the JSON body of the request into v.
+func apiv2Decode(ctx *golf.Context, v interface{}) error {
+	defer ctx.Request.Body.Close()
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// apiv2Id reads the numeric ID in the given URL parameter. It returns false if
+// the parameter isn't a number, such as a slug.
+func apiv2Id(ctx *golf.Context, param string) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param(param), 10, 64)
+	return id, err == nil
+}
+
+// apiv2Time formats a time of a resource, which may be unset.
+func apiv2Time(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// apiv2Date parses a date of a filter, either as RFC 3339 or as a day. The end
+// of a date range is exclusive, so a day at its end is included whole.
+func apiv2Date(s string, end bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid date: %s", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+)
+
+func registerAPIv2CommentHandlers(api *apiRegistry) {
+	comment := apiv2CommentSchema(api.doc)
+	body := api.doc.Define("CommentInputV2", apiv2CommentBody{})
+	api.handle(apiRoute{
+		Name: "v2_comments", Method: "GET", Path: "/api/v2/comments", Tag: "v2 comments",
+		Summary: "List the comments",
+		Auth:    authOptional,
+		Scope:   model.ScopeCommentsModerate,
+		Query: append(apiv2ListParams("comments"),
+			apiQuery("post", "The ID of a post.", openapi.Integer()),
+			apiQuery("status", "The pending comments and all need a token.", openapi.Enum("approved", "pending", "all")),
+		),
+		Response: apiv2ListBody(api.doc, comment),
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+	}, APIv2CommentsHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_comment", Method: "GET", Path: "/api/v2/comments/:id", Tag: "v2 comments",
+		Summary:  "Get a comment by ID",
+		Auth:     authOptional,
+		Scope:    model.ScopeCommentsModerate,
+		Query:    []*openapi.Parameter{apiv2FieldsParam()},
+		Response: apiv2Body(comment),
+		Errors:   []int{http.StatusNotFound},
+	}, APIv2CommentHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_comment_create", Method: "POST", Path: "/api/v2/comments", Tag: "v2 comments",
+		Summary:  "Create a comment",
+		Auth:     authRequired,
+		Scope:    model.ScopeCommentsModerate,
+		Body:     body,
+		Status:   http.StatusCreated,
+		Response: apiv2Body(comment),
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2CommentCreateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_comment_update", Method: "PATCH", Aliases: []string{"PUT"}, Path: "/api/v2/comments/:id", Tag: "v2 comments",
+		Summary:  "Update the given fields of a comment",
+		Auth:     authRequired,
+		Scope:    model.ScopeCommentsModerate,
+		Body:     body,
+		Response: apiv2Body(comment),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2CommentUpdateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_comment_delete", Method: "DELETE", Path: "/api/v2/comments/:id", Tag: "v2 comments",
+		Summary: "Delete a comment",
+		Auth:    authRequired,
+		Scope:   model.ScopeCommentsModerate,
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusNotFound, http.StatusInternalServerError},
+	}, APIv2CommentDeleteHandler)
+}
+
+// An apiv2CommentBody is the body of a request creating or updating a
+// comment. The fields left out are left unchanged.
+type apiv2CommentBody struct {
+	PostId  *int64  `json:"post_id"`
+	Parent  *int64  `json:"parent"`
+	Author  *string `json:"author"`
+	Email   *string `json:"email"`
+	Website *string `json:"website"`
+	Content *string `json:"content"`
+	Status  *string `json:"status"`
+}
+
+func (b *apiv2CommentBody) apply(c *model.Comment) error {
+	if b.PostId != nil {
+		c.PostId = *b.PostId
+	}
+	if b.Parent != nil {
+		c.Parent = *b.Parent
+	}
+	if b.Author != nil {
+		c.Author = strings.TrimSpace(*b.Author)
+	}
+	if b.Email != nil {
+		c.Email = strings.TrimSpace(*b.Email)
+	}
+	if b.Website != nil {
+		c.Website = strings.TrimSpace(*b.Website)
+	}
+	if b.Content != nil {
+		c.Content = *b.Content
+	}
+	if b.Status != nil {
+		switch *b.Status {
+		case "approved":
+			c.Approved = true
+		case "pending":
+			c.Approved = false
+		default:
+			return fmt.Errorf("The status must be \"approved\" or \"pending\".")
+		}
+	}
+	if msg := c.ValidateComment(); msg != "" {
+		return errors.New(msg)
+	}
+	if post := (&model.Post{Id: c.PostId}); post.GetPostById() != nil {
+		return fmt.Errorf("No such post: %d", c.PostId)
+	}
+	if c.Parent != 0 {
+		parent, err := c.ParentComment()
+		if err != nil || parent.PostId != c.PostId {
+			return fmt.Errorf("No such parent comment: %d", c.Parent)
+		}
+	}
+	return nil
+}
+
+// apiv2Comment returns the fields of the comment asked for. The email, IP and
+// user agent of the commenter are private.
+func apiv2Comment(c *model.Comment, private bool, f fieldSet) map[string]interface{} {
+	status := "pending"
+	if c.Approved {
+		status = "approved"
+	}
+	r := map[string]interface{}{
+		"id":         c.Id,
+		"post_id":    c.PostId,
+		"parent":     c.Parent,
+		"author":     c.Author,
+		"avatar":     c.Avatar,
+		"website":    c.Website,
+		"content":    c.Content,
+		"status":     status,
+		"created_at": apiv2Time(c.CreatedAt),
+	}
+	if private {
+		r["email"] = c.Email
+		r["ip"] = c.Ip
+		r["user_agent"] = c.UserAgent
+	}
+	return f.pick(r)
+}
+
+// apiv2CommentSchema returns the schema of the comments sent by apiv2Comment.
+func apiv2CommentSchema(doc *openapi.Document) *openapi.Schema {
+	private := "Only sent to the tokens allowed to moderate comments."
+	return doc.AddSchema("CommentV2", openapi.Object(map[string]*openapi.Schema{
+		"id":         openapi.Integer(),
+		"post_id":    openapi.Integer(),
+		"parent":     openapi.Integer(),
+		"author":     openapi.String(),
+		"avatar":     openapi.String(),
+		"website":    openapi.String(),
+		"content":    openapi.String(),
+		"status":     openapi.Enum("approved", "pending"),
+		"created_at": openapi.DateTime().OrNull(),
+		"email":      openapi.String().Describe(private),
+		"ip":         openapi.String().Describe(private),
+		"user_agent": openapi.String().Describe(private),
+	}))
+}
+
+// apiv2FindComment finds the comment with the ID in the URL. Pending comments
+// are only found with a token.
+func apiv2FindComment(ctx *golf.Context, withPending bool) *model.Comment {
+	c := new(model.Comment)
+	id, ok := apiv2Id(ctx, "id")
+	if ok {
+		c.Id = id
+	}
+	if !ok || c.GetCommentById() != nil || (!c.Approved && !withPending) {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such comment: %s", ctx.Param("id")))
+		return nil
+	}
+	return c
+}
+
+// APIv2CommentsHandler lists the comments, filtered by the "post" ID and the
+// "status" ("approved", "pending" or "all"). Pending comments are only listed
+// with a token allowed to moderate comments.
+func APIv2CommentsHandler(ctx *golf.Context) {
+	q, err := apiv2ListQuery(ctx, "-created_at")
+	if err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	private := apiv2Allowed(ctx, model.ScopeCommentsModerate)
+	f := model.CommentFilter{Status: "approved"}
+	switch status := ctx.Request.FormValue("status"); status {
+	case "", "approved":
+	case "pending", "all":
+		if _, ok := apiv2Authorize(ctx, model.ScopeCommentsModerate); !ok {
+			return
+		}
+		f.Status = status
+		if status == "all" {
+			f.Status = ""
+		}
+	default:
+		apiv2Error(ctx, http.StatusBadRequest, fmt.Errorf("Unknown status: %s", status))
+		return
+	}
+	if s := ctx.Request.FormValue("post"); s != "" {
+		if f.PostId, err = strconv.ParseInt(s, 10, 64); err != nil {
+			apiv2Error(ctx, http.StatusBadRequest, fmt.Errorf("Invalid post ID: %s", s))
+			return
+		}
+	}
+	comments := new(model.Comments)
+	next, err := comments.List(f, q)
+	if err != nil {
+		apiv2ListError(ctx, err)
+		return
+	}
+	fields := apiv2Fields(ctx)
+	items := make([]map[string]interface{}, len(*comments))
+	for i, c := range *comments {
+		items[i] = apiv2Comment(c, private, fields)
+	}
+	apiv2List(ctx, items, q, next)
+}
+
+// APIv2CommentHandler retrieves the comment with the given ID.
+func APIv2CommentHandler(ctx *golf.Context) {
+	private := apiv2Allowed(ctx, model.ScopeCommentsModerate)
+	if c := apiv2FindComment(ctx, private); c != nil {
+		apiv2Data(ctx, http.StatusOK, apiv2Comment(c, private, apiv2Fields(ctx)))
+	}
+}
+
+// APIv2CommentCreateHandler creates a comment from the JSON body, by default
+// approved and in the name of the user of the token.
+func APIv2CommentCreateHandler(ctx *golf.Context) {
+	var body apiv2CommentBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	c := model.NewComment()
+	c.Approved = true
+	c.Ip = ctx.ClientIP()
+	c.UserAgent = ctx.Header("User-Agent")
+	user := &model.User{Id: apiv2UserId(ctx)}
+	if user.GetUserById() == nil {
+		c.UserId = user.Id
+		c.Author = user.Name
+		c.Email = user.Email
+		c.Website = user.Website
+	}
+	if err := body.apply(c); err != nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err := c.Save(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Created(ctx, "/api/v2/comments/"+strconv.FormatInt(c.Id, 10), apiv2Comment(c, true, nil))
+}
+
+// APIv2CommentUpdateHandler updates the fields of the comment given in the
+// JSON body, such as its status to approve it.
+func APIv2CommentUpdateHandler(ctx *golf.Context) {
+	c := apiv2FindComment(ctx, true)
+	if c == nil {
+		return
+	}
+	var body apiv2CommentBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if err := body.apply(c); err != nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err := c.Save(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Data(ctx, http.StatusOK, apiv2Comment(c, true, nil))
+}
+
+// APIv2CommentDeleteHandler deletes the comment with the given ID.
+func APIv2CommentDeleteHandler(ctx *golf.Context) {
+	c := apiv2FindComment(ctx, true)
+	if c == nil {
+		return
+	}
+	if err := model.DeleteComment(c.Id); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2NoContent(ctx)
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+func registerAPIv2MediaHandlers(api *apiRegistry) {
+	media := apiv2MediaSchema(api.doc)
+	api.handle(apiRoute{
+		Name: "v2_media", Method: "GET", Path: "/api/v2/media", Tag: "v2 media",
+		Summary:  "List the media library",
+		Auth:     authRequired,
+		Scope:    model.ScopeMediaWrite,
+		Query:    apiv2ListParams("media"),
+		Response: apiv2ListBody(api.doc, media),
+		Errors:   []int{http.StatusBadRequest},
+	}, APIv2MediaListHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_media_item", Method: "GET", Path: "/api/v2/media/:id", Tag: "v2 media",
+		Summary:  "Get a media file by ID",
+		Auth:     authRequired,
+		Scope:    model.ScopeMediaWrite,
+		Query:    []*openapi.Parameter{apiv2FieldsParam()},
+		Response: apiv2Body(media),
+		Errors:   []int{http.StatusNotFound},
+	}, APIv2MediaHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_media_upload", Method: "POST", Path: "/api/v2/media", Tag: "v2 media",
+		Summary:   "Upload a file to the media library",
+		Auth:      authRequired,
+		Scope:     model.ScopeMediaWrite,
+		Body:      openapi.Object(map[string]*openapi.Schema{"file": openapi.Binary()}, "file"),
+		BodyTypes: []string{"multipart/form-data"},
+		Status:    http.StatusCreated,
+		Response:  apiv2Body(media),
+		Errors:    []int{http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2MediaUploadHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_media_update", Method: "PATCH", Aliases: []string{"PUT"}, Path: "/api/v2/media/:id", Tag: "v2 media",
+		Summary:  "Change the name or the alt text of a media file",
+		Auth:     authRequired,
+		Scope:    model.ScopeMediaWrite,
+		Body:     api.doc.Define("MediaInputV2", apiv2MediaBody{}),
+		Response: apiv2Body(media),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2MediaUpdateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_media_delete", Method: "DELETE", Path: "/api/v2/media/:id", Tag: "v2 media",
+		Summary: "Delete a media file",
+		Auth:    authRequired,
+		Scope:   model.ScopeMediaWrite,
+		Query: []*openapi.Parameter{
+			apiQuery("force", "Delete the file even if posts still use it.", openapi.Boolean()),
+		},
+		Status: http.StatusNoContent,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	}, APIv2MediaDeleteHandler)
+}
+
+// An apiv2MediaBody is the body of a request updating a media file.
+type apiv2MediaBody struct {
+	Name *string `json:"name"`
+	Alt  *string `json:"alt"`
+}
+
+// apiv2Media returns the fields of the media file asked for.
+func apiv2Media(m *model.Media, f fieldSet) map[string]interface{} {
+	r := map[string]interface{}{
+		"id":         m.Id,
+		"name":       m.Name,
+		"url":        m.Url(),
+		"mime_type":  m.MimeType,
+		"size":       m.Size,
+		"width":      m.Width,
+		"height":     m.Height,
+		"alt":        m.Alt,
+		"created_at": apiv2Time(m.CreatedAt),
+		"updated_at": apiv2Time(m.UpdatedAt),
+	}
+	if f.has("variants") {
+		variants := make(map[string]string)
+		for _, v := range m.Variants() {
+			variants[v.Name] = "/" + v.Path
+		}
+		r["variants"] = variants
+	}
+	if f.has("posts") {
+		posts := make([]int64, 0)
+		for _, p := range m.Posts() {
+			posts = append(posts, p.Id)
+		}
+		r["posts"] = posts
+	}
+	return f.pick(r)
+}
+
+// apiv2MediaSchema returns the schema of the media files sent by apiv2Media.
+func apiv2MediaSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("MediaV2", openapi.Object(map[string]*openapi.Schema{
+		"id":         openapi.Integer(),
+		"name":       openapi.String(),
+		"url":        openapi.String(),
+		"mime_type":  openapi.String(),
+		"size":       openapi.Integer(),
+		"width":      openapi.Integer(),
+		"height":     openapi.Integer(),
+		"alt":        openapi.String(),
+		"created_at": openapi.DateTime().OrNull(),
+		"updated_at": openapi.DateTime().OrNull(),
+		"variants":   openapi.MapOf(openapi.String()).Describe("The URLs of the resized images, by name."),
+		"posts":      openapi.ArrayOf(openapi.Integer()).Describe("The IDs of the posts using the file."),
+	}))
+}
+
+// apiv2FindMedia finds the media file with the ID in the URL.
+func apiv2FindMedia(ctx *golf.Context) *model.Media {
+	m := new(model.Media)
+	id, ok := apiv2Id(ctx, "id")
+	if ok {
+		m.Id = id
+	}
+	if !ok || m.GetMediaById() != nil {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such media: %s", ctx.Param("id")))
+		return nil
+	}
+	return m
+}
+
+// APIv2MediaListHandler lists the media library.
+func APIv2MediaListHandler(ctx *golf.Context) {
+	q, err := apiv2ListQuery(ctx, "-created_at")
+	if err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	ml := new(model.MediaList)
+	next, err := ml.List(q)
+	if err != nil {
+		apiv2ListError(ctx, err)
+		return
+	}
+	fields := apiv2Fields(ctx)
+	items := make([]map[string]interface{}, len(*ml))
+	for i, m := range *ml {
+		items[i] = apiv2Media(m, fields)
+	}
+	apiv2List(ctx, items, q, next)
+}
+
+// APIv2MediaHandler retrieves the media file with the given ID.
+func APIv2MediaHandler(ctx *golf.Context) {
+	if m := apiv2FindMedia(ctx); m != nil {
+		apiv2Data(ctx, http.StatusOK, apiv2Media(m, apiv2Fields(ctx)))
+	}
+}
+
+// APIv2MediaUploadHandler stores the "file" of the multipart request in the
+// media library, with the same limits as the uploads of the admin.
+func APIv2MediaUploadHandler(ctx *golf.Context) {
+	maxSize, _ := ctx.App.Config.GetInt("app.upload_size", 1024*1024*10)
+	fileExt, _ := ctx.App.Config.GetString("app.upload_files", ".jpg,.png,.gif,.zip,.txt,.doc,.docx,.xls,.xlsx,.ppt,.pptx")
+	uploadDir, _ := ctx.App.Config.GetString("upload_dir", "upload")
+	ctx.Request.Body = http.MaxBytesReader(ctx.Response, ctx.Request.Body, int64(maxSize)+4096)
+	m, err := saveUploadPart(ctx.Request, uploadDir, int64(maxSize), strings.Split(fileExt, ","), apiv2UserId(ctx))
+	if err != nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err = publishUpload(m); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Created(ctx, "/api/v2/media/"+strconv.FormatInt(m.Id, 10), apiv2Media(m, nil))
+}
+
+// APIv2MediaUpdateHandler changes the name or the alt text of the media file.
+func APIv2MediaUpdateHandler(ctx *golf.Context) {
+	m := apiv2FindMedia(ctx)
+	if m == nil {
+		return
+	}
+	var body apiv2MediaBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if body.Name != nil {
+		if m.Name = strings.TrimSpace(*body.Name); m.Name == "" {
+			apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The name can not be empty."))
+			return
+		}
+	}
+	if body.Alt != nil {
+		m.Alt = *body.Alt
+	}
+	m.UpdatedAt = utils.Now()
+	m.UpdatedBy = apiv2UserId(ctx)
+	if err := m.Save(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Data(ctx, http.StatusOK, apiv2Media(m, nil))
+}
+
+// APIv2MediaDeleteHandler deletes the media file. A file still used by posts
+// is only deleted when "force" is set.
+func APIv2MediaDeleteHandler(ctx *golf.Context) {
+	m := apiv2FindMedia(ctx)
+	if m == nil {
+		return
+	}
+	if posts := m.Posts(); len(posts) > 0 && ctx.Request.FormValue("force") != "true" {
+		titles := make([]string, len(posts))
+		for i, p := range posts {
+			titles[i] = p.Title
+		}
+		apiv2Error(ctx, http.StatusConflict, fmt.Errorf("This file is still used by: %s", strings.Join(titles, ", ")))
+		return
+	}
+	if err := deleteMedia(m); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2NoContent(ctx)
+}
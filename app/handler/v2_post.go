@@ -0,0 +1,411 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+func registerAPIv2PostHandlers(api *apiRegistry) {
+	post := apiv2PostSchema(api.doc)
+	body := api.doc.Define("PostInputV2", apiv2PostBody{})
+	for _, kind := range []string{"posts", "pages"} {
+		page := kind == "pages"
+		api.handle(apiRoute{
+			Name: "v2_" + kind, Method: "GET", Path: "/api/v2/" + kind, Tag: "v2 " + kind,
+			Summary: "List the " + kind,
+			Auth:    authOptional,
+			Scope:   model.ScopePostsRead,
+			Query: append(apiv2ListParams("posts"),
+				apiQuery("tag", "The slug of a tag.", openapi.String()),
+				apiQuery("author", "The ID or the slug of the author.", openapi.String()),
+				apiQuery("status", "The drafts and all need a token.", openapi.Enum("published", "draft", "all")),
+				apiQuery("from", "The first publication date, as RFC 3339 or as a day.", openapi.String()),
+				apiQuery("to", "The last publication date, as RFC 3339 or as a day.", openapi.String()),
+			),
+			Response: apiv2ListBody(api.doc, post),
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+		}, APIv2PostsHandler(page))
+
+		api.handle(apiRoute{
+			Name: "v2_" + kind + "_item", Method: "GET", Path: "/api/v2/" + kind + "/:id", Tag: "v2 " + kind,
+			Summary:  "Get a " + kind[:4] + " by ID or slug",
+			Auth:     authOptional,
+			Scope:    model.ScopePostsRead,
+			Query:    []*openapi.Parameter{apiv2FieldsParam()},
+			Response: apiv2Body(post),
+			Errors:   []int{http.StatusNotFound},
+		}, APIv2PostHandler(page))
+
+		api.handle(apiRoute{
+			Name: "v2_" + kind + "_create", Method: "POST", Path: "/api/v2/" + kind, Tag: "v2 " + kind,
+			Summary:  "Create a " + kind[:4],
+			Auth:     authRequired,
+			Scope:    model.ScopePostsWrite,
+			Body:     body,
+			Status:   http.StatusCreated,
+			Response: apiv2Body(post),
+			Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+		}, APIv2PostCreateHandler(page))
+
+		api.handle(apiRoute{
+			Name: "v2_" + kind + "_update", Method: "PATCH", Aliases: []string{"PUT"}, Path: "/api/v2/" + kind + "/:id", Tag: "v2 " + kind,
+			Summary:  "Update the given fields of a " + kind[:4],
+			Auth:     authRequired,
+			Scope:    model.ScopePostsWrite,
+			Body:     body,
+			Response: apiv2Body(post),
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+		}, APIv2PostUpdateHandler(page))
+
+		api.handle(apiRoute{
+			Name: "v2_" + kind + "_delete", Method: "DELETE", Path: "/api/v2/" + kind + "/:id", Tag: "v2 " + kind,
+			Summary: "Delete a " + kind[:4],
+			Auth:    authRequired,
+			Scope:   model.ScopePostsWrite,
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusNotFound, http.StatusInternalServerError},
+		}, APIv2PostDeleteHandler(page))
+	}
+}
+
+// An apiv2PostBody is the body of a request creating or updating a post or a
+// page. The fields left out are left unchanged.
+type apiv2PostBody struct {
+	Title           *string   `json:"title"`
+	Slug            *string   `json:"slug"`
+	Markdown        *string   `json:"markdown"`
+	Image           *string   `json:"image"`
+	Featured        *bool     `json:"featured"`
+	AllowComment    *bool     `json:"allow_comment"`
+	Status          *string   `json:"status"`
+	Language        *string   `json:"language"`
+	MetaTitle       *string   `json:"meta_title"`
+	MetaDescription *string   `json:"meta_description"`
+	Tags            *[]string `json:"tags"`
+}
+
+func (b *apiv2PostBody) apply(p *model.Post) error {
+	if b.Title != nil {
+		p.Title = strings.TrimSpace(*b.Title)
+	}
+	if b.Slug != nil {
+		p.Slug = *b.Slug
+	}
+	if b.Markdown != nil {
+		p.Markdown = *b.Markdown
+		p.Html = utils.Markdown2Html(p.Markdown)
+	}
+	if b.Image != nil {
+		p.Image = *b.Image
+	}
+	if b.Featured != nil {
+		p.IsFeatured = *b.Featured
+	}
+	if b.AllowComment != nil {
+		p.AllowComment = *b.AllowComment
+	}
+	if b.Status != nil {
+		switch *b.Status {
+		case "published":
+			p.IsPublished = true
+		case "draft":
+			p.IsPublished = false
+		default:
+			return fmt.Errorf("The status must be \"published\" or \"draft\".")
+		}
+	}
+	if b.Language != nil {
+		p.Language = *b.Language
+	}
+	if b.MetaTitle != nil {
+		p.MetaTitle = strings.TrimSpace(*b.MetaTitle)
+	}
+	if b.MetaDescription != nil {
+		p.MetaDescription = strings.TrimSpace(*b.MetaDescription)
+	}
+	if p.Title == "" {
+		return fmt.Errorf("The title can not be empty.")
+	}
+	if strings.Trim(p.Slug, "/ ") == "" {
+		p.Slug = model.GenerateSlugFor(p.Title, "posts", p.Id)
+	} else if b.Slug != nil {
+		return model.ValidatePostSlug(p.Slug)
+	}
+	return nil
+}
+
+// tags returns the tags given in the body, or the current tags of the post if
+// there are none, since saving a post replaces its tags.
+func (b *apiv2PostBody) tags(p *model.Post) []*model.Tag {
+	if b.Tags == nil {
+		return p.Tags()
+	}
+	tags := make([]*model.Tag, 0)
+	for _, name := range *b.Tags {
+		if name = strings.TrimSpace(name); name != "" {
+			tags = append(tags, model.NewTag(name, model.GenerateSlug(name, "tags")))
+		}
+	}
+	return tags
+}
+
+func apiv2PostStatus(p *model.Post) string {
+	if p.IsPublished {
+		return "published"
+	}
+	return "draft"
+}
+
+func apiv2PostUrl(p *model.Post) string {
+	if p.IsPage {
+		return "/api/v2/pages/" + strconv.FormatInt(p.Id, 10)
+	}
+	return "/api/v2/posts/" + strconv.FormatInt(p.Id, 10)
+}
+
+// apiv2Post returns the fields of the post asked for.
+func apiv2Post(p *model.Post, f fieldSet) map[string]interface{} {
+	r := map[string]interface{}{
+		"id":               p.Id,
+		"title":            p.Title,
+		"slug":             p.Slug,
+		"url":              p.Url() + "/",
+		"image":            p.Image,
+		"featured":         p.IsFeatured,
+		"page":             p.IsPage,
+		"allow_comment":    p.AllowComment,
+		"comment_count":    p.CommentNum,
+		"status":           apiv2PostStatus(p),
+		"language":         p.Language,
+		"meta_title":       p.MetaTitle,
+		"meta_description": p.MetaDescription,
+		"word_count":       p.WordCount,
+		"reading_time":     p.ReadingTime,
+		"created_at":       apiv2Time(p.CreatedAt),
+		"updated_at":       apiv2Time(p.UpdatedAt),
+		"published_at":     apiv2Time(p.PublishedAt),
+		"markdown":         p.Markdown,
+		"html":             p.Html,
+		"toc":              p.TOC,
+	}
+	if f.has("excerpt") {
+		r["excerpt"] = p.Excerpt()
+	}
+	if f.has("tags") {
+		tags := make([]map[string]interface{}, 0)
+		for _, t := range p.Tags() {
+			tags = append(tags, apiv2TagRef(t))
+		}
+		r["tags"] = tags
+	}
+	if f.has("author") {
+		r["author"] = apiv2UserRef(p.Author())
+	}
+	return f.pick(r)
+}
+
+// apiv2PostSchema returns the schema of the posts sent by apiv2Post.
+func apiv2PostSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("PostV2", openapi.Object(map[string]*openapi.Schema{
+		"id":               openapi.Integer(),
+		"title":            openapi.String(),
+		"slug":             openapi.String(),
+		"url":              openapi.String(),
+		"image":            openapi.String(),
+		"featured":         openapi.Boolean(),
+		"page":             openapi.Boolean(),
+		"allow_comment":    openapi.Boolean(),
+		"comment_count":    openapi.Integer(),
+		"status":           openapi.Enum("published", "draft"),
+		"language":         openapi.String(),
+		"meta_title":       openapi.String(),
+		"meta_description": openapi.String(),
+		"word_count":       openapi.Integer(),
+		"reading_time":     openapi.Integer().Describe("In minutes."),
+		"created_at":       openapi.DateTime().OrNull(),
+		"updated_at":       openapi.DateTime().OrNull(),
+		"published_at":     openapi.DateTime().OrNull(),
+		"markdown":         openapi.String(),
+		"html":             openapi.String(),
+		"toc":              doc.SchemaOf(model.Outline{}),
+		"excerpt":          openapi.String(),
+		"tags":             openapi.ArrayOf(apiv2TagRefSchema(doc)),
+		"author":           apiv2UserRefSchema(doc),
+	}))
+}
+
+// apiv2FindPost finds the post, or the page, with the ID or the slug in the
+// URL. Drafts are only found with a token.
+func apiv2FindPost(ctx *golf.Context, page, withDrafts bool) *model.Post {
+	p := new(model.Post)
+	var err error
+	if id, ok := apiv2Id(ctx, "id"); ok {
+		err = p.GetPostById(id)
+	} else {
+		err = p.GetPostBySlug(ctx.Param("id"))
+	}
+	if err != nil || p.IsPage != page || (!p.IsPublished && !withDrafts) {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such post: %s", ctx.Param("id")))
+		return nil
+	}
+	return p
+}
+
+// APIv2PostsHandler lists the posts, or the pages, filtered by the "tag" slug,
+// the "author" ID or slug, the "status" ("published", "draft" or "all") and
+// the publication dates "from" and "to". Drafts are only listed with a token
+// allowed to read them.
+func APIv2PostsHandler(page bool) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		q, err := apiv2ListQuery(ctx, "-published_at")
+		if err != nil {
+			apiv2Error(ctx, http.StatusBadRequest, err)
+			return
+		}
+		f := model.PostFilter{Page: page, Status: "published"}
+		switch status := ctx.Request.FormValue("status"); status {
+		case "", "published":
+		case "draft", "all":
+			if _, ok := apiv2Authorize(ctx, model.ScopePostsRead); !ok {
+				return
+			}
+			f.Status = status
+			if status == "all" {
+				f.Status = ""
+			}
+		default:
+			apiv2Error(ctx, http.StatusBadRequest, fmt.Errorf("Unknown status: %s", status))
+			return
+		}
+		if slug := ctx.Request.FormValue("tag"); slug != "" {
+			tag := &model.Tag{Slug: slug}
+			if tag.GetTagBySlug() != nil {
+				apiv2List(ctx, []map[string]interface{}{}, q, nil)
+				return
+			}
+			f.TagId = tag.Id
+		}
+		if author := ctx.Request.FormValue("author"); author != "" {
+			user := &model.User{Slug: author}
+			err = user.GetUserBySlug()
+			if id, convErr := strconv.ParseInt(author, 10, 64); err != nil && convErr == nil {
+				user.Id = id
+				err = user.GetUserById()
+			}
+			if err != nil {
+				apiv2List(ctx, []map[string]interface{}{}, q, nil)
+				return
+			}
+			f.AuthorId = user.Id
+		}
+		if s := ctx.Request.FormValue("from"); s != "" {
+			if f.From, err = apiv2Date(s, false); err != nil {
+				apiv2Error(ctx, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if s := ctx.Request.FormValue("to"); s != "" {
+			if f.To, err = apiv2Date(s, true); err != nil {
+				apiv2Error(ctx, http.StatusBadRequest, err)
+				return
+			}
+		}
+		posts := new(model.Posts)
+		next, err := posts.List(f, q)
+		if err != nil {
+			apiv2ListError(ctx, err)
+			return
+		}
+		fields := apiv2Fields(ctx)
+		items := make([]map[string]interface{}, len(*posts))
+		for i, p := range *posts {
+			items[i] = apiv2Post(p, fields)
+		}
+		apiv2List(ctx, items, q, next)
+	}
+}
+
+// APIv2PostHandler retrieves the post, or the page, with the given ID or slug.
+func APIv2PostHandler(page bool) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		withDrafts := apiv2Allowed(ctx, model.ScopePostsRead)
+		if p := apiv2FindPost(ctx, page, withDrafts); p != nil {
+			apiv2Data(ctx, http.StatusOK, apiv2Post(p, apiv2Fields(ctx)))
+		}
+	}
+}
+
+// APIv2PostCreateHandler creates a post, or a page, from the JSON body. Posts
+// are drafts unless their status is "published".
+func APIv2PostCreateHandler(page bool) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		var body apiv2PostBody
+		if err := apiv2Decode(ctx, &body); err != nil {
+			apiv2Error(ctx, http.StatusBadRequest, err)
+			return
+		}
+		p := model.NewPost()
+		p.IsPage = page
+		p.AllowComment = true
+		p.CreatedBy = apiv2UserId(ctx)
+		p.UpdatedBy = p.CreatedBy
+		if err := body.apply(p); err != nil {
+			apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err := p.Save(body.tags(p)...); err != nil {
+			apiv2Error(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		apiv2Created(ctx, apiv2PostUrl(p), apiv2Post(p, nil))
+	}
+}
+
+// APIv2PostUpdateHandler updates the fields of the post, or the page, given
+// in the JSON body.
+func APIv2PostUpdateHandler(page bool) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		p := apiv2FindPost(ctx, page, true)
+		if p == nil {
+			return
+		}
+		var body apiv2PostBody
+		if err := apiv2Decode(ctx, &body); err != nil {
+			apiv2Error(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if err := body.apply(p); err != nil {
+			apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+			return
+		}
+		p.UpdatedBy = apiv2UserId(ctx)
+		if err := p.Save(body.tags(p)...); err != nil {
+			apiv2Error(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		apiv2Data(ctx, http.StatusOK, apiv2Post(p, nil))
+	}
+}
+
+// APIv2PostDeleteHandler deletes the post, or the page, with the given ID or
+// slug.
+func APIv2PostDeleteHandler(page bool) golf.HandlerFunc {
+	return func(ctx *golf.Context) {
+		p := apiv2FindPost(ctx, page, true)
+		if p == nil {
+			return
+		}
+		if err := model.DeletePostById(p.Id); err != nil {
+			apiv2Error(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		apiv2NoContent(ctx)
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+)
+
+func registerAPIv2SettingHandlers(api *apiRegistry) {
+	setting := apiv2SettingSchema(api.doc)
+	api.handle(apiRoute{
+		Name: "v2_settings", Method: "GET", Path: "/api/v2/settings", Tag: "v2 settings",
+		Summary: "List the settings",
+		Auth:    authRequired,
+		Query: append(apiv2ListParams("settings"),
+			apiQuery("type", "The type of the settings, such as \"custom\".", openapi.String()),
+		),
+		Response: apiv2ListBody(api.doc, setting),
+		Errors:   []int{http.StatusBadRequest},
+	}, APIv2SettingsHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_setting", Method: "GET", Path: "/api/v2/settings/:key", Tag: "v2 settings",
+		Summary:  "Get a setting by key",
+		Auth:     authRequired,
+		Query:    []*openapi.Parameter{apiv2FieldsParam()},
+		Response: apiv2Body(setting),
+		Errors:   []int{http.StatusNotFound},
+	}, APIv2SettingHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_setting_save", Method: "PUT", Aliases: []string{"PATCH"}, Path: "/api/v2/settings/:key", Tag: "v2 settings",
+		Summary:  "Set the value of a setting, adding it if it doesn't exist yet",
+		Auth:     authRequired,
+		Body:     api.doc.Define("SettingInputV2", apiv2SettingBody{}),
+		Created:  true,
+		Response: apiv2Body(setting),
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2SettingSaveHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_setting_delete", Method: "DELETE", Path: "/api/v2/settings/:key", Tag: "v2 settings",
+		Summary: "Delete a setting",
+		Auth:    authRequired,
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2SettingDeleteHandler)
+}
+
+// An apiv2SettingBody is the body of a request saving a setting. The type is
+// only used by new settings, and defaults to "custom".
+type apiv2SettingBody struct {
+	Value *string `json:"value"`
+	Type  string  `json:"type"`
+}
+
+// apiv2Setting returns the fields of the setting asked for.
+func apiv2Setting(s *model.Setting, f fieldSet) map[string]interface{} {
+	return f.pick(map[string]interface{}{
+		"key":        s.Ke,
+		"value":      s.Value,
+		"type":       s.Type,
+		"created_at": apiv2Time(s.CreatedAt),
+		"updated_at": apiv2Time(s.UpdatedAt),
+	})
+}
+
+// apiv2SettingSchema returns the schema of the settings sent by apiv2Setting.
+func apiv2SettingSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("SettingV2", openapi.Object(map[string]*openapi.Schema{
+		"key":        openapi.String(),
+		"value":      openapi.String(),
+		"type":       openapi.String(),
+		"created_at": openapi.DateTime().OrNull(),
+		"updated_at": openapi.DateTime().OrNull(),
+	}))
+}
+
+// apiv2FindSetting finds the setting with the key in the URL.
+func apiv2FindSetting(ctx *golf.Context) *model.Setting {
+	s := &model.Setting{Ke: ctx.Param("key")}
+	if s.GetSetting() != nil {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such setting: %s", s.Ke))
+		return nil
+	}
+	return s
+}
+
+// APIv2SettingsHandler lists the settings, of the given "type" if any.
+func APIv2SettingsHandler(ctx *golf.Context) {
+	q, err := apiv2ListQuery(ctx, "key")
+	if err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	settings := new(model.Settings)
+	next, err := settings.List(ctx.Request.FormValue("type"), q)
+	if err != nil {
+		apiv2ListError(ctx, err)
+		return
+	}
+	fields := apiv2Fields(ctx)
+	items := make([]map[string]interface{}, len(*settings))
+	for i, s := range *settings {
+		items[i] = apiv2Setting(s, fields)
+	}
+	apiv2List(ctx, items, q, next)
+}
+
+// APIv2SettingHandler retrieves the setting with the given key.
+func APIv2SettingHandler(ctx *golf.Context) {
+	if s := apiv2FindSetting(ctx); s != nil {
+		apiv2Data(ctx, http.StatusOK, apiv2Setting(s, apiv2Fields(ctx)))
+	}
+}
+
+// APIv2SettingSaveHandler sets the value of the setting with the given key,
+// adding it if it doesn't exist yet.
+func APIv2SettingSaveHandler(ctx *golf.Context) {
+	var body apiv2SettingBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if body.Value == nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The value is required."))
+		return
+	}
+	if body.Type == "" {
+		body.Type = "custom"
+	}
+	key := ctx.Param("key")
+	status := http.StatusOK
+	if (&model.Setting{Ke: key}).GetSetting() != nil {
+		status = http.StatusCreated
+	}
+	if err := model.SetSettingValue(key, *body.Value, body.Type, apiv2UserId(ctx)); err != nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+		return
+	}
+	s := &model.Setting{Ke: key}
+	if err := s.GetSetting(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	if status == http.StatusCreated {
+		apiv2Created(ctx, "/api/v2/settings/"+url.PathEscape(key), apiv2Setting(s, nil))
+		return
+	}
+	apiv2Data(ctx, status, apiv2Setting(s, nil))
+}
+
+// APIv2SettingDeleteHandler deletes the setting with the given key.
+func APIv2SettingDeleteHandler(ctx *golf.Context) {
+	s := apiv2FindSetting(ctx)
+	if s == nil {
+		return
+	}
+	if err := model.DeleteSetting(s.Ke); err == model.ErrSettingNotDeletable {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, err)
+		return
+	} else if err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2NoContent(ctx)
+}
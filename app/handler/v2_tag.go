@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+func registerAPIv2TagHandlers(api *apiRegistry) {
+	tag := apiv2TagSchema(api.doc)
+	body := api.doc.Define("TagInputV2", apiv2TagBody{})
+	api.handle(apiRoute{
+		Name: "v2_tags", Method: "GET", Path: "/api/v2/tags", Tag: "v2 tags",
+		Summary:  "List the tags",
+		Auth:     authOptional,
+		Scope:    model.ScopePostsRead,
+		Query:    apiv2ListParams("tags"),
+		Response: apiv2ListBody(api.doc, tag),
+		Errors:   []int{http.StatusBadRequest},
+	}, APIv2TagsHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_tag", Method: "GET", Path: "/api/v2/tags/:id", Tag: "v2 tags",
+		Summary:  "Get a tag by ID or slug",
+		Auth:     authOptional,
+		Scope:    model.ScopePostsRead,
+		Query:    []*openapi.Parameter{apiv2FieldsParam()},
+		Response: apiv2Body(tag),
+		Errors:   []int{http.StatusNotFound},
+	}, APIv2TagHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_tag_create", Method: "POST", Path: "/api/v2/tags", Tag: "v2 tags",
+		Summary:  "Create a tag",
+		Auth:     authRequired,
+		Scope:    model.ScopePostsWrite,
+		Body:     body,
+		Status:   http.StatusCreated,
+		Response: apiv2Body(tag),
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2TagCreateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_tag_update", Method: "PATCH", Aliases: []string{"PUT"}, Path: "/api/v2/tags/:id", Tag: "v2 tags",
+		Summary:  "Update the given fields of a tag",
+		Auth:     authRequired,
+		Scope:    model.ScopePostsWrite,
+		Body:     body,
+		Response: apiv2Body(tag),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2TagUpdateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_tag_delete", Method: "DELETE", Path: "/api/v2/tags/:id", Tag: "v2 tags",
+		Summary: "Delete a tag",
+		Auth:    authRequired,
+		Scope:   model.ScopePostsWrite,
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusNotFound, http.StatusInternalServerError},
+	}, APIv2TagDeleteHandler)
+}
+
+// An apiv2TagBody is the body of a request creating or updating a tag.
+type apiv2TagBody struct {
+	Name *string `json:"name"`
+	Slug *string `json:"slug"`
+}
+
+// apiv2TagRef returns the fields of a tag shown in the resources linked to it.
+func apiv2TagRef(t *model.Tag) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   t.Id,
+		"name": t.Name,
+		"slug": t.Slug,
+		"url":  t.Url() + "/",
+	}
+}
+
+// apiv2Tag returns the fields of the tag asked for.
+func apiv2Tag(t *model.Tag, f fieldSet) map[string]interface{} {
+	r := apiv2TagRef(t)
+	r["hidden"] = t.Hidden
+	r["created_at"] = apiv2Time(t.CreatedAt)
+	r["updated_at"] = apiv2Time(t.UpdatedAt)
+	return f.pick(r)
+}
+
+// apiv2TagRefSchema returns the schema of the tags sent by apiv2TagRef.
+func apiv2TagRefSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("TagRefV2", openapi.Object(map[string]*openapi.Schema{
+		"id":   openapi.Integer(),
+		"name": openapi.String(),
+		"slug": openapi.String(),
+		"url":  openapi.String(),
+	}, "id", "name", "slug", "url"))
+}
+
+// apiv2TagSchema returns the schema of the tags sent by apiv2Tag.
+func apiv2TagSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("TagV2", openapi.Object(map[string]*openapi.Schema{
+		"id":         openapi.Integer(),
+		"name":       openapi.String(),
+		"slug":       openapi.String(),
+		"url":        openapi.String(),
+		"hidden":     openapi.Boolean().Describe("Whether the tag only belongs to drafts."),
+		"created_at": openapi.DateTime().OrNull(),
+		"updated_at": openapi.DateTime().OrNull(),
+	}))
+}
+
+// apiv2FindTag finds the tag with the ID or the slug in the URL. Hidden tags,
+// which only belong to drafts, are only found with a token.
+func apiv2FindTag(ctx *golf.Context, withHidden bool) *model.Tag {
+	t := new(model.Tag)
+	var err error
+	if id, ok := apiv2Id(ctx, "id"); ok {
+		t.Id = id
+		err = t.GetTag()
+	} else {
+		t.Slug = ctx.Param("id")
+		err = t.GetTagBySlug()
+	}
+	if err != nil || (t.Hidden && !withHidden) {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such tag: %s", ctx.Param("id")))
+		return nil
+	}
+	return t
+}
+
+// apiv2TagSlugTaken returns whether another tag has the given slug.
+func apiv2TagSlugTaken(slug string, id int64) bool {
+	other := &model.Tag{Slug: slug}
+	return other.GetTagBySlug() == nil && other.Id != id
+}
+
+// APIv2TagsHandler lists the tags. Hidden tags are only listed with a token.
+func APIv2TagsHandler(ctx *golf.Context) {
+	q, err := apiv2ListQuery(ctx, "name")
+	if err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	withHidden := apiv2Allowed(ctx, model.ScopePostsRead)
+	tags := new(model.Tags)
+	next, err := tags.List(withHidden, q)
+	if err != nil {
+		apiv2ListError(ctx, err)
+		return
+	}
+	fields := apiv2Fields(ctx)
+	items := make([]map[string]interface{}, len(*tags))
+	for i, t := range *tags {
+		items[i] = apiv2Tag(t, fields)
+	}
+	apiv2List(ctx, items, q, next)
+}
+
+// APIv2TagHandler retrieves the tag with the given ID or slug.
+func APIv2TagHandler(ctx *golf.Context) {
+	withHidden := apiv2Allowed(ctx, model.ScopePostsRead)
+	if t := apiv2FindTag(ctx, withHidden); t != nil {
+		apiv2Data(ctx, http.StatusOK, apiv2Tag(t, apiv2Fields(ctx)))
+	}
+}
+
+// APIv2TagCreateHandler creates a tag from the JSON body. The slug is made
+// from the name unless it is given.
+func APIv2TagCreateHandler(ctx *golf.Context) {
+	var body apiv2TagBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if body.Name == nil || strings.TrimSpace(*body.Name) == "" {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The name can not be empty."))
+		return
+	}
+	name := strings.TrimSpace(*body.Name)
+	slug := model.GenerateSlug(name, "tags")
+	if body.Slug != nil && *body.Slug != "" {
+		slug = model.GenerateSlug(*body.Slug, "tags")
+	}
+	if apiv2TagSlugTaken(slug, 0) {
+		apiv2Error(ctx, http.StatusConflict, fmt.Errorf("The slug %s is already taken.", slug))
+		return
+	}
+	t := model.NewTag(name, slug)
+	t.CreatedBy = apiv2UserId(ctx)
+	t.UpdatedAt = t.CreatedAt
+	t.UpdatedBy = t.CreatedBy
+	if err := t.Insert(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Created(ctx, "/api/v2/tags/"+strconv.FormatInt(t.Id, 10), apiv2Tag(t, nil))
+}
+
+// APIv2TagUpdateHandler renames the tag, or changes its slug.
+func APIv2TagUpdateHandler(ctx *golf.Context) {
+	t := apiv2FindTag(ctx, true)
+	if t == nil {
+		return
+	}
+	var body apiv2TagBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if body.Name != nil {
+		if t.Name = strings.TrimSpace(*body.Name); t.Name == "" {
+			apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The name can not be empty."))
+			return
+		}
+	}
+	if body.Slug != nil {
+		if t.Slug = model.GenerateSlug(*body.Slug, "tags"); t.Slug == "" {
+			apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The slug can not be empty."))
+			return
+		}
+		if apiv2TagSlugTaken(t.Slug, t.Id) {
+			apiv2Error(ctx, http.StatusConflict, fmt.Errorf("The slug %s is already taken.", t.Slug))
+			return
+		}
+	}
+	t.UpdatedAt = utils.Now()
+	t.UpdatedBy = apiv2UserId(ctx)
+	if err := t.Update(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Data(ctx, http.StatusOK, apiv2Tag(t, nil))
+}
+
+// APIv2TagDeleteHandler deletes the tag, removing it from its posts.
+func APIv2TagDeleteHandler(ctx *golf.Context) {
+	t := apiv2FindTag(ctx, true)
+	if t == nil {
+		return
+	}
+	if err := model.DeleteTag(t.Id); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2NoContent(ctx)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// newAPIv2TestApp returns an app serving the API v2 as if every request was
+// made with the given token, instead of looking it up in the DB.
+func newAPIv2TestApp(token model.JWT) *golf.Application {
+	app := golf.New()
+	routes := make(map[string]map[string]interface{})
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
+		routes[method] = map[string]interface{}{}
+	}
+	doc := newAPIDocument()
+	registerAPIv2Handlers(&apiRegistry{
+		app:    app,
+		routes: routes,
+		doc:    doc,
+		auth: func(scope string) golf.MiddlewareHandlerFunc {
+			return func(next golf.HandlerFunc) golf.HandlerFunc {
+				return func(ctx *golf.Context) {
+					if apiv2AuthorizeToken(ctx, token, true, scope) {
+						next(ctx)
+					}
+				}
+			}
+		},
+		errors:    apiv2ErrorSchema(doc),
+		authError: apiv2ErrorSchema(doc),
+	})
+	return app
+}
+
+func TestAPIv2ScopedTokenCanNotWriteSettingsOrUsers(t *testing.T) {
+	// A personal API token with every scope there is.
+	app := newAPIv2TestApp(model.JWT{UserID: 1, Scopes: model.APITokenScopes})
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/api/v2/settings", ""},
+		{"PUT", "/api/v2/settings/site_title", `{"value": "Hacked"}`},
+		{"PATCH", "/api/v2/settings/site_title", `{"value": "Hacked"}`},
+		{"DELETE", "/api/v2/settings/site_title", ""},
+		{"POST", "/api/v2/users", `{"name": "eve", "email": "eve@example.com", "password": "password", "role": 1}`},
+		{"PATCH", "/api/v2/users/1", `{"role": 1}`},
+		{"PUT", "/api/v2/users/1", `{"role": 1}`},
+		{"DELETE", "/api/v2/users/1", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, w.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/openapi"
+)
+
+func registerAPIv2UserHandlers(api *apiRegistry) {
+	user := apiv2UserSchema(api.doc)
+	body := api.doc.Define("UserInputV2", apiv2UserBody{})
+	api.handle(apiRoute{
+		Name: "v2_users", Method: "GET", Path: "/api/v2/users", Tag: "v2 users",
+		Summary:  "List the users",
+		Auth:     authOptional,
+		Query:    apiv2ListParams("users"),
+		Response: apiv2ListBody(api.doc, user),
+		Errors:   []int{http.StatusBadRequest},
+	}, APIv2UsersHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_user", Method: "GET", Path: "/api/v2/users/:id", Tag: "v2 users",
+		Summary:  "Get a user by ID or slug",
+		Auth:     authOptional,
+		Query:    []*openapi.Parameter{apiv2FieldsParam()},
+		Response: apiv2Body(user),
+		Errors:   []int{http.StatusNotFound},
+	}, APIv2UserHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_user_create", Method: "POST", Path: "/api/v2/users", Tag: "v2 users",
+		Summary:  "Create a user",
+		Auth:     authRequired,
+		Body:     body,
+		Status:   http.StatusCreated,
+		Response: apiv2Body(user),
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2UserCreateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_user_update", Method: "PATCH", Aliases: []string{"PUT"}, Path: "/api/v2/users/:id", Tag: "v2 users",
+		Summary:  "Update the given fields of a user",
+		Auth:     authRequired,
+		Body:     body,
+		Response: apiv2Body(user),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusInternalServerError},
+	}, APIv2UserUpdateHandler)
+
+	api.handle(apiRoute{
+		Name: "v2_user_delete", Method: "DELETE", Path: "/api/v2/users/:id", Tag: "v2 users",
+		Summary: "Delete a user",
+		Auth:    authRequired,
+		Status:  http.StatusNoContent,
+		Errors:  []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	}, APIv2UserDeleteHandler)
+}
+
+// An apiv2UserBody is the body of a request creating or updating a user. The
+// fields left out are left unchanged.
+type apiv2UserBody struct {
+	Name     *string `json:"name"`
+	Slug     *string `json:"slug"`
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	Image    *string `json:"image"`
+	Cover    *string `json:"cover"`
+	Bio      *string `json:"bio"`
+	Website  *string `json:"website"`
+	Location *string `json:"location"`
+}
+
+// apply updates the user with the same rules as the sign up form, except for
+// the password, which is only checked. It returns the status code of the error
+// if the body is invalid.
+func (b *apiv2UserBody) apply(u *model.User) (int, error) {
+	if b.Name != nil {
+		u.Name = strings.TrimSpace(*b.Name)
+	}
+	if len(u.Name) < 3 {
+		return http.StatusUnprocessableEntity, fmt.Errorf("Name is too short.")
+	}
+	if b.Slug != nil {
+		u.Slug = model.GenerateSlugFor(*b.Slug, "users", u.Id)
+	}
+	if b.Email != nil && *b.Email != u.Email {
+		if !rxEmail.MatchString(*b.Email) {
+			return http.StatusUnprocessableEntity, fmt.Errorf("Invalid email address.")
+		}
+		if (model.User{Email: *b.Email}).UserEmailExist() {
+			return http.StatusConflict, fmt.Errorf("The email %s is already taken.", *b.Email)
+		}
+		u.Email = *b.Email
+	}
+	if b.Password != nil {
+		if len(*b.Password) < 5 {
+			return http.StatusUnprocessableEntity, fmt.Errorf("Password is too short.")
+		}
+		if len(*b.Password) > 20 {
+			return http.StatusUnprocessableEntity, fmt.Errorf("Password is too long.")
+		}
+	}
+	if b.Image != nil {
+		u.Image = *b.Image
+	}
+	if b.Cover != nil {
+		u.Cover = *b.Cover
+	}
+	if b.Bio != nil {
+		u.Bio = *b.Bio
+	}
+	if b.Website != nil {
+		u.Website = strings.TrimSpace(*b.Website)
+	}
+	if b.Location != nil {
+		u.Location = strings.TrimSpace(*b.Location)
+	}
+	return 0, nil
+}
+
+// apiv2UserRef returns the fields of a user shown in the resources linked to
+// them.
+func apiv2UserRef(u *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   u.Id,
+		"name": u.Name,
+		"slug": u.Slug,
+		"url":  u.Url() + "/",
+	}
+}
+
+// apiv2User returns the fields of the user asked for. Their email and account
+// details are private, and the password hash is never shown.
+func apiv2User(u *model.User, private bool, f fieldSet) map[string]interface{} {
+	r := apiv2UserRef(u)
+	r["avatar"] = u.Avatar()
+	r["image"] = u.Image
+	r["cover"] = u.Cover
+	r["bio"] = u.Bio
+	r["website"] = u.Website
+	r["location"] = u.Location
+	if private {
+		r["email"] = u.Email
+		r["status"] = u.Status
+		r["language"] = u.Language
+		r["last_login"] = apiv2Time(u.Lastlogin)
+		r["created_at"] = apiv2Time(u.CreatedAt)
+		r["updated_at"] = apiv2Time(u.UpdatedAt)
+	}
+	return f.pick(r)
+}
+
+// apiv2UserRefSchema returns the schema of the users sent by apiv2UserRef.
+func apiv2UserRefSchema(doc *openapi.Document) *openapi.Schema {
+	return doc.AddSchema("UserRefV2", openapi.Object(map[string]*openapi.Schema{
+		"id":   openapi.Integer(),
+		"name": openapi.String(),
+		"slug": openapi.String(),
+		"url":  openapi.String(),
+	}, "id", "name", "slug", "url"))
+}
+
+// apiv2UserSchema returns the schema of the users sent by apiv2User.
+func apiv2UserSchema(doc *openapi.Document) *openapi.Schema {
+	private := "Only sent with a session token."
+	return doc.AddSchema("UserV2", openapi.Object(map[string]*openapi.Schema{
+		"id":         openapi.Integer(),
+		"name":       openapi.String(),
+		"slug":       openapi.String(),
+		"url":        openapi.String(),
+		"avatar":     openapi.String(),
+		"image":      openapi.String(),
+		"cover":      openapi.String(),
+		"bio":        openapi.String(),
+		"website":    openapi.String(),
+		"location":   openapi.String(),
+		"email":      openapi.String().Describe(private),
+		"status":     openapi.String().Describe(private),
+		"language":   openapi.String().Describe(private),
+		"last_login": openapi.DateTime().OrNull().Describe(private),
+		"created_at": openapi.DateTime().OrNull().Describe(private),
+		"updated_at": openapi.DateTime().OrNull().Describe(private),
+	}))
+}
+
+// apiv2FindUser finds the user with the ID or the slug in the URL.
+func apiv2FindUser(ctx *golf.Context) *model.User {
+	u := new(model.User)
+	var err error
+	if id, ok := apiv2Id(ctx, "id"); ok {
+		u.Id = id
+		err = u.GetUserById()
+	} else {
+		u.Slug = ctx.Param("id")
+		err = u.GetUserBySlug()
+	}
+	if err != nil {
+		apiv2Error(ctx, http.StatusNotFound, fmt.Errorf("No such user: %s", ctx.Param("id")))
+		return nil
+	}
+	return u
+}
+
+// APIv2UsersHandler lists the users.
+func APIv2UsersHandler(ctx *golf.Context) {
+	q, err := apiv2ListQuery(ctx, "id")
+	if err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	users := new(model.Users)
+	next, err := users.List(q)
+	if err != nil {
+		apiv2ListError(ctx, err)
+		return
+	}
+	private := apiv2Allowed(ctx, "")
+	fields := apiv2Fields(ctx)
+	items := make([]map[string]interface{}, len(*users))
+	for i, u := range *users {
+		items[i] = apiv2User(u, private, fields)
+	}
+	apiv2List(ctx, items, q, next)
+}
+
+// APIv2UserHandler retrieves the user with the given ID or slug.
+func APIv2UserHandler(ctx *golf.Context) {
+	if u := apiv2FindUser(ctx); u != nil {
+		private := apiv2Allowed(ctx, "")
+		apiv2Data(ctx, http.StatusOK, apiv2User(u, private, apiv2Fields(ctx)))
+	}
+}
+
+// APIv2UserCreateHandler creates a user from the JSON body, which must have
+// a name, an email and a password.
+func APIv2UserCreateHandler(ctx *golf.Context) {
+	var body apiv2UserBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if body.Email == nil || body.Password == nil {
+		apiv2Error(ctx, http.StatusUnprocessableEntity, fmt.Errorf("The email and the password are required."))
+		return
+	}
+	u := model.NewUser("", "")
+	if status, err := body.apply(u); err != nil {
+		apiv2Error(ctx, status, err)
+		return
+	}
+	if err := u.Create(*body.Password); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	if err := u.GetUserByEmail(); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Created(ctx, "/api/v2/users/"+strconv.FormatInt(u.Id, 10), apiv2User(u, true, nil))
+}
+
+// APIv2UserUpdateHandler updates the fields of the user given in the JSON
+// body, including their password.
+func APIv2UserUpdateHandler(ctx *golf.Context) {
+	u := apiv2FindUser(ctx)
+	if u == nil {
+		return
+	}
+	var body apiv2UserBody
+	if err := apiv2Decode(ctx, &body); err != nil {
+		apiv2Error(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if status, err := body.apply(u); err != nil {
+		apiv2Error(ctx, status, err)
+		return
+	}
+	u.UpdatedBy = int(apiv2UserId(ctx))
+	var err error
+	if body.Password != nil {
+		err = u.ChangePassword(*body.Password)
+	} else {
+		err = u.Update()
+	}
+	if err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2Data(ctx, http.StatusOK, apiv2User(u, true, nil))
+}
+
+// APIv2UserDeleteHandler deletes the user with the given ID or slug. Their
+// posts are kept, and users can't delete themselves.
+func APIv2UserDeleteHandler(ctx *golf.Context) {
+	u := apiv2FindUser(ctx)
+	if u == nil {
+		return
+	}
+	if u.Id == apiv2UserId(ctx) {
+		apiv2Error(ctx, http.StatusConflict, fmt.Errorf("You can not delete yourself."))
+		return
+	}
+	if err := model.DeleteUser(u.Id); err != nil {
+		apiv2Error(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	apiv2NoContent(ctx)
+}
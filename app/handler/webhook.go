@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/dinever/golf"
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+// webhookLogSize is the number of deliveries shown on the webhooks page.
+const webhookLogSize = 50
+
+// WebhookViewHandler lists the webhooks and their latest deliveries.
+func WebhookViewHandler(ctx *golf.Context) {
+	user, _ := ctx.Session.Get("user")
+	webhooks := new(model.Webhooks)
+	if err := webhooks.GetAllWebhooks(); err != nil {
+		ctx.Abort(500)
+		return
+	}
+	deliveries := new(model.WebhookDeliveries)
+	if err := deliveries.GetRecentWebhookDeliveries(webhookLogSize); err != nil {
+		ctx.Abort(500)
+		return
+	}
+	ctx.Loader("admin").Render("webhooks.html", map[string]interface{}{
+		"Title":      "Webhooks",
+		"User":       user,
+		"Webhooks":   webhooks,
+		"Deliveries": deliveries,
+		"Events":     model.WebhookEvents,
+	})
+}
+
+// WebhookSaveHandler adds a webhook, or updates the one given by "id". The
+// secret of an existing webhook is kept when none is given.
+func WebhookSaveHandler(ctx *golf.Context) {
+	userObj, _ := ctx.Session.Get("user")
+	u := userObj.(*model.User)
+	ctx.Request.ParseForm()
+	w := model.NewWebhook(ctx.Request.FormValue("url"), ctx.Request.Form["event"], ctx.Request.FormValue("secret"))
+	w.Active = ctx.Request.FormValue("active") == "on"
+	w.CreatedBy = u.Id
+	if id, _ := strconv.Atoi(ctx.Request.FormValue("id")); id > 0 {
+		current := &model.Webhook{Id: int64(id)}
+		if err := current.GetWebhookById(); err != nil {
+			ctx.JSON(map[string]interface{}{
+				"status": "error",
+				"msg":    "Webhook not found.",
+			})
+			return
+		}
+		w.Id, w.CreatedAt, w.CreatedBy = current.Id, current.CreatedAt, current.CreatedBy
+		if w.Secret == "" {
+			w.Secret = current.Secret
+		}
+	}
+	if err := w.Save(); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+		"secret": w.Secret,
+	})
+}
+
+// WebhookRemoveHandler deletes a webhook and its deliveries.
+func WebhookRemoveHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	if err := model.DeleteWebhook(int64(id)); err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
+
+// WebhookRedeliverHandler queues the payload of a delivery again.
+func WebhookRedeliverHandler(ctx *golf.Context) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	d := &model.WebhookDelivery{Id: int64(id)}
+	err := d.GetWebhookDeliveryById()
+	if err == nil {
+		err = d.Redeliver()
+	}
+	if err != nil {
+		ctx.JSON(map[string]interface{}{
+			"status": "error",
+			"msg":    err.Error(),
+		})
+		return
+	}
+	ctx.JSON(map[string]interface{}{
+		"status": "success",
+	})
+}
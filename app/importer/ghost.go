@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+func init() {
+	Register("ghost", new(Ghost))
+}
+
+// Ghost imports a Ghost JSON export, as created by "Labs > Export your
+// content" in the Ghost admin.
+type Ghost struct{}
+
+// ghostID is the ID of a Ghost object, which is a number in old exports and
+// a string in newer ones.
+type ghostID string
+
+func (id *ghostID) UnmarshalJSON(b []byte) error {
+	*id = ghostID(strings.Trim(string(b), `"`))
+	return nil
+}
+
+type ghostData struct {
+	Posts []struct {
+		Id              ghostID `json:"id"`
+		Title           string  `json:"title"`
+		Slug            string  `json:"slug"`
+		Mobiledoc       string  `json:"mobiledoc"`
+		Markdown        string  `json:"markdown"`
+		Html            string  `json:"html"`
+		FeatureImage    string  `json:"feature_image"`
+		Image           string  `json:"image"`
+		Featured        bool    `json:"featured"`
+		Page            bool    `json:"page"`
+		Type            string  `json:"type"`
+		Status          string  `json:"status"`
+		Language        string  `json:"language"`
+		MetaTitle       string  `json:"meta_title"`
+		MetaDescription string  `json:"meta_description"`
+		AuthorId        ghostID `json:"author_id"`
+		CreatedAt       string  `json:"created_at"`
+		UpdatedAt       string  `json:"updated_at"`
+		PublishedAt     string  `json:"published_at"`
+	} `json:"posts"`
+	Tags []struct {
+		Id   ghostID `json:"id"`
+		Name string  `json:"name"`
+	} `json:"tags"`
+	PostsTags []struct {
+		PostId ghostID `json:"post_id"`
+		TagId  ghostID `json:"tag_id"`
+	} `json:"posts_tags"`
+	Users []struct {
+		Id      ghostID `json:"id"`
+		Name    string  `json:"name"`
+		Slug    string  `json:"slug"`
+		Email   string  `json:"email"`
+		Bio     string  `json:"bio"`
+		Website string  `json:"website"`
+	} `json:"users"`
+	PostsAuthors []struct {
+		PostId   ghostID `json:"post_id"`
+		AuthorId ghostID `json:"author_id"`
+	} `json:"posts_authors"`
+}
+
+type ghostExport struct {
+	Db []struct {
+		Data ghostData `json:"data"`
+	} `json:"db"`
+	Data *ghostData `json:"data"`
+}
+
+type mobiledoc struct {
+	Cards [][]json.RawMessage `json:"cards"`
+}
+
+// Parse reads the Ghost JSON export at the given path. Both the current
+// format, wrapped in a "db" list, and the older unwrapped one are accepted.
+func (g *Ghost) Parse(path string) (*Site, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	export := new(ghostExport)
+	if err = json.Unmarshal(b, export); err != nil {
+		return nil, err
+	}
+	data := export.Data
+	if len(export.Db) > 0 {
+		data = &export.Db[0].Data
+	}
+	site := new(Site)
+	if data == nil {
+		return site, nil
+	}
+
+	for _, u := range data.Users {
+		site.Users = append(site.Users, &User{
+			Key:     string(u.Id),
+			Name:    u.Name,
+			Slug:    u.Slug,
+			Email:   u.Email,
+			Bio:     u.Bio,
+			Website: u.Website,
+		})
+	}
+	tags := make(map[ghostID]string)
+	for _, t := range data.Tags {
+		tags[t.Id] = t.Name
+	}
+	postTags := make(map[ghostID][]string)
+	for _, pt := range data.PostsTags {
+		if name, ok := tags[pt.TagId]; ok {
+			postTags[pt.PostId] = append(postTags[pt.PostId], name)
+		}
+	}
+	// Posts can have several authors, only the first one is kept.
+	authors := make(map[ghostID]ghostID)
+	for _, pa := range data.PostsAuthors {
+		if _, ok := authors[pa.PostId]; !ok {
+			authors[pa.PostId] = pa.AuthorId
+		}
+	}
+
+	for _, gp := range data.Posts {
+		p := model.NewPost()
+		p.Title = gp.Title
+		p.Slug = gp.Slug
+		p.Markdown = ghostMarkdown(gp.Mobiledoc, gp.Markdown, gp.Html)
+		p.Image = gp.FeatureImage
+		if p.Image == "" {
+			p.Image = gp.Image
+		}
+		p.IsFeatured = gp.Featured
+		p.IsPage = gp.Page || gp.Type == "page"
+		p.IsPublished = gp.Status == "published"
+		p.Language = gp.Language
+		p.MetaTitle = gp.MetaTitle
+		p.MetaDescription = gp.MetaDescription
+		p.CreatedAt = parseTime(gp.CreatedAt)
+		p.UpdatedAt = parseTime(gp.UpdatedAt)
+		if p.IsPublished {
+			p.PublishedAt = parseTime(gp.PublishedAt)
+		}
+		author, ok := authors[gp.Id]
+		if !ok {
+			author = gp.AuthorId
+		}
+		site.Posts = append(site.Posts, &Post{Post: p, Tags: postTags[gp.Id], Author: string(author)})
+	}
+	return site, nil
+}
+
+// ghostMarkdown returns the markdown of a Ghost post. Newer exports keep it in
+// the markdown cards of the mobiledoc, older ones in a field of its own. Posts
+// written with the rich editor have no markdown at all, so their HTML is used.
+func ghostMarkdown(doc, markdown, html string) string {
+	if doc != "" {
+		md := new(mobiledoc)
+		if err := json.Unmarshal([]byte(doc), md); err == nil {
+			var parts []string
+			for _, card := range md.Cards {
+				if len(card) < 2 {
+					continue
+				}
+				var payload struct {
+					Markdown string `json:"markdown"`
+				}
+				if err := json.Unmarshal(card[1], &payload); err == nil && payload.Markdown != "" {
+					parts = append(parts, payload.Markdown)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, "\n\n")
+			}
+		}
+	}
+	if markdown != "" {
+		return markdown
+	}
+	return html
+}
@@ -0,0 +1,370 @@
+// Package importer imports content exported from other blogging platforms.
+// Every supported platform registers an Importer, which parses the export into
+// a Site. The Site is then written to the DB by Run, which can also do a dry
+// run that only reports what would happen.
+package importer
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// An Importer parses the export of another blogging platform. The path is
+// either a file or a directory, depending on the platform.
+type Importer interface {
+	Parse(path string) (*Site, error)
+}
+
+var importers = make(map[string]Importer)
+
+// Register makes an importer available under the given name.
+func Register(name string, i Importer) {
+	importers[name] = i
+}
+
+// Names returns the names of all registered importers, sorted.
+func Names() []string {
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Site is the content parsed from an export, before it is imported.
+type Site struct {
+	Users []*User
+	Posts []*Post
+}
+
+// A User is an author found in an export. Key is the identifier used by the
+// export to refer to the user, and is matched against Post.Author.
+type User struct {
+	Key     string
+	Name    string
+	Slug    string
+	Email   string
+	Bio     string
+	Website string
+}
+
+// A Post is a post or page found in an export, along with its tags, author
+// and comments.
+type Post struct {
+	Post     *model.Post
+	Tags     []string
+	Author   string
+	Comments []*Comment
+}
+
+// A Comment is a comment found in an export. Key and Parent are the
+// identifiers used by the export, and are used to rebuild the comment tree.
+type Comment struct {
+	Key     string
+	Parent  string
+	Comment *model.Comment
+}
+
+// Options control how a Site is imported.
+type Options struct {
+	// DryRun only builds the report, without writing anything.
+	DryRun bool
+	// By is the ID of the user that imported posts are attributed to when
+	// their author can't be found or created.
+	By int64
+	// SaveImage stores a downloaded image and returns its new URL. Remote
+	// images are left alone if it is nil.
+	SaveImage func(name string, r io.Reader) (string, error)
+}
+
+// A Report describes the outcome of an import.
+type Report struct {
+	DryRun    bool        `json:"dry_run"`
+	Posts     int         `json:"posts"`
+	Pages     int         `json:"pages"`
+	Users     int         `json:"users"`
+	Tags      int         `json:"tags"`
+	Comments  int         `json:"comments"`
+	Images    int         `json:"images"`
+	Conflicts []*Conflict `json:"conflicts"`
+	Errors    []string    `json:"errors"`
+}
+
+// A Conflict is a post whose slug is already used by an existing post, or by
+// a route of the blog. The imported post is saved under NewSlug instead,
+// which is only known once the import is no longer a dry run.
+type Conflict struct {
+	Title   string `json:"title"`
+	Slug    string `json:"slug"`
+	NewSlug string `json:"new_slug"`
+}
+
+// imageExts are the extensions given to downloaded images whose URL has none.
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var rxRemoteImage = regexp.MustCompile(`(?:!\[[^\]]*\]\(|<img[^>]+src=["'])(https?://[^\s"')]+)`)
+
+// Import parses the export at the given path with the named importer, and
+// imports it.
+func Import(name, path string, opts Options) (*Report, error) {
+	i, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown importer %q", name)
+	}
+	site, err := i.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	return Run(site, opts)
+}
+
+// Run imports the given site, preserving slugs and publish dates wherever
+// they don't conflict with existing content.
+func Run(site *Site, opts Options) (*Report, error) {
+	r := &Report{DryRun: opts.DryRun, Conflicts: make([]*Conflict, 0), Errors: make([]string, 0)}
+	users := make(map[string]int64)
+	for _, u := range site.Users {
+		id, created, err := importUser(u, opts)
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("user %s: %v", u.Name, err))
+			continue
+		}
+		users[u.Key] = id
+		if created {
+			r.Users++
+		}
+	}
+
+	tags := make(map[string]bool)
+	images := make(map[string]string)
+	for _, ip := range site.Posts {
+		p := ip.Post
+		if p.IsPage {
+			r.Pages++
+		} else {
+			r.Posts++
+		}
+		for _, t := range ip.Tags {
+			tags[strings.ToLower(t)] = true
+		}
+		r.Comments += len(ip.Comments)
+
+		var conflict *Conflict
+		if p.Slug == "" {
+			p.Slug = model.GenerateSlug(p.Title, "posts")
+		} else if model.ValidatePostSlug(p.Slug) != nil {
+			// The slug is taken by a route of the blog.
+			conflict = &Conflict{Title: p.Title, Slug: p.Slug}
+			r.Conflicts = append(r.Conflicts, conflict)
+			p.Slug = model.GenerateSlug(p.Slug, "posts")
+		} else if !model.PostChangeSlug(p.Slug) {
+			conflict = &Conflict{Title: p.Title, Slug: p.Slug}
+			r.Conflicts = append(r.Conflicts, conflict)
+		}
+
+		for _, m := range rxRemoteImage.FindAllStringSubmatch(p.Markdown+"\n"+markdownImage(p.Image), -1) {
+			src := m[1]
+			if _, ok := images[src]; ok {
+				continue
+			}
+			r.Images++
+			images[src] = src
+			if opts.DryRun || opts.SaveImage == nil {
+				continue
+			}
+			if u, err := downloadImage(src, opts.SaveImage); err != nil {
+				r.Errors = append(r.Errors, fmt.Sprintf("image %s: %v", src, err))
+			} else {
+				images[src] = u
+			}
+		}
+		if opts.DryRun {
+			continue
+		}
+
+		for src, u := range images {
+			p.Markdown = strings.Replace(p.Markdown, src, u, -1)
+			if p.Image == src {
+				p.Image = u
+			}
+		}
+		if err := importPost(ip, users, opts.By); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("post %s: %v", p.Title, err))
+			continue
+		}
+		if conflict != nil {
+			conflict.NewSlug = p.Slug
+		}
+	}
+	r.Tags = len(tags)
+	return r, nil
+}
+
+// importUser finds the user with the same email, or creates a new one with a
+// random password. It reports whether a new user was, or would be, created.
+func importUser(u *User, opts Options) (int64, bool, error) {
+	if u.Email == "" {
+		return opts.By, false, nil
+	}
+	existing := &model.User{Email: u.Email}
+	if err := existing.GetUserByEmail(); err == nil {
+		return existing.Id, false, nil
+	}
+	if opts.DryRun {
+		return opts.By, true, nil
+	}
+	nu := model.NewUser(u.Email, u.Name)
+	slug := u.Slug
+	if slug == "" {
+		slug = u.Name
+	}
+	nu.Slug = model.GenerateSlug(slug, "users")
+	nu.Bio = u.Bio
+	nu.Website = u.Website
+	if err := nu.Create(randomPassword()); err != nil {
+		return 0, false, err
+	}
+	if err := nu.GetUserByEmail(); err != nil {
+		return 0, false, err
+	}
+	return nu.Id, true, nil
+}
+
+// importPost inserts the post with its tags and comments. Unlike Post.Save,
+// it keeps the creation, update and publish dates from the export.
+func importPost(ip *Post, users map[string]int64, by int64) error {
+	p := ip.Post
+	author, ok := users[ip.Author]
+	if !ok {
+		author = by
+	}
+	p.CreatedBy = author
+	p.UpdatedBy = author
+	if p.CreatedAt == nil {
+		p.CreatedAt = utils.Now()
+	}
+	if p.UpdatedAt == nil {
+		p.UpdatedAt = p.CreatedAt
+	}
+	if p.IsPublished {
+		p.PublishedBy = author
+		if p.PublishedAt == nil {
+			p.PublishedAt = p.CreatedAt
+		}
+	}
+	p.Html = utils.Markdown2Html(p.Markdown)
+	p.CommentNum = int64(len(ip.Comments))
+	if err := p.Insert(); err != nil {
+		return err
+	}
+	for _, t := range model.GenerateTagsFromCommaString(strings.Join(ip.Tags, ",")) {
+		t.CreatedBy = author
+		t.Hidden = !p.IsPublished
+		if err := t.Save(); err != nil {
+			return err
+		}
+		if err := model.InsertPostTag(p.Id, t.Id); err != nil {
+			return err
+		}
+	}
+	if err := model.UpdatePostMediaRefs(p); err != nil {
+		return err
+	}
+	return importComments(p.Id, ip.Comments)
+}
+
+// importComments saves the comments of a post, parents before their
+// children, so that the parent IDs can be mapped to the new comment IDs.
+func importComments(postId int64, comments []*Comment) error {
+	ids := map[string]int64{"": 0, "0": 0}
+	pending := comments
+	for len(pending) > 0 {
+		var next []*Comment
+		for _, c := range pending {
+			parent, ok := ids[c.Parent]
+			if !ok {
+				next = append(next, c)
+				continue
+			}
+			c.Comment.PostId = postId
+			c.Comment.Parent = parent
+			if err := c.Comment.Import(); err != nil {
+				return err
+			}
+			ids[c.Key] = c.Comment.Id
+		}
+		if len(next) == len(pending) {
+			// The remaining comments reference parents that don't exist.
+			for _, c := range next {
+				c.Parent = ""
+			}
+		}
+		pending = next
+	}
+	return nil
+}
+
+func downloadImage(src string, save func(string, io.Reader) (string, error)) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(src)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	name := "image"
+	if u, err := url.Parse(src); err == nil && path.Base(u.Path) != "/" {
+		name = path.Base(u.Path)
+	}
+	// Uploads are only accepted with an extension that matches their content.
+	if path.Ext(name) == "" {
+		name += imageExts[strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0]]
+	}
+	return save(name, resp.Body)
+}
+
+// markdownImage wraps the URL of a featured image, so that it is found by the
+// same pattern as images inside the content.
+func markdownImage(src string) string {
+	if src == "" {
+		return ""
+	}
+	return "![](" + src + ")"
+}
+
+func randomPassword() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// parseTime parses the date formats found in the supported exports, returning
+// nil if the date is missing or invalid.
+func parseTime(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", time.RFC1123Z} {
+		if t, err := time.Parse(layout, s); err == nil && !t.IsZero() && t.Year() > 1 {
+			return &t
+		}
+	}
+	return nil
+}
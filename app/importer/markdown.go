@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	Register("markdown", new(Markdown))
+}
+
+// Markdown imports markdown files with YAML front matter, as used by static
+// site generators such as Hexo and Jekyll. The path is either a directory,
+// which is searched recursively, or a zip archive of one.
+type Markdown struct{}
+
+type frontMatter struct {
+	Title       string      `yaml:"title"`
+	Slug        string      `yaml:"slug"`
+	Permalink   string      `yaml:"permalink"`
+	Date        interface{} `yaml:"date"`
+	Updated     interface{} `yaml:"updated"`
+	Tags        interface{} `yaml:"tags"`
+	Categories  interface{} `yaml:"categories"`
+	Category    interface{} `yaml:"category"`
+	Layout      string      `yaml:"layout"`
+	Published   *bool       `yaml:"published"`
+	Draft       bool        `yaml:"draft"`
+	Author      string      `yaml:"author"`
+	Image       string      `yaml:"image"`
+	Cover       string      `yaml:"cover"`
+	Description string      `yaml:"description"`
+	MetaTitle   string      `yaml:"meta_title"`
+	MetaDesc    string      `yaml:"meta_description"`
+	Comments    *bool       `yaml:"comments"`
+}
+
+// rxJekyllName matches Jekyll post file names, which start with the publish
+// date, followed by the slug.
+var rxJekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// Parse reads every .md and .markdown file below the given path.
+func (m *Markdown) Parse(p string) (*Site, error) {
+	files := make(map[string][]byte)
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || !isMarkdownFile(zf.Name) {
+				continue
+			}
+			r, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[zf.Name] = b
+		}
+	} else {
+		err := filepath.Walk(p, func(fp string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !isMarkdownFile(fp) {
+				return err
+			}
+			b, err := ioutil.ReadFile(fp)
+			if err != nil {
+				return err
+			}
+			files[fp] = b
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	site := new(Site)
+	for name, b := range files {
+		ip, err := parseMarkdownFile(name, b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		site.Posts = append(site.Posts, ip)
+	}
+	return site, nil
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// parseMarkdownFile splits the front matter from the content, and maps it to
+// a post. Anything below a "_drafts" directory is imported as a draft, and
+// so is anything in a "_pages" directory or with a "page" layout as a page.
+func parseMarkdownFile(name string, b []byte) (*Post, error) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	content := strings.Replace(string(b), "\r\n", "\n", -1)
+	fm := new(frontMatter)
+	if strings.HasPrefix(content, "---\n") {
+		end := strings.Index(content[4:], "\n---")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated front matter")
+		}
+		if err := yaml.Unmarshal([]byte(content[4:4+end]), fm); err != nil {
+			return nil, err
+		}
+		content = strings.TrimPrefix(content[4+end+4:], "\n")
+	}
+
+	name = filepath.ToSlash(name)
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	p := model.NewPost()
+	p.Title = fm.Title
+	p.Markdown = strings.TrimSpace(content)
+	p.Slug = fm.Slug
+	if p.Slug == "" && fm.Permalink != "" {
+		p.Slug = strings.Trim(fm.Permalink, "/")
+	}
+	date := frontMatterTime(fm.Date)
+	if match := rxJekyllName.FindStringSubmatch(base); match != nil {
+		if date == nil {
+			date = parseTime(match[1])
+		}
+		base = match[2]
+	}
+	if p.Slug == "" && base != "index" {
+		p.Slug = base
+	}
+	if p.Title == "" {
+		p.Title = base
+	}
+	p.IsPage = fm.Layout == "page" || strings.Contains(name, "_pages/")
+	p.IsPublished = !fm.Draft && !strings.Contains(name, "_drafts/")
+	if fm.Published != nil {
+		p.IsPublished = p.IsPublished && *fm.Published
+	}
+	if fm.Comments != nil {
+		p.AllowComment = *fm.Comments
+	}
+	p.Image = fm.Image
+	if p.Image == "" {
+		p.Image = fm.Cover
+	}
+	p.MetaTitle = fm.MetaTitle
+	p.MetaDescription = fm.MetaDesc
+	if p.MetaDescription == "" {
+		p.MetaDescription = fm.Description
+	}
+	p.CreatedAt = date
+	p.UpdatedAt = frontMatterTime(fm.Updated)
+	if p.IsPublished {
+		p.PublishedAt = date
+	}
+
+	ip := &Post{Post: p, Author: fm.Author}
+	ip.Tags = append(frontMatterList(fm.Categories), frontMatterList(fm.Category)...)
+	ip.Tags = append(ip.Tags, frontMatterList(fm.Tags)...)
+	return ip, nil
+}
+
+// frontMatterTime converts a date from the front matter, which the YAML
+// decoder returns either as a string or as a time.
+func frontMatterTime(v interface{}) *time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return &t
+	case string:
+		return parseTime(t)
+	}
+	return nil
+}
+
+// frontMatterList converts tags and categories from the front matter, which
+// are either a list, a nested list (Hexo category hierarchies) or a single
+// comma or space separated string.
+func frontMatterList(v interface{}) []string {
+	var list []string
+	switch t := v.(type) {
+	case string:
+		sep := ","
+		if !strings.Contains(t, ",") {
+			sep = " "
+		}
+		for _, s := range strings.Split(t, sep) {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	case []interface{}:
+		for _, item := range t {
+			list = append(list, frontMatterList(item)...)
+		}
+	case nil:
+	default:
+		list = append(list, fmt.Sprint(t))
+	}
+	return list
+}
@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/model"
+)
+
+func init() {
+	Register("wordpress", new(WordPress))
+}
+
+// WordPress imports a WordPress eXtended RSS (WXR) file, as created by
+// "Tools > Export" in the WordPress admin.
+type WordPress struct{}
+
+type wxr struct {
+	Channel struct {
+		Authors []struct {
+			Login       string `xml:"author_login"`
+			Email       string `xml:"author_email"`
+			DisplayName string `xml:"author_display_name"`
+		} `xml:"author"`
+		Items []struct {
+			Title      string `xml:"title"`
+			Creator    string `xml:"creator"`
+			Content    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			PostId     string `xml:"post_id"`
+			PostDate   string `xml:"post_date_gmt"`
+			PostName   string `xml:"post_name"`
+			Status     string `xml:"status"`
+			PostType   string `xml:"post_type"`
+			Open       string `xml:"comment_status"`
+			Categories []struct {
+				Domain   string `xml:"domain,attr"`
+				Nicename string `xml:"nicename,attr"`
+				Name     string `xml:",chardata"`
+			} `xml:"category"`
+			Comments []struct {
+				Id       string `xml:"comment_id"`
+				Author   string `xml:"comment_author"`
+				Email    string `xml:"comment_author_email"`
+				Url      string `xml:"comment_author_url"`
+				Ip       string `xml:"comment_author_IP"`
+				Date     string `xml:"comment_date_gmt"`
+				Content  string `xml:"comment_content"`
+				Approved string `xml:"comment_approved"`
+				Type     string `xml:"comment_type"`
+				Parent   string `xml:"comment_parent"`
+			} `xml:"comment"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Parse reads the WXR file at the given path. Only posts and pages are
+// imported, attachments and navigation items are skipped. WordPress content
+// is HTML, which is kept as is since markdown allows inline HTML.
+func (w *WordPress) Parse(path string) (*Site, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc := new(wxr)
+	d := xml.NewDecoder(f)
+	d.Strict = false
+	if err = d.Decode(doc); err != nil {
+		return nil, err
+	}
+
+	site := new(Site)
+	for _, a := range doc.Channel.Authors {
+		site.Users = append(site.Users, &User{
+			Key:   a.Login,
+			Name:  a.DisplayName,
+			Slug:  a.Login,
+			Email: a.Email,
+		})
+	}
+	for _, item := range doc.Channel.Items {
+		if item.PostType != "post" && item.PostType != "page" {
+			continue
+		}
+		if item.Status == "trash" || item.Status == "auto-draft" {
+			continue
+		}
+		p := model.NewPost()
+		p.Title = item.Title
+		p.Slug = item.PostName
+		p.Markdown = item.Content
+		p.IsPage = item.PostType == "page"
+		p.IsPublished = item.Status == "publish"
+		p.AllowComment = item.Open == "open"
+		if t := parseTime(item.PostDate); t != nil {
+			p.CreatedAt = t
+			if p.IsPublished {
+				p.PublishedAt = t
+			}
+		}
+		ip := &Post{Post: p, Author: item.Creator}
+		for _, c := range item.Categories {
+			name := strings.TrimSpace(c.Name)
+			if (c.Domain == "post_tag" || c.Domain == "category") && name != "" && c.Nicename != "uncategorized" {
+				ip.Tags = append(ip.Tags, name)
+			}
+		}
+		for _, c := range item.Comments {
+			if c.Approved == "spam" || c.Approved == "trash" {
+				continue
+			}
+			comment := model.NewComment()
+			comment.Author = c.Author
+			comment.Email = c.Email
+			comment.Website = c.Url
+			comment.Ip = c.Ip
+			comment.Content = c.Content
+			comment.Approved = c.Approved == "1"
+			comment.Type = c.Type
+			if t := parseTime(c.Date); t != nil {
+				comment.CreatedAt = t
+			}
+			ip.Comments = append(ip.Comments, &Comment{Key: c.Id, Parent: c.Parent, Comment: comment})
+		}
+		site.Posts = append(site.Posts, ip)
+	}
+	return site, nil
+}
@@ -0,0 +1,125 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/russross/blackfriday"
+)
+
+// DefaultHighlightStyle is the style of the highlighted code unless another
+// is chosen in the "highlight_style" setting.
+const DefaultHighlightStyle = "github"
+
+// rxFenceLines matches the opening of a fenced code block with highlighted
+// lines, such as "```go {3-5}". Blackfriday only allows a single word or a
+// block in braces after the fence, so the lines are moved into the braces
+// before rendering, as in "```{go lines=3-5}".
+var rxFenceLines = regexp.MustCompile("(?m)^([ ]{0,3})(```+|~~~+)[ \t]*([^\\s{}`]*)[ \t]*\\{([0-9, \t-]+)\\}[ \t]*$")
+
+// highlightRenderer highlights the code blocks with chroma. The highlighted
+// code uses CSS classes, so the style can be changed without rendering the
+// posts again, see HighlightCSS.
+type highlightRenderer struct {
+	blackfriday.Renderer
+	lineNumbers bool
+}
+
+func (r *highlightRenderer) BlockCode(out *bytes.Buffer, text []byte, info string) {
+	lang, lines := parseCodeInfo(info)
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(text))
+	if err != nil {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+	var b bytes.Buffer
+	f := html.New(
+		html.WithClasses(true),
+		html.WithLineNumbers(r.lineNumbers),
+		html.HighlightLines(lines),
+		html.TabWidth(4),
+	)
+	if err := f.Format(&b, styles.Fallback, iterator); err != nil {
+		r.Renderer.BlockCode(out, text, lang)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	out.Write(b.Bytes())
+}
+
+// parseCodeInfo returns the language of a code block, and the ranges of the
+// lines to highlight, from its info string, such as "go lines=3-5,8".
+func parseCodeInfo(info string) (string, [][2]int) {
+	fields := strings.Fields(info)
+	lang := ""
+	var lines [][2]int
+	for _, f := range fields {
+		if !strings.HasPrefix(f, "lines=") {
+			if lang == "" {
+				lang = f
+			}
+			continue
+		}
+		for _, r := range strings.Split(strings.TrimPrefix(f, "lines="), ",") {
+			bounds := strings.SplitN(r, "-", 2)
+			start, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				continue
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+					continue
+				}
+			}
+			lines = append(lines, [2]int{start, end})
+		}
+	}
+	return lang, lines
+}
+
+// moveFenceLines rewrites the highlighted lines of fenced code blocks into a
+// form blackfriday accepts, see rxFenceLines. Unless keep is set, the lines
+// are dropped instead, as only highlightRenderer knows about them.
+func moveFenceLines(text string, keep bool) string {
+	return rxFenceLines.ReplaceAllStringFunc(text, func(line string) string {
+		m := rxFenceLines.FindStringSubmatch(line)
+		if !keep {
+			return m[1] + m[2] + m[3]
+		}
+		lines := strings.Join(strings.Fields(m[4]), "")
+		return m[1] + m[2] + "{" + strings.TrimSpace(m[3]+" lines="+lines) + "}"
+	})
+}
+
+// HighlightCSS returns the CSS of the given highlight style, falling back to
+// DefaultHighlightStyle if there is no such style.
+func HighlightCSS(style string) (string, error) {
+	s, ok := styles.Registry[style]
+	if !ok {
+		s = styles.Get(DefaultHighlightStyle)
+	}
+	var b bytes.Buffer
+	f := html.New(html.WithClasses(true), html.WithLineNumbers(true))
+	if err := f.WriteCSS(&b, s); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// HighlightStyles returns the names of the highlight styles, sorted.
+func HighlightStyles() []string {
+	return styles.Names()
+}
@@ -0,0 +1,271 @@
+// Package markdown renders the markdown of posts into HTML. Rendering is a
+// pipeline: blackfriday with the chosen extensions, then a sanitizer policy
+// which removes unsafe HTML such as scripts, then the chosen post-processors.
+// Math and shortcodes are taken out before blackfriday, and their HTML is put
+// back after sanitizing. Sanitizers, post-processors and shortcodes are
+// registered by name, and the pipeline is chosen by the "markdown_*"
+// settings.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/russross/blackfriday"
+)
+
+// The extensions and HTML flags which are always on, as they were before the
+// pipeline could be configured.
+const (
+	commonExtensions = blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+		blackfriday.EXTENSION_TABLES |
+		blackfriday.EXTENSION_FENCED_CODE |
+		blackfriday.EXTENSION_SPACE_HEADERS |
+		blackfriday.EXTENSION_HEADER_IDS |
+		blackfriday.EXTENSION_BACKSLASH_LINE_BREAK |
+		blackfriday.EXTENSION_DEFINITION_LISTS
+	commonHtmlFlags = blackfriday.HTML_USE_XHTML |
+		blackfriday.HTML_USE_SMARTYPANTS |
+		blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+		blackfriday.HTML_SMARTYPANTS_DASHES |
+		blackfriday.HTML_SMARTYPANTS_LATEX_DASHES
+)
+
+// extensions are the optional markdown extensions, along with the blackfriday
+// extensions and HTML flags they turn on. The extensions which aren't
+// supported by blackfriday are rendered by the wrapping renderers, such as
+// taskListRenderer, or before and after blackfriday, as math and shortcodes.
+var extensions = map[string]struct{ extensions, flags int }{
+	"footnotes":     {blackfriday.EXTENSION_FOOTNOTES, blackfriday.HTML_FOOTNOTE_RETURN_LINKS},
+	"tasklists":     {0, 0},
+	"anchors":       {blackfriday.EXTENSION_AUTO_HEADER_IDS, 0},
+	"toc":           {0, blackfriday.HTML_TOC},
+	"strikethrough": {blackfriday.EXTENSION_STRIKETHROUGH, 0},
+	"autolinks":     {blackfriday.EXTENSION_AUTOLINK, 0},
+	"highlight":     {0, 0},
+	"linenumbers":   {0, 0},
+	"math":          {0, 0},
+	"mermaid":       {0, 0},
+	"shortcodes":    {0, 0},
+}
+
+// A Sanitizer removes the HTML which isn't allowed by its policy.
+type Sanitizer func(string) string
+
+// A PostProcessor rewrites the sanitized HTML. As it runs after the
+// sanitizer, it may add attributes the sanitizer wouldn't allow.
+type PostProcessor func(html string, c Config) string
+
+var (
+	sanitizers     = make(map[string]Sanitizer)
+	postProcessors = make(map[string]PostProcessor)
+)
+
+// Config is the configuration of the pipeline.
+type Config struct {
+	Extensions     []string
+	Sanitizer      string
+	PostProcessors []string
+	// Host is the host of the blog, so that links to it are not external.
+	Host string
+}
+
+var current struct {
+	sync.RWMutex
+	config Config
+}
+
+func init() {
+	current.config = DefaultConfig()
+}
+
+// DefaultConfig returns the configuration used until another is chosen.
+func DefaultConfig() Config {
+	return Config{
+		Extensions:     []string{"footnotes", "tasklists", "anchors", "strikethrough", "autolinks", "highlight", "math", "mermaid", "shortcodes"},
+		Sanitizer:      "ugc",
+		PostProcessors: []string{},
+	}
+}
+
+// Validate checks that the extensions, sanitizer and post-processors of the
+// configuration exist.
+func (c Config) Validate() error {
+	for _, e := range c.Extensions {
+		if _, ok := extensions[e]; !ok {
+			return fmt.Errorf("Unknown markdown extension: %s", e)
+		}
+	}
+	if _, ok := sanitizers[c.Sanitizer]; !ok {
+		return fmt.Errorf("Unknown sanitizer: %s", c.Sanitizer)
+	}
+	for _, p := range c.PostProcessors {
+		if _, ok := postProcessors[p]; !ok {
+			return fmt.Errorf("Unknown post-processor: %s", p)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the given extension is on.
+func (c Config) Has(extension string) bool {
+	for _, e := range c.Extensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// Uses reports whether the given post-processor is on.
+func (c Config) Uses(postProcessor string) bool {
+	for _, p := range c.PostProcessors {
+		if p == postProcessor {
+			return true
+		}
+	}
+	return false
+}
+
+// Render renders the markdown text into sanitized HTML.
+func (c Config) Render(text string) string {
+	ext, flags := commonExtensions, commonHtmlFlags
+	for _, e := range c.Extensions {
+		ext |= extensions[e].extensions
+		flags |= extensions[e].flags
+	}
+	var ph *placeholders
+	if c.Has("math") || c.Has("shortcodes") {
+		ph = newPlaceholders()
+		text = ph.protectCode(text)
+		if c.Has("shortcodes") {
+			text = ph.extractShortcodes(text, c)
+		}
+		if c.Has("math") {
+			text = ph.extractMath(text)
+		}
+		text = ph.restoreCode(text)
+	}
+	renderer := blackfriday.HtmlRenderer(flags, "", "")
+	if c.Has("tasklists") {
+		renderer = &taskListRenderer{renderer}
+	}
+	if c.Has("highlight") {
+		renderer = &highlightRenderer{renderer, c.Has("linenumbers")}
+	}
+	if c.Has("mermaid") {
+		renderer = &mermaidRenderer{renderer}
+	}
+	text = moveFenceLines(text, c.Has("highlight"))
+	html := string(blackfriday.Markdown([]byte(text), renderer, ext))
+	// An unknown sanitizer must not let unsafe HTML through.
+	sanitize, ok := sanitizers[c.Sanitizer]
+	if !ok {
+		sanitize = sanitizers["ugc"]
+	}
+	html = sanitize(html)
+	if ph != nil {
+		html = ph.restoreHtml(ph.dropHeadingIds(html))
+	}
+	for _, name := range c.PostProcessors {
+		if p, ok := postProcessors[name]; ok {
+			html = p(html, c)
+		}
+	}
+	return html
+}
+
+// Configure changes the configuration used by Render.
+func Configure(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	current.Lock()
+	current.config = c
+	current.Unlock()
+	return nil
+}
+
+// GetConfig returns the configuration used by Render.
+func GetConfig() Config {
+	current.RLock()
+	defer current.RUnlock()
+	return current.config
+}
+
+// Render renders the markdown text into sanitized HTML with the configured
+// pipeline.
+func Render(text string) string {
+	return GetConfig().Render(text)
+}
+
+// RegisterSanitizer makes a sanitizer available under the given name.
+func RegisterSanitizer(name string, s Sanitizer) {
+	sanitizers[name] = s
+}
+
+// RegisterPostProcessor makes a post-processor available under the given
+// name.
+func RegisterPostProcessor(name string, p PostProcessor) {
+	postProcessors[name] = p
+}
+
+// ExtensionNames returns the names of all extensions, sorted.
+func ExtensionNames() []string {
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SanitizerNames returns the names of all registered sanitizers, sorted.
+func SanitizerNames() []string {
+	names := make([]string, 0, len(sanitizers))
+	for name := range sanitizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PostProcessorNames returns the names of all registered post-processors,
+// sorted.
+func PostProcessorNames() []string {
+	names := make([]string, 0, len(postProcessors))
+	for name := range postProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rxTaskItem matches the box starting a task list item, such as "[ ] " or
+// "[x] ", in a tight or a loose list.
+var rxTaskItem = regexp.MustCompile(`^(<p>)?\[([ xX])\][ \t]`)
+
+// taskListRenderer renders the list items starting with a box as checkboxes.
+type taskListRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r *taskListRenderer) ListItem(out *bytes.Buffer, text []byte, flags int) {
+	if m := rxTaskItem.FindSubmatchIndex(text); m != nil {
+		var b bytes.Buffer
+		if m[2] >= 0 {
+			b.WriteString("<p>")
+		}
+		b.WriteString(`<input type="checkbox" disabled=""`)
+		if text[m[4]] != ' ' {
+			b.WriteString(` checked=""`)
+		}
+		b.WriteString(" /> ")
+		b.Write(text[m[1]:])
+		text = b.Bytes()
+	}
+	r.Renderer.ListItem(out, text, flags)
+}
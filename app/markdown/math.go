@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// extractMath turns the math between "$$" into display math, and between "$"
+// into inline math, made ready for KaTeX's auto-render extension: the TeX is
+// kept as is, between "\[" and "\]" or "\(" and "\)". A dollar sign can be
+// escaped as "\$". Inline math can't start or end with a space, nor be
+// followed by a digit, so that prices such as "$5 and $10" are left alone.
+func (p *placeholders) extractMath(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		switch {
+		case strings.HasPrefix(text[i:], `\$`):
+			out.WriteByte('$')
+			i += 2
+			continue
+		case strings.HasPrefix(text[i:], "$$"):
+			if end := strings.Index(text[i+2:], "$$"); end >= 0 {
+				out.WriteString(p.addHtml(mathHtml(text[i+2:i+2+end], true)))
+				i += end + 4
+				continue
+			}
+		case text[i] == '$':
+			if end := closingDollar(text[i+1:]); end >= 0 {
+				out.WriteString(p.addHtml(mathHtml(text[i+1:i+1+end], false)))
+				i += end + 2
+				continue
+			}
+		}
+		out.WriteByte(text[i])
+		i++
+	}
+	return out.String()
+}
+
+// closingDollar returns the position of the dollar sign closing the inline
+// math at the start of the text, or -1. Inline math doesn't span paragraphs,
+// nor contain unescaped dollar signs.
+func closingDollar(text string) int {
+	if text == "" || strings.IndexByte(" \t\n$", text[0]) >= 0 {
+		return -1
+	}
+	for i := 1; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "\n\n"):
+			return -1
+		case text[i] == '\\':
+			i++
+		case text[i] == '$':
+			// A dollar sign which can't close the math means this wasn't
+			// math after all.
+			prev := text[i-1]
+			if prev == ' ' || prev == '\t' || prev == '\n' {
+				return -1
+			}
+			if i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9' {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func mathHtml(tex string, display bool) string {
+	if display {
+		return `<div class="math math-display">\[` + html.EscapeString(strings.TrimSpace(tex)) + `\]</div>`
+	}
+	return `<span class="math math-inline">\(` + html.EscapeString(tex) + `\)</span>`
+}
+
+// mermaidRenderer leaves the code blocks of mermaid diagrams, as in
+// "```mermaid", to be rendered by mermaid in the browser.
+type mermaidRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r *mermaidRenderer) BlockCode(out *bytes.Buffer, text []byte, info string) {
+	if lang, _ := parseCodeInfo(info); lang != "mermaid" {
+		r.Renderer.BlockCode(out, text, info)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	out.WriteString(`<div class="mermaid">`)
+	out.WriteString(html.EscapeString(string(text)))
+	out.WriteString("</div>\n")
+}
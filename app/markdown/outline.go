@@ -0,0 +1,96 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Heading is an entry of the table of contents of a post, along with the
+// headings nested in it.
+type Heading struct {
+	Level    int        `json:"level"`
+	Id       string     `json:"id"`
+	Title    string     `json:"title"`
+	Children []*Heading `json:"children,omitempty"`
+}
+
+// Url returns the link to the heading in its post.
+func (h *Heading) Url() string {
+	return "#" + h.Id
+}
+
+var (
+	rxHeading   = regexp.MustCompile(`(?s)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]>`)
+	rxHeadingId = regexp.MustCompile(`\sid="([^"]*)"`)
+	rxAnyTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Outline returns the table of contents of the rendered HTML of a post. The
+// headings without an ID are given one made from their title, so that every
+// heading can be linked to, and the HTML is returned with the IDs added. The
+// IDs only depend on the titles, so they are stable when the rest of the post
+// changes.
+func Outline(s string) (string, []*Heading) {
+	used := make(map[string]bool)
+	for _, m := range rxHeading.FindAllStringSubmatch(s, -1) {
+		if id := rxHeadingId.FindStringSubmatch(m[2]); id != nil {
+			used[id[1]] = true
+		}
+	}
+	headings := make([]*Heading, 0)
+	s = rxHeading.ReplaceAllStringFunc(s, func(tag string) string {
+		m := rxHeading.FindStringSubmatch(tag)
+		level, _ := strconv.Atoi(m[1])
+		h := &Heading{
+			Level: level,
+			Title: strings.TrimSpace(html.UnescapeString(rxAnyTag.ReplaceAllString(m[3], ""))),
+		}
+		headings = append(headings, h)
+		if id := rxHeadingId.FindStringSubmatch(m[2]); id != nil {
+			h.Id = html.UnescapeString(id[1])
+			return tag
+		}
+		h.Id = anchorName(h.Title)
+		for i := 1; used[h.Id]; i++ {
+			h.Id = anchorName(h.Title) + "-" + strconv.Itoa(i)
+		}
+		used[h.Id] = true
+		return "<h" + m[1] + ` id="` + html.EscapeString(h.Id) + `"` + m[2] + ">" + m[3] + "</h" + m[1] + ">"
+	})
+	return s, nestHeadings(headings)
+}
+
+// anchorName makes an ID from the title of a heading, keeping its letters and
+// digits in any script.
+func anchorName(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "section"
+	}
+	return strings.Join(words, "-")
+}
+
+// nestHeadings nests every heading in the closest previous heading of a
+// higher level.
+func nestHeadings(headings []*Heading) []*Heading {
+	roots := make([]*Heading, 0)
+	var stack []*Heading
+	for _, h := range headings {
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		stack = append(stack, h)
+	}
+	return roots
+}
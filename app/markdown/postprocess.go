@@ -0,0 +1,41 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterPostProcessor("lazyimages", LazyImages)
+	RegisterPostProcessor("nofollow", NoFollow)
+}
+
+var (
+	rxImgTag  = regexp.MustCompile(`<img\s[^>]*>`)
+	rxLinkTag = regexp.MustCompile(`<a\s[^>]*>`)
+	rxHref    = regexp.MustCompile(`\shref="(?:https?:)?//([^/"?#]+)`)
+	rxRel     = regexp.MustCompile(`\srel="[^"]*"`)
+)
+
+// LazyImages lets browsers load the images when they are scrolled into view.
+func LazyImages(html string, c Config) string {
+	return rxImgTag.ReplaceAllStringFunc(html, func(tag string) string {
+		if strings.Contains(tag, " loading=") {
+			return tag
+		}
+		return "<img loading=\"lazy\"" + tag[len("<img"):]
+	})
+}
+
+// NoFollow adds rel="nofollow noopener" to the links to other hosts, so that
+// search engines don't follow them.
+func NoFollow(html string, c Config) string {
+	return rxLinkTag.ReplaceAllStringFunc(html, func(tag string) string {
+		m := rxHref.FindStringSubmatch(tag)
+		if m == nil || strings.EqualFold(m[1], c.Host) {
+			return tag
+		}
+		tag = rxRel.ReplaceAllString(tag, "")
+		return "<a rel=\"nofollow noopener\"" + tag[len("<a"):]
+	})
+}
@@ -0,0 +1,35 @@
+package markdown
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+func init() {
+	RegisterSanitizer("ugc", newUGCPolicy().Sanitize)
+	// none trusts the authors with any HTML, including scripts.
+	RegisterSanitizer("none", func(html string) string { return html })
+}
+
+// newUGCPolicy returns the policy for user generated content, which allows
+// the HTML rendered from markdown, and the markup of the extensions, but no
+// scripts, styles, frames or event handlers.
+func newUGCPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Links to the blog itself shouldn't be nofollow, the nofollow
+	// post-processor takes care of external links.
+	p.RequireNoFollowOnLinks(false)
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_:.-]+$`)).OnElements(
+		"h1", "h2", "h3", "h4", "h5", "h6", "sup", "li")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(footnotes|footnote-ref|footnote-return|mermaid)$`)).OnElements(
+		"div", "sup", "a")
+	p.AllowElements("nav")
+	// Highlighted code
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).OnElements(
+		"pre", "code", "span", "table", "tr", "td")
+	// Task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
@@ -0,0 +1,161 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUGCSanitizer(t *testing.T) {
+	sanitize := sanitizers["ugc"]
+	tests := []struct {
+		name    string
+		html    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "script tag",
+			html:    `<p>Hello</p><script>alert(1)</script>`,
+			want:    []string{`<p>Hello</p>`},
+			notWant: []string{`<script`, `alert(1)`},
+		},
+		{
+			name:    "event handler on an image",
+			html:    `<img src="/a.png" onerror="alert(1)">`,
+			want:    []string{`src="/a.png"`},
+			notWant: []string{`onerror`},
+		},
+		{
+			name:    "event handler on a link",
+			html:    `<a href="/about/" onclick="alert(1)" onmouseover="alert(2)">About</a>`,
+			want:    []string{`href="/about/"`},
+			notWant: []string{`onclick`, `onmouseover`},
+		},
+		{
+			name:    "javascript link",
+			html:    `<a href="javascript:alert(1)">x</a>`,
+			notWant: []string{`javascript:`},
+		},
+		{
+			name:    "javascript link in mixed case",
+			html:    `<a href="JaVaScRiPt:alert(1)">x</a>`,
+			notWant: []string{`alert(1)`},
+		},
+		{
+			name: "heading, footnote and list ids",
+			html: `<h2 id="intro">Intro</h2><sup id="fnref:1">1</sup><li id="fn:1">Note</li>`,
+			want: []string{`id="intro"`, `id="fnref:1"`, `id="fn:1"`},
+		},
+		{
+			// bluemonday allows ASCII ids on every element, the ids made of
+			// other letters only on the elements blackfriday gives ids to.
+			name: "heading id in Chinese",
+			html: `<h2 id="中文标题">中文标题</h2><li id="注释">x</li>`,
+			want: []string{`id="中文标题"`, `id="注释"`},
+		},
+		{
+			name:    "id in Chinese on an element which may not have one",
+			html:    `<p id="中文">Hello</p><div id="标题">World</div>`,
+			notWant: []string{`id=`},
+		},
+		{
+			name:    "id which would add an attribute",
+			html:    `<h2 id="x&quot; onclick=&quot;alert(1)">Title</h2>`,
+			notWant: []string{`onclick="`, `"alert(1)`},
+		},
+		{
+			name: "footnote and mermaid classes",
+			html: `<div class="footnotes">x</div><a class="footnote-ref" href="#fn:1">1</a><div class="mermaid">graph TD</div>`,
+			want: []string{`class="footnotes"`, `class="footnote-ref"`, `class="mermaid"`},
+		},
+		{
+			name:    "class which is not allowed",
+			html:    `<div class="login-form">x</div><p class="footnotes">y</p><a class="btn" href="/">z</a>`,
+			notWant: []string{`class=`},
+		},
+		{
+			name: "highlighted code classes",
+			html: `<pre class="chroma"><code class="language-go"><span class="kd">func</span></code></pre>`,
+			want: []string{`class="chroma"`, `class="language-go"`, `class="kd"`},
+		},
+		{
+			name:    "highlighted code class with markup",
+			html:    `<span class="kd&quot; onclick=&quot;alert(1)">func</span>`,
+			notWant: []string{`class=`, `onclick`},
+		},
+		{
+			name:    "styles and frames",
+			html:    `<style>body{display:none}</style><iframe src="https://example.com/"></iframe><p style="color:red">x</p>`,
+			notWant: []string{`<style`, `<iframe`, `style=`},
+		},
+	}
+	for _, tt := range tests {
+		got := sanitize(tt.html)
+		for _, s := range tt.want {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: %q is missing from %q", tt.name, s, got)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: %q is in %q", tt.name, s, got)
+			}
+		}
+	}
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	c := DefaultConfig()
+	tests := []struct {
+		name    string
+		text    string
+		notWant []string
+	}{
+		{"script in markdown", "Hello\n\n<script>alert(1)</script>\n", []string{`<script`}},
+		{"event handler in markdown", `<img src="/a.png" onerror="alert(1)">`, []string{`onerror`}},
+		{"javascript link in markdown", "[x](javascript:alert(1))", []string{`javascript:`}},
+		{"script in a shortcode", "{{< note >}}<script>alert(1)</script>{{< /note >}}", []string{`<script`}},
+		{"event handler in a shortcode title", `{{< note title="<b onclick=alert(1)>x</b>" >}}y{{< /note >}}`, []string{`<b `}},
+	}
+	for _, tt := range tests {
+		got := c.Render(tt.text)
+		for _, s := range tt.notWant {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: %q is in %q", tt.name, s, got)
+			}
+		}
+	}
+}
+
+func TestForgedPlaceholders(t *testing.T) {
+	c := DefaultConfig()
+	forged := []string{
+		"html00000000000000000x",
+		"code00000000000000000x",
+		"htmlffffffffffffffff0x",
+		"html0x",
+	}
+	for _, f := range forged {
+		// The shortcode and the math make the placeholders of the render.
+		text := f + "\n\n{{< note >}}hi{{< /note >}}\n\n$x^2$ and `" + f + "`\n"
+		got := c.Render(text)
+		if n := strings.Count(got, `class="callout callout-note"`); n != 1 {
+			t.Errorf("%s: %d callouts in %q, want 1", f, n, got)
+		}
+		if n := strings.Count(got, f); n != 2 {
+			t.Errorf("%s: the placeholder is kept %d times in %q, want 2", f, n, got)
+		}
+	}
+
+	// A placeholder of another render is left alone.
+	a, b := newPlaceholders(), newPlaceholders()
+	b.addHtml("<script>alert(1)</script>")
+	forgedHtml := b.addHtml("<script>alert(2)</script>")
+	if got := a.restoreHtml("<p>" + forgedHtml + "</p>"); strings.Contains(got, "<script") {
+		t.Errorf("restoreHtml expanded the placeholder of another render: %q", got)
+	}
+	forgedCode := b.addCode("<script>alert(3)</script>")
+	if got := a.restoreCode(forgedCode); strings.Contains(got, "<script") {
+		t.Errorf("restoreCode expanded the placeholder of another render: %q", got)
+	}
+}
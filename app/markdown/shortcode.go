@@ -0,0 +1,284 @@
+package markdown
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Shortcode renders a shortcode found in a post, such as
+// {{< youtube dQw4w9WgXcQ >}}, into HTML. The HTML isn't sanitized, so
+// shortcodes must escape their arguments.
+type Shortcode func(call *ShortcodeCall) (string, error)
+
+// A ShortcodeCall is a shortcode found in a post, along with its arguments.
+// A shortcode may wrap content, as in {{< note >}}content{{< /note >}}, which
+// is rendered with the same pipeline and sanitized before it's passed on.
+type ShortcodeCall struct {
+	Name string
+	// Args are the positional arguments, such as the ID in
+	// {{< youtube dQw4w9WgXcQ >}}.
+	Args []string
+	// Params are the named arguments, such as the src in
+	// {{< figure src="/upload/a.png" >}}.
+	Params map[string]string
+	// Inner is the HTML of the wrapped content, if any.
+	Inner string
+}
+
+// Get returns the named argument, or the positional argument at the given
+// index if there is no such name.
+func (c *ShortcodeCall) Get(name string, index int) string {
+	if v, ok := c.Params[name]; ok {
+		return v
+	}
+	if index >= 0 && index < len(c.Args) {
+		return c.Args[index]
+	}
+	return ""
+}
+
+var shortcodes = make(map[string]Shortcode)
+
+// RegisterShortcode makes a shortcode available under the given name,
+// replacing any shortcode of the same name.
+func RegisterShortcode(name string, s Shortcode) {
+	shortcodes[name] = s
+}
+
+// ShortcodeNames returns the names of all registered shortcodes, sorted.
+func ShortcodeNames() []string {
+	names := make([]string, 0, len(shortcodes))
+	for name := range shortcodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	rxShortcode    = regexp.MustCompile(`\{\{<\s*(/?)([a-zA-Z0-9_-]+)((?:\s+(?:[a-zA-Z0-9_-]+=)?(?:"[^"]*"|[^\s">]+))*)\s*>\}\}`)
+	rxShortcodeArg = regexp.MustCompile(`(?:([a-zA-Z0-9_-]+)=)?(?:"([^"]*)"|([^\s"]+))`)
+)
+
+// placeholders holds the parts of a post which must not be touched by
+// blackfriday or the sanitizer. The code is taken out so that shortcodes and
+// math in it are left alone, and put back before rendering. The HTML of the
+// math and the shortcodes is put back after sanitizing. The placeholders are
+// made of letters and digits, with a random nonce so that posts can't fake
+// them.
+type placeholders struct {
+	nonce       string
+	code        []string
+	html        []string
+	rxCode      *regexp.Regexp
+	rxHtml      *regexp.Regexp
+	rxHeadingId *regexp.Regexp
+}
+
+func newPlaceholders() *placeholders {
+	b := make([]byte, 8)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	return &placeholders{
+		nonce:  nonce,
+		rxCode: regexp.MustCompile(`code` + nonce + `([0-9]+)x`),
+		rxHtml: regexp.MustCompile(`(<p>)?html` + nonce + `([0-9]+)x(</p>)?`),
+		// The IDs blackfriday makes from headings holding placeholders.
+		rxHeadingId: regexp.MustCompile(`(<h[1-6][^>]*?)\sid="[^"]*` + nonce + `[^"]*"`),
+	}
+}
+
+func (p *placeholders) addCode(code string) string {
+	p.code = append(p.code, code)
+	return fmt.Sprintf("code%s%dx", p.nonce, len(p.code)-1)
+}
+
+func (p *placeholders) addHtml(html string) string {
+	p.html = append(p.html, html)
+	return fmt.Sprintf("html%s%dx", p.nonce, len(p.html)-1)
+}
+
+// protectCode takes out the fenced code blocks and the code spans.
+func (p *placeholders) protectCode(text string) string {
+	var out strings.Builder
+	lines := strings.SplitAfter(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence := codeFence(lines[i])
+		if fence == "" {
+			out.WriteString(p.protectCodeSpans(lines[i]))
+			continue
+		}
+		j := i + 1
+		for j < len(lines) && !closesFence(lines[j], fence) {
+			j++
+		}
+		if j == len(lines) {
+			// An unclosed fence runs to the end of the post.
+			j--
+		}
+		block := strings.Join(lines[i:j+1], "")
+		nl := ""
+		if strings.HasSuffix(block, "\n") {
+			block, nl = block[:len(block)-1], "\n"
+		}
+		out.WriteString(p.addCode(block) + nl)
+		i = j
+	}
+	return out.String()
+}
+
+func (p *placeholders) protectCodeSpans(line string) string {
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		n := len(line[start:]) - len(strings.TrimLeft(line[start:], "`"))
+		end := -1
+		for k := start + n; k < len(line); {
+			if line[k] != '`' {
+				k++
+				continue
+			}
+			m := len(line[k:]) - len(strings.TrimLeft(line[k:], "`"))
+			if m == n {
+				end = k
+				break
+			}
+			k += m
+		}
+		if end < 0 {
+			out.WriteString(line[:start+n])
+			line = line[start+n:]
+			continue
+		}
+		out.WriteString(line[:start])
+		out.WriteString(p.addCode(line[start : end+n]))
+		line = line[end+n:]
+	}
+	out.WriteString(line)
+	return out.String()
+}
+
+// codeFence returns the fence opening a fenced code block on the line, if any.
+func codeFence(line string) string {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 || len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return ""
+	}
+	fence := s[:len(s)-len(strings.TrimLeft(s, s[:1]))]
+	if len(fence) < 3 {
+		return ""
+	}
+	return fence
+}
+
+func closesFence(line, fence string) bool {
+	s := strings.TrimLeft(line, " ")
+	return len(line)-len(s) <= 3 && strings.HasPrefix(s, fence) &&
+		strings.TrimSpace(strings.TrimLeft(s, fence[:1])) == ""
+}
+
+func (p *placeholders) restoreCode(text string) string {
+	return p.rxCode.ReplaceAllStringFunc(text, func(t string) string {
+		i, _ := strconv.Atoi(p.rxCode.FindStringSubmatch(t)[1])
+		return p.code[i]
+	})
+}
+
+// dropHeadingIds removes the IDs made from headings holding placeholders.
+// They contain the nonce, so they would change at every render; the headings
+// get IDs made from their final text from Outline instead.
+func (p *placeholders) dropHeadingIds(html string) string {
+	return p.rxHeadingId.ReplaceAllString(html, "$1")
+}
+
+// restoreHtml puts the HTML of the math and shortcodes back. Blocks alone in
+// a paragraph take its place.
+func (p *placeholders) restoreHtml(html string) string {
+	return p.rxHtml.ReplaceAllStringFunc(html, func(t string) string {
+		m := p.rxHtml.FindStringSubmatch(t)
+		i, _ := strconv.Atoi(m[2])
+		h := p.html[i]
+		if m[1] != "" && m[3] != "" && isBlockHtml(h) {
+			return h
+		}
+		return m[1] + h + m[3]
+	})
+}
+
+var rxBlockHtml = regexp.MustCompile(`^\s*<(div|figure|iframe|script|blockquote|p|ul|ol|table|pre|section|aside|video|audio)[\s>]`)
+
+func isBlockHtml(html string) bool {
+	return rxBlockHtml.MatchString(html)
+}
+
+// extractShortcodes renders the registered shortcodes with the pipeline of
+// the given configuration. Unknown shortcodes, and the ones which fail, are
+// left as they are.
+func (p *placeholders) extractShortcodes(text string, c Config) string {
+	var out strings.Builder
+	for {
+		m := rxShortcode.FindStringSubmatchIndex(text)
+		if m == nil {
+			break
+		}
+		name := text[m[4]:m[5]]
+		s, ok := shortcodes[name]
+		if !ok || m[3] > m[2] {
+			out.WriteString(text[:m[1]])
+			text = text[m[1]:]
+			continue
+		}
+		call := &ShortcodeCall{Name: name, Params: make(map[string]string)}
+		for _, a := range rxShortcodeArg.FindAllStringSubmatch(text[m[6]:m[7]], -1) {
+			v := a[2] + a[3]
+			if a[1] != "" {
+				call.Params[a[1]] = v
+			} else {
+				call.Args = append(call.Args, v)
+			}
+		}
+		rest := text[m[1]:]
+		if start, end := findClosingShortcode(rest, name); start >= 0 {
+			call.Inner = c.Render(p.restoreCode(rest[:start]))
+			rest = rest[end:]
+		}
+		out.WriteString(text[:m[0]])
+		h, err := s(call)
+		if err != nil {
+			out.WriteString(text[m[0]:m[1]])
+			text = text[m[1]:]
+			continue
+		}
+		out.WriteString(p.addHtml(h))
+		text = rest
+	}
+	out.WriteString(text)
+	return out.String()
+}
+
+// findClosingShortcode returns the position of the tag closing the shortcode
+// of the given name, skipping the ones nested in it, or -1 if it isn't closed.
+func findClosingShortcode(text, name string) (int, int) {
+	depth := 0
+	for _, m := range rxShortcode.FindAllStringSubmatchIndex(text, -1) {
+		if text[m[4]:m[5]] != name {
+			continue
+		}
+		if m[3] == m[2] {
+			depth++
+		} else if depth > 0 {
+			depth--
+		} else {
+			return m[0], m[1]
+		}
+	}
+	return -1, -1
+}
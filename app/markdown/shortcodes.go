@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterShortcode("youtube", YouTube)
+	RegisterShortcode("bilibili", Bilibili)
+	RegisterShortcode("gist", Gist)
+	RegisterShortcode("figure", Figure)
+	RegisterShortcode("note", Callout("note", "Note"))
+	RegisterShortcode("warning", Callout("warning", "Warning"))
+}
+
+var (
+	rxVideoId  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	rxGistName = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+// YouTube embeds a YouTube video by its ID, as in
+// {{< youtube dQw4w9WgXcQ >}}.
+func YouTube(c *ShortcodeCall) (string, error) {
+	id := c.Get("id", 0)
+	if !rxVideoId.MatchString(id) {
+		return "", fmt.Errorf("Invalid YouTube video ID: %s", id)
+	}
+	return embedVideo("https://www.youtube-nocookie.com/embed/" + id), nil
+}
+
+// Bilibili embeds a Bilibili video by its BV or AV ID, as in
+// {{< bilibili BV1GJ411x7h7 >}}.
+func Bilibili(c *ShortcodeCall) (string, error) {
+	id := c.Get("id", 0)
+	if !rxVideoId.MatchString(id) {
+		return "", fmt.Errorf("Invalid Bilibili video ID: %s", id)
+	}
+	q := url.Values{}
+	if strings.HasPrefix(strings.ToLower(id), "av") {
+		q.Set("aid", id[2:])
+	} else {
+		q.Set("bvid", id)
+	}
+	if page := c.Get("page", 1); page != "" {
+		q.Set("page", page)
+	}
+	return embedVideo("https://player.bilibili.com/player.html?" + q.Encode()), nil
+}
+
+func embedVideo(src string) string {
+	return `<div class="embed embed-video"><iframe src="` + html.EscapeString(src) +
+		`" frameborder="0" allowfullscreen="allowfullscreen" loading="lazy"></iframe></div>`
+}
+
+// Gist embeds a GitHub gist, or a single file of it, as in
+// {{< gist user 1234567 main.go >}}.
+func Gist(c *ShortcodeCall) (string, error) {
+	user, id, file := c.Get("user", 0), c.Get("id", 1), c.Get("file", 2)
+	if !rxGistName.MatchString(user) || !rxGistName.MatchString(id) ||
+		(file != "" && !rxGistName.MatchString(file)) {
+		return "", fmt.Errorf("Invalid gist: %s/%s", user, id)
+	}
+	src := "https://gist.github.com/" + user + "/" + id + ".js"
+	if file != "" {
+		src += "?file=" + url.QueryEscape(file)
+	}
+	return `<script src="` + html.EscapeString(src) + `"></script>`, nil
+}
+
+// Figure shows an image with a caption, as in
+// {{< figure src="/upload/a.png" caption="A diagram" alt="..." link="..." >}}.
+func Figure(c *ShortcodeCall) (string, error) {
+	src := c.Get("src", 0)
+	if !safeUrl(src) {
+		return "", fmt.Errorf("Invalid figure source: %s", src)
+	}
+	caption := c.Get("caption", 1)
+	alt := c.Get("alt", -1)
+	if alt == "" {
+		alt = caption
+	}
+	img := `<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt) + `" />`
+	if link := c.Get("link", -1); link != "" && safeUrl(link) {
+		img = `<a href="` + html.EscapeString(link) + `">` + img + `</a>`
+	}
+	var b strings.Builder
+	b.WriteString("<figure>" + img)
+	if caption != "" || c.Inner != "" {
+		b.WriteString("<figcaption>" + html.EscapeString(caption) + c.Inner + "</figcaption>")
+	}
+	b.WriteString("</figure>")
+	return b.String(), nil
+}
+
+// safeUrl reports whether the URL is relative or uses HTTP, so it can't run
+// scripts.
+func safeUrl(s string) bool {
+	u, err := url.Parse(s)
+	return s != "" && err == nil && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https")
+}
+
+// Callout returns a shortcode which shows its content in a box of the given
+// kind, as in {{< note >}}content{{< /note >}}. The title defaults to the
+// given one, and can be changed by the first argument.
+func Callout(kind, title string) Shortcode {
+	return func(c *ShortcodeCall) (string, error) {
+		t := c.Get("title", 0)
+		if t == "" {
+			t = title
+		}
+		return `<div class="callout callout-` + kind + `"><p class="callout-title">` +
+			html.EscapeString(t) + "</p>" + c.Inner + "</div>", nil
+	}
+}
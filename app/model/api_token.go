@@ -0,0 +1,191 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetAPITokenByHash = `SELECT * FROM api_tokens WHERE hash = ?`
+const stmtGetAPITokensByUserId = `SELECT * FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`
+const stmtTouchAPIToken = `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`
+const stmtDeleteAPIToken = `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+const stmtDeleteAPITokensByUserId = `DELETE FROM api_tokens WHERE user_id = ?`
+
+// The scopes of the personal API tokens, which are checked by the routes of
+// the API they may call. The routes without a scope, such as the ones of the
+// users and the settings, need a session token.
+const (
+	ScopePostsRead        = "posts:read"
+	ScopePostsWrite       = "posts:write"
+	ScopeMediaWrite       = "media:write"
+	ScopeCommentsModerate = "comments:moderate"
+)
+
+// APITokenScopes are the scopes a personal API token can be given.
+var APITokenScopes = []string{ScopePostsRead, ScopePostsWrite, ScopeMediaWrite, ScopeCommentsModerate}
+
+// apiTokenPrefix starts every personal API token, so that they are easy to
+// tell from session tokens, and to find when they leak.
+const apiTokenPrefix = "sp_"
+
+// An APIToken is a long-lived personal access token, which lets scripts call
+// the API on behalf of a user without their password. Only the SHA-256 hash
+// of the token is stored; the token itself is shown once, when it is created.
+type APIToken struct {
+	Id         int64      `meddler:"id,pk" json:"id"`
+	UserId     int64      `meddler:"user_id" json:"user_id"`
+	Name       string     `meddler:"name" json:"name"`
+	Prefix     string     `meddler:"prefix" json:"prefix"` // The start of the token, to tell tokens apart
+	Hash       string     `meddler:"hash" json:"-"`
+	Scopes     string     `meddler:"scopes" json:"-"` // Separated by commas
+	ExpiresAt  *time.Time `meddler:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time `meddler:"last_used_at" json:"last_used_at"`
+	CreatedAt  *time.Time `meddler:"created_at" json:"created_at"`
+}
+
+// APITokens is a slice of "APIToken"s.
+type APITokens []*APIToken
+
+// NewAPIToken creates a token for the given user with the given scopes, which
+// never expires if expiresAt is nil. It returns the token to give to the
+// user, which can't be found again.
+func NewAPIToken(userId int64, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	t, value, err := newAPIToken(userId, name, scopes, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := meddler.Insert(db, "api_tokens", t); err != nil {
+		return nil, "", err
+	}
+	return t, value, nil
+}
+
+// newAPIToken returns the token to store, and the token to give to the user.
+func newAPIToken(userId int64, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("The name of the token can not be empty.")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("The token needs at least one scope.")
+	}
+	for _, s := range scopes {
+		if !isAPITokenScope(s) {
+			return nil, "", fmt.Errorf("Unknown scope: %s", s)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(*utils.Now()) {
+		return nil, "", fmt.Errorf("The expiry date must be in the future.")
+	}
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	value := fmt.Sprintf("%s%x", apiTokenPrefix, b)
+	t := &APIToken{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    value[:len(apiTokenPrefix)+8],
+		Hash:      hashAPIToken(value),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+		CreatedAt: utils.Now(),
+	}
+	return t, value, nil
+}
+
+func hashAPIToken(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+}
+
+func isAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIToken returns whether the value looks like a personal API token.
+func IsAPIToken(value string) bool {
+	return strings.HasPrefix(value, apiTokenPrefix)
+}
+
+// GetAPITokenByValue finds the token given by a request, unless it has
+// expired.
+func GetAPITokenByValue(value string) (*APIToken, error) {
+	t := new(APIToken)
+	if err := meddler.QueryRow(db, t, stmtGetAPITokenByHash, hashAPIToken(value)); err != nil {
+		return nil, err
+	}
+	if t.IsExpired() {
+		return nil, fmt.Errorf("The token has expired.")
+	}
+	return t, nil
+}
+
+// GetAPITokensByUserId gets the tokens of the given user, newest first.
+func (tokens *APITokens) GetAPITokensByUserId(userId int64) error {
+	return meddler.QueryAll(db, tokens, stmtGetAPITokensByUserId, userId)
+}
+
+// ScopeList returns the scopes of the token.
+func (t *APIToken) ScopeList() []string {
+	scopes := make([]string, 0)
+	for _, s := range strings.Split(t.Scopes, ",") {
+		if s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// IsExpired returns whether the token has expired.
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(*utils.Now())
+}
+
+// Touch records that the token was just used. It is recorded once a minute at
+// most, so that busy scripts don't write to the DB on every request.
+func (t *APIToken) Touch() error {
+	now := utils.Now()
+	if t.LastUsedAt != nil && now.Sub(*t.LastUsedAt) < time.Minute {
+		return nil
+	}
+	t.LastUsedAt = now
+	_, err := db.Exec(stmtTouchAPIToken, now, t.Id)
+	return err
+}
+
+// JWT returns the JWT of the requests made with the token, which holds the
+// user of the token and is limited to its scopes.
+func (t *APIToken) JWT() (JWT, error) {
+	u := &User{Id: t.UserId}
+	if err := u.GetUserById(); err != nil {
+		return JWT{}, err
+	}
+	j := JWT{
+		UserRole:  u.Role,
+		UserID:    u.Id,
+		UserEmail: u.Email,
+		Scopes:    t.ScopeList(),
+	}
+	if t.ExpiresAt != nil {
+		j.Expiration = t.ExpiresAt.Unix()
+	}
+	return j, nil
+}
+
+// DeleteAPIToken revokes the token with the given ID, if it belongs to the
+// given user.
+func DeleteAPIToken(id, userId int64) error {
+	_, err := db.Exec(stmtDeleteAPIToken, id, userId)
+	return err
+}
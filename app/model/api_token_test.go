@@ -0,0 +1,101 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPITokenRefusesInvalidTokens(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		{"no scopes", "deploy", nil, nil},
+		{"empty scopes", "deploy", []string{}, nil},
+		{"empty scope", "deploy", []string{""}, nil},
+		{"unknown scope", "deploy", []string{ScopePostsRead, "settings:write"}, nil},
+		{"no name", "  ", []string{ScopePostsRead}, nil},
+		{"expired", "deploy", []string{ScopePostsRead}, &past},
+	}
+	for _, tt := range tests {
+		if tok, _, err := newAPIToken(1, tt.tokenName, tt.scopes, tt.expiresAt); err == nil {
+			t.Errorf("%s: got a token with scopes %q, want an error", tt.name, tok.Scopes)
+		}
+	}
+}
+
+func TestNewAPITokenStoresTheHashOnly(t *testing.T) {
+	tok, value, err := newAPIToken(1, "deploy", []string{ScopePostsRead, ScopePostsWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIToken(value) {
+		t.Errorf("%q doesn't look like a personal API token", value)
+	}
+	if tok.Hash != hashAPIToken(value) {
+		t.Errorf("got hash %q, want the hash of the token %q", tok.Hash, hashAPIToken(value))
+	}
+	if !strings.HasPrefix(value, tok.Prefix) || len(tok.Prefix) >= len(value)/2 {
+		t.Errorf("the prefix %q gives too much of the token %q", tok.Prefix, value)
+	}
+	// No column holds the token, nor any more of it than the prefix.
+	v := reflect.ValueOf(tok).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Type.Kind() != reflect.String || f.Name == "Prefix" {
+			continue
+		}
+		if s := v.Field(i).String(); strings.Contains(s, value[len(tok.Prefix):]) {
+			t.Errorf("the %s column holds the token: %q", f.Name, s)
+		}
+	}
+	b, err := json.Marshal(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), tok.Hash) || strings.Contains(string(b), value) {
+		t.Errorf("the JSON of the token gives the token or its hash: %s", b)
+	}
+}
+
+func TestAPITokenIsExpired(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"never expires", nil, false},
+		{"expired", &past, true},
+		{"not yet expired", &future, false},
+	}
+	for _, tt := range tests {
+		tok := &APIToken{ExpiresAt: tt.expiresAt}
+		if got := tok.IsExpired(); got != tt.want {
+			t.Errorf("%s: IsExpired() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAPITokenWithoutScopesAllowsNothing(t *testing.T) {
+	// A token stored without scopes must not get the nil scopes of the
+	// session tokens, which may do anything.
+	tok := &APIToken{Scopes: ""}
+	scopes := tok.ScopeList()
+	if scopes == nil {
+		t.Fatal("ScopeList() = nil, want an empty list")
+	}
+	j := JWT{Scopes: scopes}
+	for _, scope := range append([]string{""}, APITokenScopes...) {
+		if j.Allows(scope) {
+			t.Errorf("a token without scopes is allowed %q", scope)
+		}
+	}
+}
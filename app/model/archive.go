@@ -0,0 +1,122 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetPostsByDate = `SELECT * FROM posts WHERE published AND NOT page AND published_at >= ? AND published_at < ? ORDER BY published_at DESC LIMIT ? OFFSET ?`
+const stmtGetPostsCountByDate = `SELECT count(*) FROM posts WHERE published AND NOT page AND published_at >= ? AND published_at < ?`
+const stmtGetArchives = `SELECT YEAR(published_at), MONTH(published_at), count(*) FROM posts WHERE published AND NOT page AND published_at IS NOT NULL GROUP BY 1, 2 ORDER BY 1 DESC, 2 DESC`
+
+// An Archive is a period of time with published posts: a year, a month or a
+// day. Month and Day are 0 for archives covering a whole year or month.
+// Dates are in UTC, as they are stored in the DB.
+type Archive struct {
+	Year  int
+	Month time.Month
+	Day   int
+	Count int64
+	Posts Posts
+}
+
+// NewArchive returns the archive of the given period, or an error if the date
+// doesn't exist.
+func NewArchive(year int, month time.Month, day int) (*Archive, error) {
+	a := &Archive{Year: year, Month: month, Day: day}
+	if year < 1 || month < 0 || month > 12 || day < 0 || (month == 0 && day > 0) {
+		return nil, fmt.Errorf("Invalid archive date")
+	}
+	if day > 0 && a.Start().Day() != day {
+		return nil, fmt.Errorf("Invalid archive date")
+	}
+	return a, nil
+}
+
+// Start returns the beginning of the archived period.
+func (a *Archive) Start() time.Time {
+	month, day := a.Month, a.Day
+	if month == 0 {
+		month = time.January
+	}
+	if day == 0 {
+		day = 1
+	}
+	return time.Date(a.Year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// End returns the end of the archived period, which isn't part of it.
+func (a *Archive) End() time.Time {
+	switch {
+	case a.Day > 0:
+		return a.Start().AddDate(0, 0, 1)
+	case a.Month > 0:
+		return a.Start().AddDate(0, 1, 0)
+	default:
+		return a.Start().AddDate(1, 0, 0)
+	}
+}
+
+// Url returns the URL of the archive, such as "/2017/03".
+func (a *Archive) Url() string {
+	switch {
+	case a.Day > 0:
+		return fmt.Sprintf("/%d/%02d/%02d", a.Year, a.Month, a.Day)
+	case a.Month > 0:
+		return fmt.Sprintf("/%d/%02d", a.Year, a.Month)
+	default:
+		return fmt.Sprintf("/%d", a.Year)
+	}
+}
+
+// Title returns the archived period in words, such as "March 2017".
+func (a *Archive) Title() string {
+	switch {
+	case a.Day > 0:
+		return a.Start().Format("January 2, 2006")
+	case a.Month > 0:
+		return a.Start().Format("January 2006")
+	default:
+		return a.Start().Format("2006")
+	}
+}
+
+// GetPostsByDate returns a new pager based on the published posts in the
+// archived period, newest first.
+func (p *Posts) GetPostsByDate(a *Archive, page, size int64) (*utils.Pager, error) {
+	var count int64
+	row := db.QueryRow(stmtGetPostsCountByDate, a.Start(), a.End())
+	err := row.Scan(&count)
+	if err != nil {
+		utils.LogOnError(err, "Unable to get posts by date.", true)
+		return nil, err
+	}
+	pager := utils.NewPager(page, size, count)
+	if !pager.IsValid {
+		return pager, fmt.Errorf("Page not found")
+	}
+	err = meddler.QueryAll(db, p, stmtGetPostsByDate, a.Start(), a.End(), size, pager.Begin)
+	return pager, err
+}
+
+// GetArchives returns the months with published posts along with the number
+// of posts in each of them, newest first.
+func GetArchives() ([]*Archive, error) {
+	rows, err := db.Query(stmtGetArchives)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	archives := make([]*Archive, 0)
+	for rows.Next() {
+		a := new(Archive)
+		if err := rows.Scan(&a.Year, &a.Month, &a.Count); err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	return archives, rows.Err()
+}
@@ -0,0 +1,373 @@
+package model
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// BackupVersion is the version of the backup archive format. It is increased
+// whenever the layout of the archive changes in an incompatible way.
+const BackupVersion = 1
+
+// backupTables are the tables exported into a backup, in the order they are
+// restored. The jobs and the webhook deliveries are left out on purpose: they
+// are a queue and a log of this server, and restoring them would run the old
+// jobs and send the old deliveries again.
+var backupTables = []string{
+	"users", "roles", "tokens", "api_tokens", "settings", "posts", "tags", "posts_tags", "posts_categories",
+	"comments", "messages", "media", "media_variants", "posts_media", "slug_redirects", "webhooks",
+}
+
+// A BackupManifest describes the content of a backup archive. It is stored as
+// "manifest.json" at the root of the archive, next to a "tables" directory
+// holding one JSON file per table, and an "upload" directory holding the
+// uploaded files.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tables    []string  `json:"tables"`
+}
+
+// Backup creates a backup archive of the whole site in backupDir, and emits
+// BackupFinished, so that the admin is told whether it succeeded.
+func Backup(backupDir, uploadDir string) (string, error) {
+	file, err := CreateBackup(backupDir, uploadDir)
+	Emit(BackupFinished{File: file, Err: err})
+	return file, err
+}
+
+// CreateBackup writes every table plus the upload directory into a single zip
+// archive in backupDir, returning the path of the archive. The archive is
+// removed if the backup fails, so that no truncated backup is left behind.
+func CreateBackup(backupDir, uploadDir string) (string, error) {
+	os.MkdirAll(backupDir, os.ModePerm)
+	now := time.Now()
+	file := filepath.Join(backupDir, "SimplePosts-"+now.Format("20060102-150405")+".zip")
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	err = writeBackup(f, now, uploadDir)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file)
+		return "", err
+	}
+	return file, nil
+}
+
+func writeBackup(w io.Writer, now time.Time, uploadDir string) error {
+	zw := zip.NewWriter(w)
+	manifest := &BackupManifest{Version: BackupVersion, CreatedAt: now, Tables: backupTables}
+	if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	for _, table := range backupTables {
+		rows, err := dumpTable(table)
+		if err != nil {
+			return err
+		}
+		if err = writeZipJSON(zw, "tables/"+table+".json", rows); err != nil {
+			return err
+		}
+	}
+	err := filepath.Walk(uploadDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(uploadDir, p)
+		if err != nil {
+			return err
+		}
+		return writeZipFile(zw, "upload/"+filepath.ToSlash(rel), p)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return zw.Close()
+}
+
+// RestoreBackup restores a backup archive created by CreateBackup. The site
+// must not have any users yet, so a backup can never overwrite a site that is
+// in use. Tables are replaced as a whole, and the uploaded files are
+// extracted into uploadDir.
+func RestoreBackup(file, uploadDir string) error {
+	if n, err := GetNumberOfUsers(); err != nil || n > 0 {
+		return fmt.Errorf("Backups can only be restored into an empty database")
+	}
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File)
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+	manifest := new(BackupManifest)
+	if err = readZipJSON(files["manifest.json"], manifest); err != nil {
+		return fmt.Errorf("Invalid backup archive: %v", err)
+	}
+	if manifest.Version > BackupVersion {
+		return fmt.Errorf("Backup version %d is newer than the supported version %d", manifest.Version, BackupVersion)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range manifest.Tables {
+		if !isBackupTable(table) {
+			continue
+		}
+		var rows []map[string]interface{}
+		if err = readZipJSON(files["tables/"+table+".json"], &rows); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = restoreTable(tx, table, rows); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	resetRedirectRules()
+	resetPermalinks()
+	resetRelatedPosts()
+	loadMarkdownConfig()
+
+	for name, zf := range files {
+		if !strings.HasPrefix(name, "upload/") || zf.FileInfo().IsDir() {
+			continue
+		}
+		rel := path.Clean(strings.TrimPrefix(name, "upload/"))
+		if strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if err = extractZipFile(zf, filepath.Join(uploadDir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupJob is the payload of the "backup" jobs.
+type backupJob struct {
+	BackupDir string `json:"backup_dir"`
+	UploadDir string `json:"upload_dir"`
+}
+
+// backupDirs are the directories of the scheduled backups, set by
+// ScheduleBackups.
+var backupDirs backupJob
+
+func init() {
+	RegisterJobType(JobType{
+		Name:        "backup",
+		MaxAttempts: 1,
+		Run: func(ctx context.Context, j *Job) (string, error) {
+			var p backupJob
+			if err := j.Decode(&p); err != nil {
+				return "", PermanentJobError(err)
+			}
+			NewSetting("backup_last", strconv.FormatInt(time.Now().Unix(), 10), "backup").Save()
+			file, err := Backup(p.BackupDir, p.UploadDir)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Base(file), nil
+		},
+	})
+	Subscribe(func(e Event) {
+		if e.(SettingChanged).Setting.Ke == "backup_interval" {
+			if err := scheduleBackups(); err != nil {
+				log.Printf("[Error]: can not schedule the backups: %v", err)
+			}
+		}
+	}, EventNameSettingChanged)
+}
+
+// EnqueueBackup queues a job backing up the site into backupDir.
+func EnqueueBackup(backupDir, uploadDir string) (*Job, error) {
+	return EnqueueJob("backup", backupJob{backupDir, uploadDir})
+}
+
+// ScheduleBackups backs up the site in the background every
+// "backup_interval" hours, with a recurring "backup" job. An interval of 0,
+// the default, disables scheduled backups. The time of the last backup is
+// kept in the "backup_last" setting, and the schedule follows the setting
+// when it changes.
+func ScheduleBackups(backupDir, uploadDir string) error {
+	SetSettingIfNotExists("backup_interval", "0", "backup")
+	backupDirs = backupJob{backupDir, uploadDir}
+	return scheduleBackups()
+}
+
+func scheduleBackups() error {
+	if backupDirs.BackupDir == "" {
+		return nil
+	}
+	interval, _ := strconv.Atoi(GetSettingValue("backup_interval"))
+	if interval <= 0 {
+		return UnscheduleRecurringJob("backup")
+	}
+	every := time.Duration(interval) * time.Hour
+	first := time.Now()
+	if last, _ := strconv.ParseInt(GetSettingValue("backup_last"), 10, 64); last > 0 {
+		if next := time.Unix(last, 0).Add(every); next.After(first) {
+			first = next
+		}
+	}
+	return ScheduleRecurringJob("backup", "backup", backupDirs, every, first)
+}
+
+// GetBackupFiles returns all the backup archives in backupDir, newest first.
+func GetBackupFiles(backupDir string) []*File {
+	files := make([]*File, 0)
+	for _, f := range GetFileList(backupDir) {
+		if strings.HasSuffix(f.Name(), ".zip") {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func isBackupTable(table string) bool {
+	for _, t := range backupTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpTable returns every row of the table as a column name to value map.
+func dumpTable(table string) ([]map[string]interface{}, error) {
+	rows, err := db.Query("SELECT * FROM " + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, c := range columns {
+			switch v := values[i].(type) {
+			case []byte:
+				row[c] = string(v)
+			case time.Time:
+				row[c] = v.Format("2006-01-02 15:04:05")
+			default:
+				row[c] = v
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// restoreTable replaces the content of the table with the given rows.
+func restoreTable(tx *sql.Tx, table string, rows []map[string]interface{}) error {
+	if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		columns := make([]string, 0, len(row))
+		marks := make([]string, 0, len(row))
+		values := make([]interface{}, 0, len(row))
+		for c, v := range row {
+			if !utils.IsASCII(strings.Replace(c, "_", "-", -1)) {
+				return fmt.Errorf("Invalid column name %q in table %s", c, table)
+			}
+			columns = append(columns, c)
+			marks = append(marks, "?")
+			values = append(values, v)
+		}
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), strings.Join(marks, ", "))
+		if _, err := tx.Exec(stmt, values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeZipFile(zw *zip.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func readZipJSON(zf *zip.File, v interface{}) error {
+	if zf == nil {
+		return fmt.Errorf("file not found in archive")
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func extractZipFile(zf *zip.File, dest string) error {
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
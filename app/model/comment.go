@@ -17,14 +17,14 @@ type Comment struct {
 	Id        int64      `meddler:"id,pk"`
 	PostId    int64      `meddler:"post_id"`
 	Author    string     `meddler:"author"`
-	Email     string     `meddler:"author_email"`
+	Email     string     `meddler:"author_email" json:"-"`
 	Avatar    string     `meddler:"author_avatar"`
 	Website   string     `meddler:"author_url"`
-	Ip        string     `meddler:"author_ip"`
+	Ip        string     `meddler:"author_ip" json:"-"`
 	CreatedAt *time.Time `meddler:"created_at"`
 	Content   string     `meddler:"content"`
 	Approved  bool       `meddler:"approved"`
-	UserAgent string     `meddler:"agent"`
+	UserAgent string     `meddler:"agent" json:"-"`
 	Type      string     `meddler:"type"`
 	Parent    int64      `meddler:"parent"`
 	UserId    int64      `meddler:"user_id"`
@@ -54,11 +54,37 @@ func NewComment() *Comment {
 	}
 }
 
-// Save saves the comment in the DB.
+// Save saves the comment in the DB, and emits CommentCreated for a new
+// comment, or CommentApproved for a comment which has just been approved.
 func (c *Comment) Save() error {
+	created := c.Id == 0
+	wasApproved := false
+	if !created {
+		current := &Comment{Id: c.Id}
+		if current.GetCommentById() == nil {
+			wasApproved = current.Approved
+		}
+	}
 	c.Avatar = utils.Gravatar(c.Email, "50")
 	err := meddler.Save(db, "comments", c)
-	return err
+	if err != nil {
+		return err
+	}
+	comment := *c
+	if created {
+		Emit(CommentCreated{Comment: &comment})
+	} else if c.Approved && !wasApproved {
+		Emit(CommentApproved{Comment: &comment})
+	}
+	return nil
+}
+
+// Import inserts the comment in the DB without emitting any event, for the
+// bulk writers such as the importer which would otherwise post a message and
+// queue the webhook deliveries for every comment.
+func (c *Comment) Import() error {
+	c.Avatar = utils.Gravatar(c.Email, "50")
+	return meddler.Insert(db, "comments", c)
 }
 
 // ToJson returns a comment as a map, in order to be encoded as JSON.
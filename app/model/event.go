@@ -0,0 +1,149 @@
+package model
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// The names of the events emitted by the model.
+const (
+	EventNamePostSaved       = "post.saved"
+	EventNamePostDeleted     = "post.deleted"
+	EventNameCommentCreated  = "comment.created"
+	EventNameCommentApproved = "comment.approved"
+	EventNameUserCreated     = "user.created"
+	EventNameUserLoggedIn    = "user.logged_in"
+	EventNameSettingChanged  = "setting.changed"
+	EventNameBackupFinished  = "backup.finished"
+)
+
+// An Event is something which happened to the data of the blog, emitted once
+// it is written to the DB. The side effects of the writes, such as dropping
+// caches or notifying the admin, subscribe to the events rather than being
+// called by the model methods.
+type Event interface {
+	EventName() string
+}
+
+// PostSaved is emitted when a post or a page is created or changed.
+type PostSaved struct {
+	Post         *Post
+	Created      bool    // Whether the post was just created
+	WasPublished bool    // Whether the post was published before it was saved
+	OldTagIds    []int64 // The tags of the post before it was saved
+}
+
+// PostDeleted is emitted when a post or a page is deleted. The post is the
+// one which was deleted, or only holds its ID if it couldn't be found.
+type PostDeleted struct {
+	Post      *Post
+	OldTagIds []int64
+}
+
+// CommentCreated is emitted when a comment is added.
+type CommentCreated struct {
+	Comment *Comment
+}
+
+// CommentApproved is emitted when a pending comment is approved.
+type CommentApproved struct {
+	Comment *Comment
+}
+
+// UserCreated is emitted when a user is added.
+type UserCreated struct {
+	User *User
+}
+
+// UserLoggedIn is emitted when a user signs in, either to the admin or to the
+// API.
+type UserLoggedIn struct {
+	User *User
+	Ip   string
+	Via  string // "admin" or "api"
+}
+
+// SettingChanged is emitted when a setting is saved or deleted.
+type SettingChanged struct {
+	Setting *Setting
+}
+
+// BackupFinished is emitted when a backup succeeded or failed.
+type BackupFinished struct {
+	File string
+	Err  error
+}
+
+func (PostSaved) EventName() string       { return EventNamePostSaved }
+func (PostDeleted) EventName() string     { return EventNamePostDeleted }
+func (CommentCreated) EventName() string  { return EventNameCommentCreated }
+func (CommentApproved) EventName() string { return EventNameCommentApproved }
+func (UserCreated) EventName() string     { return EventNameUserCreated }
+func (UserLoggedIn) EventName() string    { return EventNameUserLoggedIn }
+func (SettingChanged) EventName() string  { return EventNameSettingChanged }
+func (BackupFinished) EventName() string  { return EventNameBackupFinished }
+
+// An EventHandler is called with the events it subscribed to.
+type EventHandler func(e Event)
+
+type subscriber struct {
+	handler EventHandler
+	async   bool
+}
+
+// subscribers holds the subscribers of every event, by event name.
+var subscribers struct {
+	sync.RWMutex
+	handlers map[string][]subscriber
+}
+
+// Subscribe calls the handler with every event of the given names, before
+// Emit returns, in the order they subscribed. It is meant for the side
+// effects the next request must see, such as dropping a cache.
+func Subscribe(h EventHandler, names ...string) {
+	subscribe(h, false, names)
+}
+
+// SubscribeAsync calls the handler with every event of the given names in
+// its own goroutine, so that slow side effects, such as notifying other
+// services, don't hold up the request. The handlers get copies of the data of
+// the events, but may run in any order.
+func SubscribeAsync(h EventHandler, names ...string) {
+	subscribe(h, true, names)
+}
+
+func subscribe(h EventHandler, async bool, names []string) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	if subscribers.handlers == nil {
+		subscribers.handlers = make(map[string][]subscriber)
+	}
+	for _, name := range names {
+		subscribers.handlers[name] = append(subscribers.handlers[name], subscriber{h, async})
+	}
+}
+
+// Emit sends the event to its subscribers. The data was already written, so
+// a failing subscriber is only logged, and never fails the write.
+func Emit(e Event) {
+	subscribers.RLock()
+	handlers := subscribers.handlers[e.EventName()]
+	subscribers.RUnlock()
+	for _, s := range handlers {
+		if s.async {
+			go runEventHandler(s.handler, e)
+		} else {
+			runEventHandler(s.handler, e)
+		}
+	}
+}
+
+func runEventHandler(h EventHandler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Error]: %s subscriber panicked: %v\n%s", e.EventName(), r, debug.Stack())
+		}
+	}()
+	h(e)
+}
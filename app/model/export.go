@@ -0,0 +1,328 @@
+package model
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/russross/meddler"
+	"gopkg.in/yaml.v2"
+)
+
+const stmtGetAllUsers = `SELECT * FROM users ORDER BY id`
+const stmtGetAllCommentsByPostId = `SELECT * FROM comments WHERE post_id = ? ORDER BY created_at`
+
+// ExportVersion is the version of the JSON export format.
+const ExportVersion = 1
+
+// exportSettingTypes are the types of settings included in an export. OSS
+// credentials and the backup schedule are left out on purpose.
+var exportSettingTypes = []string{"general", "content", "custom"}
+
+// A SiteExport is the whole content of the site as a single JSON document.
+// Unlike a backup, it holds no passwords or credentials, and refers to
+// users and tags by slug instead of by ID, so it can be read by other tools.
+type SiteExport struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Settings   map[string]string `json:"settings"`
+	Navigation []*Navigator      `json:"navigation"`
+	Users      []*ExportedUser   `json:"users"`
+	Tags       []*ExportedTag    `json:"tags"`
+	Posts      []*ExportedPost   `json:"posts"`
+}
+
+// An ExportedUser is the public profile of a user.
+type ExportedUser struct {
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Email    string `json:"email"`
+	Image    string `json:"image"`
+	Cover    string `json:"cover"`
+	Bio      string `json:"bio"`
+	Website  string `json:"website"`
+	Location string `json:"location"`
+}
+
+// An ExportedTag is a tag, without its internal IDs.
+type ExportedTag struct {
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Hidden bool   `json:"hidden"`
+}
+
+// An ExportedPost is a post or page, along with its tags and comments.
+type ExportedPost struct {
+	Title           string             `json:"title"`
+	Slug            string             `json:"slug"`
+	Markdown        string             `json:"markdown"`
+	Html            string             `json:"html"`
+	Image           string             `json:"image"`
+	IsFeatured      bool               `json:"featured"`
+	IsPage          bool               `json:"is_page"`
+	IsPublished     bool               `json:"published"`
+	AllowComment    bool               `json:"allow_comment"`
+	Language        string             `json:"language"`
+	Category        string             `json:"category"`
+	MetaTitle       string             `json:"meta_title"`
+	MetaDescription string             `json:"meta_description"`
+	Author          string             `json:"author"`
+	Tags            []string           `json:"tags"`
+	CreatedAt       *time.Time         `json:"created_at"`
+	UpdatedAt       *time.Time         `json:"updated_at"`
+	PublishedAt     *time.Time         `json:"published_at"`
+	Comments        []*ExportedComment `json:"comments"`
+}
+
+// An ExportedComment is a comment. Parent is the index of the parent comment
+// in the comments of the same post, or -1 for top level comments.
+type ExportedComment struct {
+	Author    string     `json:"author"`
+	Email     string     `json:"email"`
+	Website   string     `json:"website"`
+	Content   string     `json:"content"`
+	Approved  bool       `json:"approved"`
+	Parent    int        `json:"parent"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// postFrontMatter is the YAML front matter of an exported markdown file. The
+// keys follow the conventions of Hexo and Jekyll, so the files can be read by
+// the markdown importer as well as by those generators.
+type postFrontMatter struct {
+	Title           string   `yaml:"title"`
+	Slug            string   `yaml:"slug"`
+	Date            string   `yaml:"date,omitempty"`
+	Updated         string   `yaml:"updated,omitempty"`
+	Tags            []string `yaml:"tags,omitempty"`
+	Category        string   `yaml:"category,omitempty"`
+	MetaTitle       string   `yaml:"meta_title,omitempty"`
+	MetaDescription string   `yaml:"meta_description,omitempty"`
+	Layout          string   `yaml:"layout,omitempty"`
+	Author          string   `yaml:"author,omitempty"`
+	Image           string   `yaml:"image,omitempty"`
+	Published       bool     `yaml:"published"`
+}
+
+// ExportSite collects the whole content of the site, drafts included.
+func ExportSite() (*SiteExport, error) {
+	site := &SiteExport{
+		Version:    ExportVersion,
+		ExportedAt: time.Now(),
+		Settings:   make(map[string]string),
+		Navigation: GetNavigators(),
+		Users:      make([]*ExportedUser, 0),
+		Tags:       make([]*ExportedTag, 0),
+		Posts:      make([]*ExportedPost, 0),
+	}
+	for _, t := range exportSettingTypes {
+		if settings := GetSettingsByType(t); settings != nil {
+			for _, s := range *settings {
+				site.Settings[s.Ke] = s.Value
+			}
+		}
+	}
+
+	var users []*User
+	if err := meddler.QueryAll(db, &users, stmtGetAllUsers); err != nil {
+		return nil, err
+	}
+	slugs := make(map[int64]string)
+	for _, u := range users {
+		slugs[u.Id] = u.Slug
+		site.Users = append(site.Users, &ExportedUser{
+			Name:     u.Name,
+			Slug:     u.Slug,
+			Email:    u.Email,
+			Image:    u.Image,
+			Cover:    u.Cover,
+			Bio:      u.Bio,
+			Website:  u.Website,
+			Location: u.Location,
+		})
+	}
+
+	tags := new(Tags)
+	if err := tags.GetAllTags(); err != nil {
+		return nil, err
+	}
+	for _, t := range *tags {
+		site.Tags = append(site.Tags, &ExportedTag{Name: t.Name, Slug: t.Slug, Hidden: t.Hidden})
+	}
+
+	for _, isPage := range []bool{false, true} {
+		posts := new(Posts)
+		if err := posts.GetAllPostList(isPage, false, "created_at"); err != nil {
+			return nil, err
+		}
+		for _, p := range *posts {
+			ep, err := exportPost(p, slugs[p.CreatedBy])
+			if err != nil {
+				return nil, err
+			}
+			site.Posts = append(site.Posts, ep)
+		}
+	}
+	return site, nil
+}
+
+func exportPost(p *Post, author string) (*ExportedPost, error) {
+	ep := &ExportedPost{
+		Title:           p.Title,
+		Slug:            p.Slug,
+		Markdown:        p.Markdown,
+		Html:            p.Html,
+		Image:           p.Image,
+		IsFeatured:      p.IsFeatured,
+		IsPage:          p.IsPage,
+		IsPublished:     p.IsPublished,
+		AllowComment:    p.AllowComment,
+		Language:        p.Language,
+		Category:        p.Category,
+		MetaTitle:       p.MetaTitle,
+		MetaDescription: p.MetaDescription,
+		Author:          author,
+		Tags:            make([]string, 0),
+		CreatedAt:       p.CreatedAt,
+		UpdatedAt:       p.UpdatedAt,
+		PublishedAt:     p.PublishedAt,
+		Comments:        make([]*ExportedComment, 0),
+	}
+	for _, t := range p.Tags() {
+		ep.Tags = append(ep.Tags, t.Name)
+	}
+
+	var comments []*Comment
+	if err := meddler.QueryAll(db, &comments, stmtGetAllCommentsByPostId, p.Id); err != nil {
+		return nil, err
+	}
+	index := make(map[int64]int)
+	for i, c := range comments {
+		index[c.Id] = i
+	}
+	for _, c := range comments {
+		parent, ok := index[c.Parent]
+		if !ok || c.Parent == 0 {
+			parent = -1
+		}
+		ep.Comments = append(ep.Comments, &ExportedComment{
+			Author:    c.Author,
+			Email:     c.Email,
+			Website:   c.Website,
+			Content:   c.Content,
+			Approved:  c.Approved,
+			Parent:    parent,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+	return ep, nil
+}
+
+// MarkdownFile returns the post as a markdown file with YAML front matter.
+func (ep *ExportedPost) MarkdownFile() ([]byte, error) {
+	fm := &postFrontMatter{
+		Title:           ep.Title,
+		Slug:            ep.Slug,
+		Date:            exportTime(ep.PublishedAt),
+		Updated:         exportTime(ep.UpdatedAt),
+		Tags:            ep.Tags,
+		Category:        ep.Category,
+		MetaTitle:       ep.MetaTitle,
+		MetaDescription: ep.MetaDescription,
+		Author:          ep.Author,
+		Image:           ep.Image,
+		Published:       ep.IsPublished,
+	}
+	if fm.Date == "" {
+		fm.Date = exportTime(ep.CreatedAt)
+	}
+	if ep.IsPage {
+		fm.Layout = "page"
+	}
+	b, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("---\n" + string(b) + "---\n\n" + ep.Markdown + "\n"), nil
+}
+
+// FileName returns the path of the exported markdown file, relative to the
+// export root. Posts and pages are kept apart, as their slugs may collide.
+func (ep *ExportedPost) FileName() string {
+	dir := "posts"
+	if ep.IsPage {
+		dir = "pages"
+	}
+	return dir + "/" + strings.Replace(ep.Slug, "/", "-", -1) + ".md"
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// ExportToDir writes the export into dir, as "site.json" next to one
+// markdown file per post in "posts" and per page in "pages". Markdown files
+// of posts that no longer exist are removed, so the directory can be kept
+// under version control.
+func ExportToDir(dir string) error {
+	for _, sub := range []string{"posts", "pages"} {
+		old, _ := filepath.Glob(filepath.Join(dir, sub, "*.md"))
+		for _, f := range old {
+			os.Remove(f)
+		}
+	}
+	return writeExport(func(name string, data []byte) error {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), os.ModePerm)
+		return ioutil.WriteFile(file, data, 0644)
+	})
+}
+
+// ExportToZip writes the same tree as ExportToDir into a zip archive.
+func ExportToZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := writeExport(func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeExport(write func(name string, data []byte) error) error {
+	site, err := ExportSite()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(site, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = write("site.json", b); err != nil {
+		return err
+	}
+	for _, ep := range site.Posts {
+		md, err := ep.MarkdownFile()
+		if err != nil {
+			return err
+		}
+		if err = write(ep.FileName(), md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
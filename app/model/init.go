@@ -2,6 +2,10 @@ package model
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/markdown"
 	"github.com/luohao-brian/SimplePosts/app/utils"
 )
 
@@ -19,6 +23,7 @@ func Initialize() error {
 	if err := createTableIfNotExist(); err != nil {
 		return err
 	}
+	loadMarkdownConfig()
 
 	if count, _ := GetNumberOfPosts(false, false); count < 1 {
 		if err := createWelcomeData(); err != nil {
@@ -37,20 +42,52 @@ func initConnection() error {
 	return nil
 }
 
+const stmtColumnExists = `SELECT count(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+
 func createTableIfNotExist() error {
 	for i := 0; i < len(TableSchemas); i++ {
 		if _, err := db.Exec(TableSchemas[i]); err != nil {
 			return err
 		}
 	}
+	if err := addMissingColumns(); err != nil {
+		return err
+	}
 	checkBlogSettings()
 	return nil
 }
 
+// addMissingColumns adds the TableColumns which the tables of an older DB
+// don't have yet.
+func addMissingColumns() error {
+	for _, c := range TableColumns {
+		var count int
+		if err := db.QueryRow(stmtColumnExists, c.Table, c.Column).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.Table, c.Column, c.Definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func checkBlogSettings() {
 	SetSettingIfNotExists("theme", "default", "blog")
 	SetSettingIfNotExists("title", "My Blog", "blog")
 	SetSettingIfNotExists("description", "Awesome blog created by SimplePosts.", "SimplePosts")
+	SetSettingIfNotExists("feed_size", "20", "feed")
+	SetSettingIfNotExists("feed_content", "summary", "feed")
+	SetSettingIfNotExists("slug_transliteration", "pinyin", "blog")
+	SetSettingIfNotExists("permalink", DefaultPermalink, "permalink")
+	md := markdown.DefaultConfig()
+	SetSettingIfNotExists(settingMarkdownExtensions, strings.Join(md.Extensions, ","), "markdown")
+	SetSettingIfNotExists(settingMarkdownSanitizer, md.Sanitizer, "markdown")
+	SetSettingIfNotExists(settingMarkdownPostProcessors, strings.Join(md.PostProcessors, ","), "markdown")
+	SetSettingIfNotExists(settingHighlightStyle, markdown.DefaultHighlightStyle, "markdown")
 }
 
 const samplePostContent = `
@@ -116,7 +153,7 @@ func createWelcomeData() error {
 	var err error
 	p := NewPost()
 	p.Title = "欢迎使用SimplePosts!"
-	p.Slug = "欢迎使用SimplePosts"
+	p.Slug = GenerateSlug(p.Title, "posts")
 	p.Markdown = samplePostContent
 	p.Html = utils.Markdown2Html(p.Markdown)
 	p.AllowComment = true
@@ -0,0 +1,568 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetJobById = `SELECT * FROM jobs WHERE id = ?`
+const stmtGetJobByKey = `SELECT * FROM jobs WHERE unique_key = ?`
+const stmtGetQueuedJobs = `SELECT * FROM jobs WHERE status = 'queued' ORDER BY run_at, id LIMIT ?`
+const stmtGetJobsByStatus = `SELECT * FROM jobs WHERE status = ? ORDER BY id DESC LIMIT ?`
+const stmtCountJobsByStatus = `SELECT status, count(*) FROM jobs GROUP BY status`
+const stmtGetDueJobIds = `SELECT id FROM jobs WHERE status = 'queued' AND run_at <= ? ORDER BY run_at, id LIMIT 10`
+const stmtClaimJob = `UPDATE jobs SET status = 'running', attempts = attempts + 1, started_at = ?, finished_at = NULL WHERE id = ? AND status = 'queued'`
+const stmtCancelQueuedJob = `UPDATE jobs SET status = 'canceled', error = 'Canceled.', finished_at = ? WHERE id = ? AND status = 'queued'`
+const stmtRetryJob = `UPDATE jobs SET status = 'queued', attempts = 0, error = '', run_at = ?, finished_at = NULL WHERE id = ? AND status IN ('failed', 'canceled')`
+const stmtRequeueRunningJobs = `UPDATE jobs SET status = 'queued', attempts = GREATEST(attempts - 1, 0) WHERE status = 'running'`
+const stmtUpdateRecurringJob = `UPDATE jobs SET type = ?, payload = ?, interval_seconds = ? WHERE id = ?`
+const stmtFinishJob = `UPDATE jobs SET status = ?, attempts = ?, run_at = ?, result = ?, error = ?, finished_at = ? WHERE id = ?`
+const stmtDeleteJobByKey = `DELETE FROM jobs WHERE unique_key = ?`
+const stmtDeleteOldJobs = `DELETE FROM jobs WHERE unique_key = '' AND status IN ('succeeded', 'canceled') AND finished_at < ?`
+
+// The statuses of the jobs.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// JobStatuses are the statuses of the jobs, in the order they are shown.
+var JobStatuses = []string{JobQueued, JobRunning, JobFailed, JobCanceled, JobSucceeded}
+
+const (
+	// jobPollInterval is how often the idle workers look for due jobs, such as
+	// the scheduled ones or the jobs queued by other processes.
+	jobPollInterval = 5 * time.Second
+	// jobLogDays is how long the finished jobs are kept.
+	jobLogDays = 7
+	// jobStopGrace is how long the jobs have to return once they are
+	// interrupted by a shutdown.
+	jobStopGrace = 5 * time.Second
+)
+
+// A Job is a task run in the background by the workers started by
+// StartJobWorkers, so that long tasks don't hold up the requests. Jobs are
+// kept in the DB, so they survive restarts, and are retried with an
+// exponential backoff when they fail. A recurring job has a key and an
+// interval: it keeps the same row, which is queued again for its next run
+// once it is done.
+type Job struct {
+	Id          int64      `meddler:"id,pk" json:"id"`
+	Type        string     `meddler:"type" json:"type"`
+	Payload     string     `meddler:"payload" json:"payload"` // JSON
+	Status      string     `meddler:"status" json:"status"`
+	Attempts    int        `meddler:"attempts" json:"attempts"`
+	MaxAttempts int        `meddler:"max_attempts" json:"max_attempts"`
+	RunAt       *time.Time `meddler:"run_at" json:"run_at"`
+	Interval    int64      `meddler:"interval_seconds" json:"interval"` // In seconds, 0 unless the job is recurring
+	Key         string     `meddler:"unique_key" json:"key"`
+	Result      string     `meddler:"result" json:"result"`
+	Error       string     `meddler:"error" json:"error"`
+	CreatedAt   *time.Time `meddler:"created_at" json:"created_at"`
+	StartedAt   *time.Time `meddler:"started_at" json:"started_at"`
+	FinishedAt  *time.Time `meddler:"finished_at" json:"finished_at"`
+}
+
+// Jobs is a slice of "Job"s.
+type Jobs []*Job
+
+// A JobHandler runs a job, and returns a summary of what it did. It should
+// return when the context is done, which happens when the job is canceled,
+// times out or is interrupted by a shutdown.
+type JobHandler func(ctx context.Context, j *Job) (string, error)
+
+// A JobType is a kind of job, registered with RegisterJobType.
+type JobType struct {
+	Name        string
+	Run         JobHandler
+	MaxAttempts int           // 3 by default
+	Backoff     time.Duration // The wait before the second attempt, doubled after every failure; a minute by default
+	Timeout     time.Duration // No timeout by default
+}
+
+// jobTypes holds the registered job types, by name.
+var jobTypes struct {
+	sync.RWMutex
+	types map[string]*JobType
+}
+
+// A recurringJob is a recurring job registered with RegisterRecurringJob.
+type recurringJob struct {
+	key, typ string
+	every    time.Duration
+}
+
+var recurringJobs []recurringJob
+
+// A runningJob is a job run by a worker of this process.
+type runningJob struct {
+	cancel      context.CancelFunc
+	canceled    bool // Canceled by the admin
+	interrupted bool // Interrupted by a shutdown
+}
+
+// jobWorkers holds the state of the workers.
+var jobWorkers struct {
+	sync.Mutex
+	started bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	running map[int64]*runningJob
+}
+
+// jobWake wakes an idle worker up when jobs are queued.
+var jobWake = make(chan struct{}, 1)
+
+// A permanentError is an error of a job which is not worth retrying.
+type permanentError struct {
+	error
+}
+
+// PermanentJobError marks the error of a job as permanent, so that the job
+// fails without being retried.
+func PermanentJobError(err error) error {
+	return permanentError{err}
+}
+
+func init() {
+	RegisterJobType(JobType{
+		Name: "jobs.prune",
+		Run: func(ctx context.Context, j *Job) (string, error) {
+			res, err := db.Exec(stmtDeleteOldJobs, utils.Now().AddDate(0, 0, -jobLogDays))
+			if err != nil {
+				return "", err
+			}
+			n, _ := res.RowsAffected()
+			return fmt.Sprintf("%d jobs removed.", n), nil
+		},
+	})
+	RegisterRecurringJob("jobs.prune", "jobs.prune", 24*time.Hour)
+}
+
+// RegisterJobType registers a kind of job, which the workers can then run.
+func RegisterJobType(t JobType) {
+	if t.MaxAttempts <= 0 {
+		t.MaxAttempts = 3
+	}
+	if t.Backoff <= 0 {
+		t.Backoff = time.Minute
+	}
+	jobTypes.Lock()
+	defer jobTypes.Unlock()
+	if jobTypes.types == nil {
+		jobTypes.types = make(map[string]*JobType)
+	}
+	jobTypes.types[t.Name] = &t
+}
+
+func getJobType(name string) *JobType {
+	jobTypes.RLock()
+	defer jobTypes.RUnlock()
+	return jobTypes.types[name]
+}
+
+// RegisterRecurringJob runs the job of the given type, without payload, every
+// given interval. The job is scheduled when the workers start, under the
+// given key.
+func RegisterRecurringJob(key, typ string, every time.Duration) {
+	recurringJobs = append(recurringJobs, recurringJob{key, typ, every})
+}
+
+// EnqueueJob queues a job of the given type, holding the given payload
+// encoded in JSON, to run as soon as a worker is free.
+func EnqueueJob(typ string, payload interface{}) (*Job, error) {
+	return ScheduleJob(typ, payload, *utils.Now())
+}
+
+// ScheduleJob queues a job of the given type to run at the given time.
+func ScheduleJob(typ string, payload interface{}, runAt time.Time) (*Job, error) {
+	j, err := newJob(typ, payload, runAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = meddler.Insert(db, "jobs", j); err != nil {
+		return nil, err
+	}
+	wakeJobWorkers()
+	return j, nil
+}
+
+func newJob(typ string, payload interface{}, runAt time.Time) (*Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{
+		Type:        typ,
+		Payload:     string(b),
+		Status:      JobQueued,
+		MaxAttempts: 3,
+		RunAt:       &runAt,
+		CreatedAt:   utils.Now(),
+	}
+	if t := getJobType(typ); t != nil {
+		j.MaxAttempts = t.MaxAttempts
+	}
+	return j, nil
+}
+
+// ScheduleRecurringJob makes the job with the given key run every given
+// interval, starting at the given time. A job already scheduled with the same
+// interval and payload keeps its schedule; otherwise it is scheduled again,
+// even if it was canceled.
+func ScheduleRecurringJob(key, typ string, payload interface{}, every time.Duration, first time.Time) error {
+	j, err := newJob(typ, payload, first)
+	if err != nil {
+		return err
+	}
+	j.Key = key
+	j.Interval = int64(every / time.Second)
+	current := new(Job)
+	err = meddler.QueryRow(db, current, stmtGetJobByKey, key)
+	if err == sql.ErrNoRows {
+		if err = meddler.Insert(db, "jobs", j); err == nil {
+			wakeJobWorkers()
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+	if current.Type == j.Type && current.Interval == j.Interval && current.Payload == j.Payload {
+		return nil
+	}
+	if current.Status == JobRunning {
+		// The new schedule starts once the current run is done.
+		_, err = db.Exec(stmtUpdateRecurringJob, j.Type, j.Payload, j.Interval, current.Id)
+		return err
+	}
+	j.Id = current.Id
+	j.CreatedAt = current.CreatedAt
+	if err = meddler.Update(db, "jobs", j); err == nil {
+		wakeJobWorkers()
+	}
+	return err
+}
+
+// UnscheduleRecurringJob stops the job with the given key from recurring.
+func UnscheduleRecurringJob(key string) error {
+	_, err := db.Exec(stmtDeleteJobByKey, key)
+	return err
+}
+
+// GetJobById gets the job based on its ID.
+func (j *Job) GetJobById() error {
+	return meddler.QueryRow(db, j, stmtGetJobById, j.Id)
+}
+
+// GetJobsByStatus gets the given number of jobs of the given status: the
+// queued jobs by the time they run, the others newest first.
+func (jobs *Jobs) GetJobsByStatus(status string, limit int) error {
+	if status == JobQueued {
+		return meddler.QueryAll(db, jobs, stmtGetQueuedJobs, limit)
+	}
+	return meddler.QueryAll(db, jobs, stmtGetJobsByStatus, status, limit)
+}
+
+// CountJobsByStatus returns the number of jobs of every status.
+func CountJobsByStatus() (map[string]int64, error) {
+	counts := make(map[string]int64)
+	rows, err := db.Query(stmtCountJobsByStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int64
+		if err = rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// Decode decodes the JSON payload of the job into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+// IsRecurring returns whether the job recurs.
+func (j *Job) IsRecurring() bool {
+	return j.Interval > 0
+}
+
+// Every returns the interval of a recurring job.
+func (j *Job) Every() time.Duration {
+	return time.Duration(j.Interval) * time.Second
+}
+
+// CancelJob cancels a queued job, or stops a job run by this process.
+func CancelJob(id int64) error {
+	res, err := db.Exec(stmtCancelQueuedJob, utils.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	jobWorkers.Lock()
+	defer jobWorkers.Unlock()
+	if rj, ok := jobWorkers.running[id]; ok {
+		rj.canceled = true
+		rj.cancel()
+		return nil
+	}
+	return fmt.Errorf("Only queued and running jobs can be canceled.")
+}
+
+// RetryJob queues a failed or canceled job again, with all its attempts.
+func RetryJob(id int64) error {
+	res, err := db.Exec(stmtRetryJob, utils.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("Only failed and canceled jobs can be retried.")
+	}
+	wakeJobWorkers()
+	return nil
+}
+
+func wakeJobWorkers() {
+	select {
+	case jobWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartJobWorkers starts the given number of workers running the due jobs.
+// The jobs left running by a previous process, which must have stopped
+// without StopJobWorkers, are queued again, so only one process should run
+// the workers of a DB. The recurring jobs are scheduled as well.
+func StartJobWorkers(n int) error {
+	jobWorkers.Lock()
+	defer jobWorkers.Unlock()
+	if jobWorkers.started {
+		return nil
+	}
+	if _, err := db.Exec(stmtRequeueRunningJobs); err != nil {
+		return err
+	}
+	for _, r := range recurringJobs {
+		if err := ScheduleRecurringJob(r.key, r.typ, nil, r.every, *utils.Now()); err != nil {
+			return err
+		}
+	}
+	jobWorkers.started = true
+	jobWorkers.stop = make(chan struct{})
+	jobWorkers.running = make(map[int64]*runningJob)
+	for i := 0; i < n; i++ {
+		jobWorkers.wg.Add(1)
+		go jobWorker(jobWorkers.stop)
+	}
+	return nil
+}
+
+// StopJobWorkers stops the workers from taking new jobs, and waits for the
+// running ones to finish. The jobs still running after the given timeout are
+// interrupted, and queued again to run when the workers start next time.
+func StopJobWorkers(timeout time.Duration) {
+	jobWorkers.Lock()
+	if !jobWorkers.started {
+		jobWorkers.Unlock()
+		return
+	}
+	jobWorkers.started = false
+	close(jobWorkers.stop)
+	jobWorkers.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		jobWorkers.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	jobWorkers.Lock()
+	for _, rj := range jobWorkers.running {
+		rj.interrupted = true
+		rj.cancel()
+	}
+	jobWorkers.Unlock()
+	select {
+	case <-done:
+	case <-time.After(jobStopGrace):
+		log.Printf("[Error]: some jobs did not stop, they will run again at the next start")
+	}
+}
+
+func jobWorker(stop chan struct{}) {
+	defer jobWorkers.wg.Done()
+	tick := time.NewTicker(jobPollInterval)
+	defer tick.Stop()
+	for {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			j, err := claimJob()
+			if err != nil {
+				log.Printf("[Error]: can not claim a job: %v", err)
+			}
+			if j == nil {
+				break
+			}
+			// Another worker may take the next job.
+			wakeJobWorkers()
+			runJob(j)
+		}
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		case <-jobWake:
+		}
+	}
+}
+
+// claimJob marks a due job as running, and returns it. The job is only
+// claimed if it is still queued, so that the workers of other processes
+// can't run it too.
+func claimJob() (*Job, error) {
+	rows, err := db.Query(stmtGetDueJobIds, utils.Now())
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		res, err := db.Exec(stmtClaimJob, utils.Now(), id)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		j := &Job{Id: id}
+		return j, j.GetJobById()
+	}
+	return nil, nil
+}
+
+// runJob runs the claimed job, and records its outcome.
+func runJob(j *Job) {
+	t := getJobType(j.Type)
+	if t == nil {
+		finishJob(j, nil, "", PermanentJobError(fmt.Errorf("Unknown job type: %s", j.Type)), &runningJob{})
+		return
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), t.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	rj := &runningJob{cancel: cancel}
+	jobWorkers.Lock()
+	jobWorkers.running[j.Id] = rj
+	jobWorkers.Unlock()
+
+	result, err := callJobHandler(t.Run, ctx, j)
+	cancel()
+
+	jobWorkers.Lock()
+	delete(jobWorkers.running, j.Id)
+	jobWorkers.Unlock()
+	finishJob(j, t, result, err, rj)
+}
+
+func callJobHandler(h JobHandler, ctx context.Context, j *Job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Error]: job %d (%s) panicked: %v\n%s", j.Id, j.Type, r, debug.Stack())
+			err = fmt.Errorf("The job panicked: %v", r)
+		}
+	}()
+	return h(ctx, j)
+}
+
+// finishJob records the outcome of a run of the job. A failed job is retried
+// after its backoff, unless it has no attempts left or its error is
+// permanent. A recurring job which is done is queued for its next run.
+func finishJob(j *Job, t *JobType, result string, err error, rj *runningJob) {
+	now := utils.Now()
+	j.Result = result
+	j.FinishedAt = now
+	_, permanent := err.(permanentError)
+	switch {
+	case rj.interrupted:
+		j.Status = JobQueued
+		j.Attempts--
+		j.Error = "Interrupted by a shutdown."
+		j.FinishedAt = nil
+	case rj.canceled:
+		j.Status = JobCanceled
+		j.Error = "Canceled."
+	case err == nil:
+		j.Status = JobSucceeded
+		j.Error = ""
+	case !permanent && j.Attempts < j.MaxAttempts:
+		j.Status = JobQueued
+		j.Error = err.Error()
+		next := now.Add(t.Backoff << uint(j.Attempts-1))
+		j.RunAt = &next
+	default:
+		j.Status = JobFailed
+		j.Error = err.Error()
+	}
+	if err != nil && !rj.interrupted && !rj.canceled {
+		log.Printf("[Error]: job %d (%s) failed: %v", j.Id, j.Type, err)
+	}
+	if j.Key != "" {
+		// The schedule may have changed while the job ran.
+		current := &Job{Id: j.Id}
+		if current.GetJobById() == nil {
+			j.Interval = current.Interval
+		}
+	}
+	if j.IsRecurring() && (j.Status == JobSucceeded || j.Status == JobFailed) {
+		next := j.RunAt.Add(j.Every())
+		if next.Before(*now) {
+			next = now.Add(j.Every())
+		}
+		j.Status = JobQueued
+		j.Attempts = 0
+		j.RunAt = &next
+	}
+	_, err = db.Exec(stmtFinishJob, j.Status, j.Attempts, j.RunAt, j.Result, j.Error, j.FinishedAt, j.Id)
+	if err != nil {
+		log.Printf("[Error]: can not record job %d: %v", j.Id, err)
+	}
+}
@@ -15,13 +15,30 @@ import (
 )
 
 // A JWT is a JSON web token, and contains all the values necessary to create
-// and validate tokens.
+// and validate tokens. The requests made with a personal API token get a JWT
+// too, limited to the scopes of the token.
 type JWT struct {
-	UserRole   int    `json:"user_role"`
-	UserID     int64  `json:"user_id"`
-	UserEmail  string `json:"user_email"`
-	Expiration int64  `json:"expiration"`
-	Token      string `json:"token"`
+	UserRole   int      `json:"user_role"`
+	UserID     int64    `json:"user_id"`
+	UserEmail  string   `json:"user_email"`
+	Expiration int64    `json:"expiration"`
+	Token      string   `json:"token"`
+	Scopes     []string `json:"scopes,omitempty"` // nil for session tokens, which may do anything
+}
+
+// Allows returns whether the token may call the routes of the given scope.
+// Session tokens may call every route, while personal API tokens may only
+// call the routes of their scopes, and never the ones without a scope.
+func (j JWT) Allows(scope string) bool {
+	if j.Scopes == nil {
+		return true
+	}
+	for _, s := range j.Scopes {
+		if scope != "" && s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 var (
@@ -0,0 +1,31 @@
+package model
+
+import "testing"
+
+func TestJWTAllows(t *testing.T) {
+	session := JWT{UserID: 1}
+	scoped := JWT{UserID: 1, Scopes: []string{ScopePostsRead, ScopeMediaWrite}}
+	every := JWT{UserID: 1, Scopes: APITokenScopes}
+	tests := []struct {
+		name  string
+		token JWT
+		scope string
+		want  bool
+	}{
+		{"session token, route without a scope", session, "", true},
+		{"session token, route with a scope", session, ScopePostsWrite, true},
+		{"scoped token, its scope", scoped, ScopePostsRead, true},
+		{"scoped token, its other scope", scoped, ScopeMediaWrite, true},
+		{"scoped token, another scope", scoped, ScopePostsWrite, false},
+		{"scoped token, route without a scope", scoped, "", false},
+		// The routes of the users and the settings have no scope.
+		{"token with every scope, route without a scope", every, "", false},
+		{"token with every scope, unknown scope", every, "settings:write", false},
+		{"token without scopes", JWT{UserID: 1, Scopes: []string{}}, ScopePostsRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.token.Allows(tt.scope); got != tt.want {
+			t.Errorf("%s: Allows(%q) = %v, want %v", tt.name, tt.scope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/russross/meddler"
+)
+
+const stmtGetList = `SELECT * FROM %s WHERE %s ORDER BY %s LIMIT ?`
+
+// cursorTimeLayout is how the times of the sort keys are kept in cursors,
+// which MySQL compares with DATETIME columns as is.
+const cursorTimeLayout = "2006-01-02 15:04:05"
+
+// A Cursor marks the last row of a page of a list, so that the next page
+// starts right after it. Unlike an offset, a cursor keeps its place when rows
+// are added or removed before it.
+type Cursor struct {
+	Key string `json:"k,omitempty"`
+	Id  int64  `json:"id"`
+}
+
+// String encodes the cursor as an opaque, URL-safe string.
+func (c *Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor encoded by Cursor.String.
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	c := new(Cursor)
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	return c, nil
+}
+
+// A SortError is returned when a list is sorted by a key it doesn't have.
+type SortError string
+
+func (e SortError) Error() string {
+	return "Unknown sort key: " + string(e)
+}
+
+// A ListQuery selects a page of a list, sorted by the given key and then by
+// ID, starting after the given cursor. An empty key sorts by ID alone.
+type ListQuery struct {
+	Sort  string
+	Desc  bool
+	After *Cursor
+	Limit int
+}
+
+// A PostFilter selects the posts, or the pages, to list. Status is one of
+// "published", "draft", or empty for both. The date range applies to the
+// publication date, or to the creation date of the drafts, and excludes To.
+type PostFilter struct {
+	Page     bool
+	Status   string
+	TagId    int64
+	AuthorId int64
+	From     *time.Time
+	To       *time.Time
+}
+
+// A CommentFilter selects the comments to list. Status is one of "approved",
+// "pending", or empty for both.
+type CommentFilter struct {
+	PostId int64
+	Status string
+}
+
+// The keys lists can be sorted by, with the SQL expression of each.
+var (
+	postSortKeys = map[string]string{
+		"id":           "id",
+		"title":        "title",
+		"created_at":   "created_at",
+		"updated_at":   "updated_at",
+		"published_at": "COALESCE(published_at, created_at)",
+	}
+	tagSortKeys     = map[string]string{"id": "id", "name": "name", "slug": "slug"}
+	userSortKeys    = map[string]string{"id": "id", "name": "name", "created_at": "created_at"}
+	commentSortKeys = map[string]string{"id": "id", "created_at": "created_at"}
+	mediaSortKeys   = map[string]string{"id": "id", "name": "name", "size": "size", "created_at": "created_at"}
+	settingSortKeys = map[string]string{"id": "id", "key": "ke", "type": "type"}
+)
+
+// SortKeys returns the keys the list of the given table can be sorted by, in
+// alphabetical order.
+func SortKeys(table string) []string {
+	keys := map[string]map[string]string{
+		"posts":    postSortKeys,
+		"tags":     tagSortKeys,
+		"users":    userSortKeys,
+		"comments": commentSortKeys,
+		"media":    mediaSortKeys,
+		"settings": settingSortKeys,
+	}[table]
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queryList runs the query of a page of the given table, with one more row
+// than the limit, so that the caller can tell whether there is a next page.
+func queryList(dst interface{}, table string, keys map[string]string, q *ListQuery, conds []string, args []interface{}) error {
+	expr := "id"
+	if q.Sort != "" {
+		var ok bool
+		if expr, ok = keys[q.Sort]; !ok {
+			return SortError(q.Sort)
+		}
+	}
+	cmp, dir := ">", ""
+	if q.Desc {
+		cmp, dir = "<", " DESC"
+	}
+	if q.After != nil {
+		if expr == "id" {
+			conds = append(conds, "id "+cmp+" ?")
+			args = append(args, q.After.Id)
+		} else {
+			conds = append(conds, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", expr, cmp, expr, cmp))
+			args = append(args, q.After.Key, q.After.Key, q.After.Id)
+		}
+	}
+	if len(conds) == 0 {
+		conds = append(conds, "1 = 1")
+	}
+	order := "id" + dir
+	if expr != "id" {
+		order = expr + dir + ", " + order
+	}
+	args = append(args, q.Limit+1)
+	return meddler.QueryAll(db, dst, fmt.Sprintf(stmtGetList, table, strings.Join(conds, " AND "), order), args...)
+}
+
+// nextCursor returns the cursor of the last row of a page fetched by
+// queryList, or nil if it is the last page, along with the number of rows
+// to keep.
+func nextCursor(q *ListQuery, n int, last func(i int) (string, int64)) (*Cursor, int) {
+	if n <= q.Limit {
+		return nil, n
+	}
+	key, id := last(q.Limit - 1)
+	return &Cursor{Key: key, Id: id}, q.Limit
+}
+
+func cursorTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(cursorTimeLayout)
+}
+
+// List gets a page of the posts, or pages, selected by the filter. It returns
+// the cursor of the next page, or nil if this is the last one.
+func (posts *Posts) List(f PostFilter, q *ListQuery) (*Cursor, error) {
+	conds := []string{"page = ?"}
+	args := []interface{}{f.Page}
+	switch f.Status {
+	case "published":
+		conds = append(conds, "published = 1")
+	case "draft":
+		conds = append(conds, "published = 0")
+	}
+	if f.TagId != 0 {
+		conds = append(conds, "id IN (SELECT post_id FROM posts_tags WHERE tag_id = ?)")
+		args = append(args, f.TagId)
+	}
+	if f.AuthorId != 0 {
+		conds = append(conds, "created_by = ?")
+		args = append(args, f.AuthorId)
+	}
+	if f.From != nil {
+		conds = append(conds, "COALESCE(published_at, created_at) >= ?")
+		args = append(args, cursorTime(f.From))
+	}
+	if f.To != nil {
+		conds = append(conds, "COALESCE(published_at, created_at) < ?")
+		args = append(args, cursorTime(f.To))
+	}
+	if err := queryList(posts, "posts", postSortKeys, q, conds, args); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*posts), func(i int) (string, int64) {
+		p := (*posts)[i]
+		switch q.Sort {
+		case "title":
+			return p.Title, p.Id
+		case "created_at":
+			return cursorTime(p.CreatedAt), p.Id
+		case "updated_at":
+			return cursorTime(p.UpdatedAt), p.Id
+		case "published_at":
+			if p.PublishedAt == nil {
+				return cursorTime(p.CreatedAt), p.Id
+			}
+			return cursorTime(p.PublishedAt), p.Id
+		}
+		return "", p.Id
+	})
+	*posts = (*posts)[:n]
+	return next, nil
+}
+
+// List gets a page of the tags. Hidden tags, which only belong to drafts,
+// are left out unless asked for.
+func (tags *Tags) List(withHidden bool, q *ListQuery) (*Cursor, error) {
+	var conds []string
+	if !withHidden {
+		conds = append(conds, "NOT hidden")
+	}
+	if err := queryList(tags, "tags", tagSortKeys, q, conds, nil); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*tags), func(i int) (string, int64) {
+		t := (*tags)[i]
+		switch q.Sort {
+		case "name":
+			return t.Name, t.Id
+		case "slug":
+			return t.Slug, t.Id
+		}
+		return "", t.Id
+	})
+	*tags = (*tags)[:n]
+	return next, nil
+}
+
+// List gets a page of the comments selected by the filter.
+func (c *Comments) List(f CommentFilter, q *ListQuery) (*Cursor, error) {
+	var conds []string
+	var args []interface{}
+	switch f.Status {
+	case "approved":
+		conds = append(conds, "approved = 1")
+	case "pending":
+		conds = append(conds, "approved = 0")
+	}
+	if f.PostId != 0 {
+		conds = append(conds, "post_id = ?")
+		args = append(args, f.PostId)
+	}
+	if err := queryList(c, "comments", commentSortKeys, q, conds, args); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*c), func(i int) (string, int64) {
+		if q.Sort == "created_at" {
+			return cursorTime((*c)[i].CreatedAt), (*c)[i].Id
+		}
+		return "", (*c)[i].Id
+	})
+	*c = (*c)[:n]
+	return next, nil
+}
+
+// List gets a page of the users.
+func (users *Users) List(q *ListQuery) (*Cursor, error) {
+	if err := queryList(users, "users", userSortKeys, q, nil, nil); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*users), func(i int) (string, int64) {
+		u := (*users)[i]
+		switch q.Sort {
+		case "name":
+			return u.Name, u.Id
+		case "created_at":
+			return cursorTime(u.CreatedAt), u.Id
+		}
+		return "", u.Id
+	})
+	*users = (*users)[:n]
+	return next, nil
+}
+
+// List gets a page of the media library.
+func (ml *MediaList) List(q *ListQuery) (*Cursor, error) {
+	if err := queryList(ml, "media", mediaSortKeys, q, nil, nil); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*ml), func(i int) (string, int64) {
+		m := (*ml)[i]
+		switch q.Sort {
+		case "name":
+			return m.Name, m.Id
+		case "size":
+			return fmt.Sprint(m.Size), m.Id
+		case "created_at":
+			return cursorTime(m.CreatedAt), m.Id
+		}
+		return "", m.Id
+	})
+	*ml = (*ml)[:n]
+	return next, nil
+}
+
+// List gets a page of the settings, of the given type unless it is empty.
+func (settings *Settings) List(t string, q *ListQuery) (*Cursor, error) {
+	var conds []string
+	var args []interface{}
+	if t != "" {
+		conds = append(conds, "type = ?")
+		args = append(args, t)
+	}
+	if err := queryList(settings, "settings", settingSortKeys, q, conds, args); err != nil {
+		return nil, err
+	}
+	next, n := nextCursor(q, len(*settings), func(i int) (string, int64) {
+		s := (*settings)[i]
+		switch q.Sort {
+		case "key":
+			return s.Ke, int64(s.Id)
+		case "type":
+			return s.Type, int64(s.Id)
+		}
+		return "", int64(s.Id)
+	})
+	*settings = (*settings)[:n]
+	return next, nil
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/markdown"
+)
+
+const stmtGetAllPostMarkdown = `SELECT id, markdown, html, toc, word_count, reading_time FROM posts`
+const stmtUpdatePostHtml = `UPDATE posts SET html = ?, toc = ?, word_count = ?, reading_time = ? WHERE id = ?`
+
+// The settings holding the markdown pipeline. Lists are comma separated.
+const (
+	settingMarkdownExtensions     = "markdown_extensions"
+	settingMarkdownSanitizer      = "markdown_sanitizer"
+	settingMarkdownPostProcessors = "markdown_postprocessors"
+	settingHighlightStyle         = "highlight_style"
+)
+
+// SetMarkdownConfig changes the markdown pipeline. Posts keep the HTML they
+// were rendered with until they are saved, or RerenderPosts is called.
+func SetMarkdownConfig(c markdown.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	settings := map[string]string{
+		settingMarkdownExtensions:     strings.Join(c.Extensions, ","),
+		settingMarkdownSanitizer:      c.Sanitizer,
+		settingMarkdownPostProcessors: strings.Join(c.PostProcessors, ","),
+	}
+	for k, v := range settings {
+		if err := NewSetting(k, v, "markdown").Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMarkdownSetting changes one of the settings of the markdown pipeline,
+// checking the pipeline it makes.
+func setMarkdownSetting(k, v string) error {
+	c := markdown.GetConfig()
+	list := strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	switch k {
+	case settingMarkdownExtensions:
+		c.Extensions = list
+	case settingMarkdownSanitizer:
+		c.Sanitizer = v
+	case settingMarkdownPostProcessors:
+		c.PostProcessors = list
+	case settingHighlightStyle:
+		return SetHighlightStyle(v)
+	}
+	return SetMarkdownConfig(c)
+}
+
+// GetHighlightStyle returns the style of the highlighted code.
+func GetHighlightStyle() string {
+	if style := GetSettingValue(settingHighlightStyle); style != "" {
+		return style
+	}
+	return markdown.DefaultHighlightStyle
+}
+
+// SetHighlightStyle changes the style of the highlighted code. The posts
+// don't need to be rendered again, as only the CSS changes.
+func SetHighlightStyle(style string) error {
+	for _, s := range markdown.HighlightStyles() {
+		if s == style {
+			return NewSetting(settingHighlightStyle, style, "markdown").Save()
+		}
+	}
+	return fmt.Errorf("Unknown highlight style: %s", style)
+}
+
+// RerenderPosts renders the markdown of every post and page again with the
+// current pipeline, along with their table of contents, word count and
+// reading time, and returns the number of posts which changed. The posts are
+// not marked as updated.
+func RerenderPosts() (int, error) {
+	rows, err := db.Query(stmtGetAllPostMarkdown)
+	if err != nil {
+		return 0, err
+	}
+	changed := make([]*Post, 0)
+	for rows.Next() {
+		var md, html, toc sql.NullString
+		p := new(Post)
+		if err := rows.Scan(&p.Id, &md, &html, &toc, &p.WordCount, &p.ReadingTime); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		old := *p
+		p.Html = markdown.Render(md.String)
+		p.updateOutline()
+		b, _ := json.Marshal(p.TOC)
+		if p.Html != html.String || string(b) != toc.String ||
+			p.WordCount != old.WordCount || p.ReadingTime != old.ReadingTime {
+			changed = append(changed, p)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	defer resetRelatedPosts()
+	for i, p := range changed {
+		toc, _ := json.Marshal(p.TOC)
+		if _, err := db.Exec(stmtUpdatePostHtml, p.Html, string(toc), p.WordCount, p.ReadingTime, p.Id); err != nil {
+			return i, err
+		}
+	}
+	return len(changed), nil
+}
+
+func init() {
+	// External links are found by the host of the site.
+	Subscribe(func(e Event) {
+		if s := e.(SettingChanged).Setting; s.Type == "markdown" || s.Ke == "site_url" {
+			loadMarkdownConfig()
+		}
+	}, EventNameSettingChanged)
+}
+
+// loadMarkdownConfig configures the markdown pipeline from the settings,
+// keeping the default for the settings which are missing or invalid.
+func loadMarkdownConfig() {
+	c := markdown.DefaultConfig()
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	s := &Setting{Ke: settingMarkdownExtensions}
+	if s.GetSetting() == nil {
+		c.Extensions = split(s.Value)
+	}
+	if v := GetSettingValue(settingMarkdownSanitizer); v != "" {
+		c.Sanitizer = v
+	}
+	s = &Setting{Ke: settingMarkdownPostProcessors}
+	if s.GetSetting() == nil {
+		c.PostProcessors = split(s.Value)
+	}
+	if u, err := url.Parse(GetSettingValue("site_url")); err == nil {
+		c.Host = u.Host
+	}
+	if markdown.Configure(c) != nil {
+		d := markdown.DefaultConfig()
+		d.Host = c.Host
+		markdown.Configure(d)
+	}
+}
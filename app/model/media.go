@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+	_ "golang.org/x/image/webp"
+)
+
+const stmtGetMediaById = `SELECT * FROM media WHERE id = ?`
+const stmtGetMediaByChecksum = `SELECT * FROM media WHERE checksum = ?`
+const stmtGetMediaByPath = `SELECT * FROM media WHERE path = ? OR id IN (SELECT media_id FROM media_variants WHERE path = ?)`
+const stmtGetMediaList = `SELECT * FROM media ORDER BY created_at DESC LIMIT ? OFFSET ?`
+const stmtGetNumberOfMedia = `SELECT count(*) FROM media`
+const stmtGetMediaVariants = `SELECT * FROM media_variants WHERE media_id = ? ORDER BY width`
+const stmtGetPostsByMediaId = `SELECT * FROM posts WHERE id IN (SELECT post_id FROM posts_media WHERE media_id = ?)`
+const stmtInsertPostMedia = `INSERT INTO posts_media (id, post_id, media_id) VALUES (?, ?, ?)`
+const stmtDeletePostMediaByPostId = `DELETE FROM posts_media WHERE post_id = ?`
+const stmtDeletePostMediaByMediaId = `DELETE FROM posts_media WHERE media_id = ?`
+const stmtDeleteMediaVariants = `DELETE FROM media_variants WHERE media_id = ?`
+const stmtDeleteMediaById = `DELETE FROM media WHERE id = ?`
+
+// An ImageVariant describes a resized copy of an uploaded image. The resized
+// image always fits inside a box of Width by Height pixels.
+type ImageVariant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// ImageVariants are the resized copies generated for every uploaded image.
+var ImageVariants = []ImageVariant{
+	{"thumbnail", 150, 150},
+	{"medium", 640, 640},
+	{"large", 1280, 1280},
+}
+
+var rxUploadPath = regexp.MustCompile(`upload/[^\s"'()<>\[\]]+`)
+
+// A Media is an uploaded file, along with the metadata needed to show it in
+// the media library.
+type Media struct {
+	Id        int64      `meddler:"id,pk"`
+	Name      string     `meddler:"name"`
+	Path      string     `meddler:"path"`
+	MimeType  string     `meddler:"mime_type"`
+	Size      int64      `meddler:"size"`
+	Width     int        `meddler:"width"`
+	Height    int        `meddler:"height"`
+	Alt       string     `meddler:"alt"`
+	Checksum  string     `meddler:"checksum"`
+	CreatedAt *time.Time `meddler:"created_at"`
+	CreatedBy int64      `meddler:"created_by"`
+	UpdatedAt *time.Time `meddler:"updated_at"`
+	UpdatedBy int64      `meddler:"updated_by"`
+}
+
+// A MediaVariant is a resized copy of an image Media.
+type MediaVariant struct {
+	Id      int64  `meddler:"id,pk"`
+	MediaId int64  `meddler:"media_id"`
+	Name    string `meddler:"name"`
+	Path    string `meddler:"path"`
+	Width   int    `meddler:"width"`
+	Height  int    `meddler:"height"`
+}
+
+// MediaList is a slice of "Media"s.
+type MediaList []*Media
+
+// Len returns the amount of "Media"s.
+func (ml MediaList) Len() int {
+	return len(ml)
+}
+
+// Get returns the Media at the given index.
+func (ml MediaList) Get(i int) *Media {
+	return ml[i]
+}
+
+// NewMedia creates a new Media with the given original file name, with the
+// CreatedAt and UpdatedAt fields set to the current time.
+func NewMedia(name string) *Media {
+	return &Media{
+		Name:      name,
+		CreatedAt: utils.Now(),
+		UpdatedAt: utils.Now(),
+	}
+}
+
+// Url returns the URL of the media file.
+func (m *Media) Url() string {
+	return "/" + m.Path
+}
+
+// IsImage returns whether or not the media is an image.
+func (m *Media) IsImage() bool {
+	return strings.HasPrefix(m.MimeType, "image/")
+}
+
+// Variants returns the resized copies of the media, smallest first.
+func (m *Media) Variants() []*MediaVariant {
+	variants := make([]*MediaVariant, 0)
+	_ = meddler.QueryAll(db, &variants, stmtGetMediaVariants, m.Id)
+	return variants
+}
+
+// VariantUrl returns the URL of the variant with the given name, falling back
+// to the original file if no such variant exists.
+func (m *Media) VariantUrl(name string) string {
+	for _, v := range m.Variants() {
+		if v.Name == name {
+			return "/" + v.Path
+		}
+	}
+	return m.Url()
+}
+
+// Posts returns all the posts that reference the media.
+func (m *Media) Posts() Posts {
+	var posts Posts
+	_ = meddler.QueryAll(db, &posts, stmtGetPostsByMediaId, m.Id)
+	return posts
+}
+
+// IsUsed returns whether or not any post references the media.
+func (m *Media) IsUsed() bool {
+	return len(m.Posts()) > 0
+}
+
+// Save saves the media to the DB.
+func (m *Media) Save() error {
+	return meddler.Save(db, "media", m)
+}
+
+// GetMediaById finds the media by ID in the DB.
+func (m *Media) GetMediaById() error {
+	return meddler.QueryRow(db, m, stmtGetMediaById, m.Id)
+}
+
+// GetMediaByChecksum finds the media by checksum in the DB, used to avoid
+// storing the same file twice.
+func (m *Media) GetMediaByChecksum() error {
+	return meddler.QueryRow(db, m, stmtGetMediaByChecksum, m.Checksum)
+}
+
+// GetMediaByPath finds the media whose file, or one of whose variants, is
+// stored at the given path.
+func (m *Media) GetMediaByPath(p string) error {
+	return meddler.QueryRow(db, m, stmtGetMediaByPath, p, p)
+}
+
+// ErrImageNotDecodable is returned by GenerateVariants for images which can't
+// be decoded, and so have no variants.
+var ErrImageNotDecodable = errors.New("The image can not be decoded.")
+
+// GenerateVariants writes a resized copy of the image for every entry in
+// ImageVariants that is smaller than the original, and saves them to the DB in
+// place of the variants it had. It does nothing for media that are not images.
+func (m *Media) GenerateVariants() error {
+	if !m.IsImage() {
+		return nil
+	}
+	if _, err := db.Exec(stmtDeleteMediaVariants, m.Id); err != nil {
+		return err
+	}
+	src, err := os.Open(m.Path)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(src)
+	src.Close()
+	if err != nil {
+		return ErrImageNotDecodable
+	}
+	ext := path.Ext(m.Path)
+	base := strings.TrimSuffix(m.Path, ext)
+	if format == "webp" {
+		// WebP can only be decoded, so its variants are encoded as JPEG.
+		ext = ".jpg"
+	}
+	for _, iv := range ImageVariants {
+		if m.Width <= iv.Width && m.Height <= iv.Height {
+			continue
+		}
+		resized := utils.ResizeImage(img, iv.Width, iv.Height)
+		v := &MediaVariant{
+			MediaId: m.Id,
+			Name:    iv.Name,
+			Path:    base + "-" + iv.Name + ext,
+			Width:   resized.Bounds().Dx(),
+			Height:  resized.Bounds().Dy(),
+		}
+		f, err := os.Create(v.Path)
+		if err != nil {
+			return err
+		}
+		err = utils.EncodeImage(f, resized, format)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if err = meddler.Insert(db, "media_variants", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the media, its variants and its post references from the DB,
+// along with the files on disk.
+func (m *Media) Delete() error {
+	for _, v := range m.Variants() {
+		RemoveFile(v.Path)
+	}
+	if err := RemoveFile(m.Path); err != nil {
+		return err
+	}
+	writeDB, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{stmtDeleteMediaVariants, stmtDeletePostMediaByMediaId, stmtDeleteMediaById} {
+		if _, err = writeDB.Exec(stmt, m.Id); err != nil {
+			writeDB.Rollback()
+			return err
+		}
+	}
+	return writeDB.Commit()
+}
+
+// GetMediaList returns a new pager based on all the media in the DB, newest
+// first.
+func (ml *MediaList) GetMediaList(page, size int64) (*utils.Pager, error) {
+	count, err := GetNumberOfMedia()
+	if err != nil {
+		return nil, err
+	}
+	pager := utils.NewPager(page, size, count)
+	if !pager.IsValid {
+		return pager, fmt.Errorf("Page not found")
+	}
+	err = meddler.QueryAll(db, ml, stmtGetMediaList, size, pager.Begin)
+	return pager, err
+}
+
+// GetNumberOfMedia returns the total number of media in the DB.
+func GetNumberOfMedia() (int64, error) {
+	var count int64
+	row := db.QueryRow(stmtGetNumberOfMedia)
+	err := row.Scan(&count)
+	return count, err
+}
+
+// UpdatePostMediaRefs records which media the given post references, by
+// looking for upload paths in its markdown and featured image.
+func UpdatePostMediaRefs(p *Post) error {
+	writeDB, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = writeDB.Exec(stmtDeletePostMediaByPostId, p.Id); err != nil {
+		writeDB.Rollback()
+		return err
+	}
+	seen := make(map[int64]bool)
+	for _, ref := range rxUploadPath.FindAllString(p.Markdown+"\n"+p.Image, -1) {
+		m := new(Media)
+		if err := m.GetMediaByPath(path.Clean(ref)); err != nil || seen[m.Id] {
+			continue
+		}
+		seen[m.Id] = true
+		if _, err = writeDB.Exec(stmtInsertPostMedia, nil, p.Id, m.Id); err != nil {
+			writeDB.Rollback()
+			return err
+		}
+	}
+	return writeDB.Commit()
+}
+
+// DeletePostMediaByPostId removes the media references of the given post.
+func DeletePostMediaByPostId(postId int64) error {
+	_, err := db.Exec(stmtDeletePostMediaByPostId, postId)
+	return err
+}
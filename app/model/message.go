@@ -1,8 +1,9 @@
 package model
 
 import (
+	"fmt"
+	"html"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/luohao-brian/SimplePosts/app/utils"
@@ -18,6 +19,24 @@ var (
 func init() {
 	messageGenerator = make(map[string]func(v interface{}) string)
 	messageGenerator["backup"] = generateBackupMessage
+	messageGenerator["comment"] = generateCommentMessage
+	Subscribe(func(e Event) { postMessage("backup", e) }, EventNameBackupFinished)
+	Subscribe(func(e Event) {
+		// The comments of the users, such as the replies of the admin, are
+		// not worth a message.
+		if c := e.(CommentCreated).Comment; c.UserId == 0 {
+			postMessage("comment", c)
+		}
+	}, EventNameCommentCreated)
+}
+
+// postMessage posts a message of the given type for the admin.
+func postMessage(tp string, data interface{}) {
+	if m := NewMessage(tp, data); m != nil {
+		if err := m.Insert(); err != nil {
+			log.Printf("[Error]: can not post the %s message: %v", tp, err)
+		}
+	}
 }
 
 // A Message is a simple bit of info, used to alert the admin on the admin
@@ -73,10 +92,21 @@ func (m *Messages) GetUnreadMessages() {
 	return
 }
 
-func generateBackupMessage(co interface{}) string {
-	str := co.(string)
-	if strings.HasPrefix(str, "[0]") {
-		return "Failed to back up the site: " + strings.TrimPrefix(str, "[0]") + "."
+func generateBackupMessage(v interface{}) string {
+	e := v.(BackupFinished)
+	if e.Err != nil {
+		return "Failed to back up the site: " + html.EscapeString(e.Err.Error()) + "."
+	}
+	return "The site is successfully backed up at: " + html.EscapeString(e.File)
+}
+
+func generateCommentMessage(v interface{}) string {
+	c := v.(*Comment)
+	post := c.Post()
+	status := ""
+	if !c.Approved {
+		status = " It is waiting for approval."
 	}
-	return "The site is successfully backed up at: " + strings.TrimPrefix(str, "[1]")
+	return fmt.Sprintf(`<strong>%s</strong> commented on <a href="%s/">%s</a>.%s`,
+		html.EscapeString(c.Author), html.EscapeString(post.Url()), html.EscapeString(post.Title), status)
 }
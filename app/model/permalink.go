@@ -0,0 +1,242 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPermalink is the permalink of posts unless another is chosen in the
+// "permalink" setting. Pages always use it.
+const DefaultPermalink = "/:slug/"
+
+// permalinkTokens are the placeholders a permalink may use, each taking a
+// whole segment of the path, along with what they match.
+var permalinkTokens = map[string]*regexp.Regexp{
+	":year":     regexp.MustCompile(`^[0-9]{4}$`),
+	":month":    regexp.MustCompile(`^[0-9]{2}$`),
+	":day":      regexp.MustCompile(`^[0-9]{2}$`),
+	":id":       regexp.MustCompile(`^[0-9]+$`),
+	":slug":     regexp.MustCompile(`^[^/]+$`),
+	":category": regexp.MustCompile(`^[^/]+$`),
+}
+
+var rxPermalinkSegment = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// A Permalink is the pattern of the URLs of posts, such as
+// "/:year/:month/:slug/". The category of a post is the slug of its first
+// tag, as posts don't have categories of their own.
+type Permalink string
+
+// permalinks caches the permalink settings, as they are needed for the URL of
+// every post.
+var permalinks struct {
+	sync.RWMutex
+	loaded  bool
+	current Permalink
+	history []Permalink
+}
+
+// Validate checks that the permalink only uses known placeholders and
+// identifies a single post, and that it can't hide the other pages of the
+// blog.
+func (pl Permalink) Validate() error {
+	s := string(pl)
+	if !strings.HasPrefix(s, "/") || !strings.HasSuffix(s, "/") || len(s) < 2 {
+		return fmt.Errorf("The permalink should start and end with \"/\".")
+	}
+	segments := strings.Split(strings.Trim(s, "/"), "/")
+	unique := false
+	for i, seg := range segments {
+		if _, ok := permalinkTokens[seg]; ok {
+			unique = unique || seg == ":slug" || seg == ":id"
+			continue
+		}
+		if !rxPermalinkSegment.MatchString(seg) {
+			return fmt.Errorf("Unknown permalink segment: %s", seg)
+		}
+		if i == 0 && isReservedSegment(seg) {
+			return fmt.Errorf("The permalink can't start with /%s/.", seg)
+		}
+	}
+	if !unique {
+		return fmt.Errorf("The permalink should contain :slug or :id.")
+	}
+	return nil
+}
+
+// Url returns the URL of the post following the permalink, without the
+// trailing slash.
+func (pl Permalink) Url(p *Post) string {
+	t := time.Now()
+	if p.PublishedAt != nil {
+		t = *p.PublishedAt
+	} else if p.CreatedAt != nil {
+		t = *p.CreatedAt
+	}
+	t = t.UTC()
+	segments := strings.Split(strings.Trim(string(pl), "/"), "/")
+	for i, seg := range segments {
+		switch seg {
+		case ":year":
+			segments[i] = strconv.Itoa(t.Year())
+		case ":month":
+			segments[i] = fmt.Sprintf("%02d", t.Month())
+		case ":day":
+			segments[i] = fmt.Sprintf("%02d", t.Day())
+		case ":id":
+			segments[i] = strconv.FormatInt(p.Id, 10)
+		case ":slug":
+			segments[i] = p.Slug
+		case ":category":
+			segments[i] = postCategory(p)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// postCategory returns the category of the post in its URL, the slug of its
+// first tag, or "uncategorized" if it has none. The slugs of the routes of the
+// blog, such as "tag", and years are left out too, as the URL would lead to
+// the tag pages or the archives instead of the post.
+func postCategory(p *Post) string {
+	if tags := p.Tags(); len(tags) > 0 && tags[0].Slug != "" && !isReservedSegment(tags[0].Slug) {
+		return tags[0].Slug
+	}
+	return "uncategorized"
+}
+
+// Match returns the values of the placeholders if the path follows the
+// permalink. A category is never the slug of a route of the blog or a year,
+// as postCategory leaves them out.
+func (pl Permalink) Match(path string) (map[string]string, bool) {
+	pattern := strings.Split(strings.Trim(string(pl), "/"), "/")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(pattern) != len(segments) || !strings.HasSuffix(path, "/") {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, seg := range pattern {
+		if rx, ok := permalinkTokens[seg]; ok {
+			if !rx.MatchString(segments[i]) || (seg == ":category" && isReservedSegment(segments[i])) {
+				return nil, false
+			}
+			values[seg] = segments[i]
+		} else if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// GetPermalink returns the permalink of posts.
+func GetPermalink() Permalink {
+	loadPermalinks()
+	permalinks.RLock()
+	defer permalinks.RUnlock()
+	return permalinks.current
+}
+
+// SetPermalink changes the permalink of posts. The previous permalink is
+// remembered, so the URLs following it are redirected to the new ones.
+func SetPermalink(pl Permalink) error {
+	if err := pl.Validate(); err != nil {
+		return err
+	}
+	old := GetPermalink()
+	if pl == old {
+		return nil
+	}
+	history := []Permalink{old}
+	for _, h := range getPermalinkHistory() {
+		if h != pl && h != old {
+			history = append(history, h)
+		}
+	}
+	b, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	if err = NewSetting("permalink_history", string(b), "permalink").Save(); err != nil {
+		return err
+	}
+	return NewSetting("permalink", string(pl), "permalink").Save()
+}
+
+// GetPostByUrl finds the post at the given path following the current or a
+// previous permalink, other than DefaultPermalink, which is routed to
+// ContentHandler. The post is found even if the other placeholders of the
+// path are wrong, or its slug has since changed, so the caller should
+// redirect to its URL if it's not the given path.
+func GetPostByUrl(path string) (*Post, bool) {
+	// The routes of the blog always win over permalinks starting with a
+	// placeholder.
+	if first := strings.SplitN(strings.Trim(path, "/"), "/", 2)[0]; reservedSlugs[first] {
+		return nil, false
+	}
+	patterns := append([]Permalink{GetPermalink()}, getPermalinkHistory()...)
+	for _, pl := range patterns {
+		if pl == DefaultPermalink {
+			continue
+		}
+		values, ok := pl.Match(path)
+		if !ok {
+			continue
+		}
+		post := new(Post)
+		var err error
+		if id, ok := values[":id"]; ok {
+			n, _ := strconv.ParseInt(id, 10, 64)
+			err = post.GetPostById(n)
+		} else if err = post.GetPostBySlug(values[":slug"]); err != nil {
+			post, err = GetPostBySlugHistory(values[":slug"])
+		}
+		if err == nil && !post.IsPage {
+			return post, true
+		}
+	}
+	return nil, false
+}
+
+func getPermalinkHistory() []Permalink {
+	loadPermalinks()
+	permalinks.RLock()
+	defer permalinks.RUnlock()
+	return permalinks.history
+}
+
+func loadPermalinks() {
+	permalinks.RLock()
+	loaded := permalinks.loaded
+	permalinks.RUnlock()
+	if loaded {
+		return
+	}
+	permalinks.Lock()
+	defer permalinks.Unlock()
+	permalinks.current = Permalink(GetSettingValue("permalink"))
+	if permalinks.current.Validate() != nil {
+		permalinks.current = DefaultPermalink
+	}
+	permalinks.history = nil
+	json.Unmarshal([]byte(GetSettingValue("permalink_history")), &permalinks.history)
+	permalinks.loaded = true
+}
+
+func init() {
+	Subscribe(func(e Event) {
+		if k := e.(SettingChanged).Setting.Ke; k == "permalink" || k == "permalink_history" {
+			resetPermalinks()
+		}
+	}, EventNameSettingChanged)
+}
+
+func resetPermalinks() {
+	permalinks.Lock()
+	permalinks.loaded = false
+	permalinks.Unlock()
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/luohao-brian/SimplePosts/app/markdown"
 	"github.com/luohao-brian/SimplePosts/app/utils"
 	"github.com/russross/meddler"
 )
@@ -18,7 +19,10 @@ const stmtGetPostBySlug = `SELECT * FROM posts WHERE slug = ?`
 const stmtGetPostsByTag = `SELECT * FROM posts WHERE %s id IN ( SELECT post_id FROM posts_tags WHERE tag_id = ? ) ORDER BY published_at DESC LIMIT ? OFFSET ?`
 const stmtGetAllPostsByTag = `SELECT * FROM posts WHERE id IN ( SELECT post_id FROM posts_tags WHERE tag_id = ?) ORDER BY published_at DESC `
 const stmtGetPostsCountByTag = "SELECT count(*) FROM posts, posts_tags WHERE posts_tags.post_id = posts.id AND posts.published AND posts_tags.tag_id = ?"
-const stmtGetPostsOffsetLimit = `SELECT * FROM posts WHERE published = ? LIMIT ?, ?`
+const stmtGetPostsByAuthor = `SELECT * FROM posts WHERE %s NOT page AND created_by = ? ORDER BY published_at DESC LIMIT ? OFFSET ?`
+const stmtGetPostsCountByAuthor = `SELECT count(*) FROM posts WHERE %s NOT page AND created_by = ?`
+const stmtGetPostsOffsetLimit = `SELECT * FROM posts WHERE published = ? ORDER BY published_at DESC, id DESC LIMIT ?, ?`
+const stmtGetAllPostsOffsetLimit = `SELECT * FROM posts ORDER BY published_at DESC, id DESC LIMIT ?, ?`
 const stmtInsertPostTag = `INSERT INTO posts_tags (id, post_id, tag_id) VALUES (?, ?, ?)`
 const stmtDeletePostTagsByPostId = `DELETE FROM posts_tags WHERE post_id = ?`
 const stmtNumberOfPosts = "SELECT count(*) FROM posts WHERE %s"
@@ -59,10 +63,16 @@ type Post struct {
 	UpdatedBy       int64      `meddler:"updated_by",json:"updated_by"`
 	PublishedAt     *time.Time `meddler:"published_at",json:"published_at"`
 	PublishedBy     int64      `meddler:"published_by",json:"published_by"`
+	TOC             Outline    `meddler:"toc,json"`
+	WordCount       int64      `meddler:"word_count"`
+	ReadingTime     int64      `meddler:"reading_time"` // In minutes
 	Hits            int64      `meddler:"-"`
 	Category        string     `meddler:"-"`
 }
 
+// An Outline is the table of contents of a post, as a tree of headings.
+type Outline []*markdown.Heading
+
 // Posts is a slice of "Post"s
 type Posts []*Post
 
@@ -104,9 +114,23 @@ func (p *Post) TagString() string {
 	return tagString
 }
 
-// Url returns the URL of the post.
+// Url returns the URL of the post, following the permalink setting, or of the
+// page.
 func (p *Post) Url() string {
-	return "/" + p.Slug
+	if p.IsPage {
+		return "/" + p.Slug
+	}
+	return GetPermalink().Url(p)
+}
+
+// MarshalJSON adds the URL of the post to its JSON encoding, which is what the
+// API sends.
+func (p *Post) MarshalJSON() ([]byte, error) {
+	type post Post
+	return json.Marshal(struct {
+		post
+		Url string
+	}{post(*p), p.Url() + "/"})
 }
 
 // Tags returns a slice of every tag associated with the post.
@@ -142,7 +166,8 @@ func (p *Post) Excerpt() string {
 	return utils.Html2Excerpt(p.Html, 50)
 }
 
-// Save saves a post to the DB, updating any given tags to include the Post ID.
+// Save saves a post to the DB, updating any given tags to include the Post ID,
+// and emits PostSaved.
 func (p *Post) Save(tags ...*Tag) error {
 	p.Slug = strings.TrimLeft(p.Slug, "/")
 	p.Slug = strings.TrimRight(p.Slug, "/")
@@ -150,9 +175,24 @@ func (p *Post) Save(tags ...*Tag) error {
 		return fmt.Errorf("Slug can not be empty or root")
 	}
 
-	if p.IsPublished {
+	event := PostSaved{Created: p.Id == 0}
+	current := &Post{Id: p.Id}
+	if !event.Created {
+		if current.GetPostById() == nil {
+			event.WasPublished = current.IsPublished
+		}
+		event.OldTagIds = current.tagIds()
+	}
+
+	// The publish date only changes when the post gets published, so that
+	// editing a post doesn't move it in the archives, the feeds or the date
+	// based permalinks.
+	if p.IsPublished && !event.WasPublished {
 		p.PublishedAt = utils.Now()
 		p.PublishedBy = p.CreatedBy
+	} else if p.IsPublished && p.PublishedAt == nil {
+		p.PublishedAt = current.PublishedAt
+		p.PublishedBy = current.PublishedBy
 	}
 
 	p.UpdatedAt = utils.Now()
@@ -173,7 +213,6 @@ func (p *Post) Save(tags ...*Tag) error {
 	for _, t := range tags {
 		t.CreatedAt = utils.Now()
 		t.CreatedBy = p.CreatedBy
-		t.Hidden = !p.IsPublished
 		t.Save()
 		tagIds = append(tagIds, t.Id)
 	}
@@ -189,12 +228,30 @@ func (p *Post) Save(tags ...*Tag) error {
 			return err
 		}
 	}
+	if err := UpdatePostMediaRefs(p); err != nil {
+		return err
+	}
+	post := *p
+	event.Post = &post
+	Emit(event)
 	return nil
-	//	return DeleteOldTags()
+}
+
+// tagIds returns the IDs of the tags of the post.
+func (p *Post) tagIds() []int64 {
+	ids := make([]int64, 0)
+	for _, t := range p.Tags() {
+		ids = append(ids, t.Id)
+	}
+	return ids
 }
 
 // Insert saves a post to the DB.
 func (p *Post) Insert() error {
+	if err := ValidatePostSlug(p.Slug); err != nil {
+		return err
+	}
+	p.updateOutline()
 	if !PostChangeSlug(p.Slug) {
 		p.Slug = generateNewSlug(p.Slug, 1)
 	}
@@ -224,11 +281,30 @@ func (p *Post) Update() error {
 	if err != nil {
 		return err
 	}
-	if p.Slug != currentPost.Slug && !PostChangeSlug(p.Slug) {
-		p.Slug = generateNewSlug(p.Slug, 1)
+	if p.Slug != currentPost.Slug {
+		if err = ValidatePostSlug(p.Slug); err != nil {
+			return err
+		}
+		if !PostChangeSlug(p.Slug) {
+			p.Slug = generateNewSlug(p.Slug, 1)
+		}
 	}
+	p.updateOutline()
 	err = meddler.Update(db, "posts", p)
-	return err
+	if err != nil {
+		return err
+	}
+	return RecordSlugChange(p.Id, currentPost.Slug, p.Slug)
+}
+
+// updateOutline sets the table of contents, the word count and the reading
+// time of the post from its HTML, adding IDs to the headings without one.
+func (p *Post) updateOutline() {
+	p.Html, p.TOC = markdown.Outline(p.Html)
+	text := utils.Html2Str(p.Html)
+	words, chars := utils.CountWords(text)
+	p.WordCount = int64(words + chars)
+	p.ReadingTime = int64(utils.ReadingTime(text))
 }
 
 // UpdateFromRequest updates an existing Post in the DB based on the data
@@ -237,10 +313,15 @@ func (p *Post) UpdateFromRequest(r *http.Request) {
 	p.Title = r.FormValue("title")
 	p.Image = r.FormValue("image")
 	p.Slug = r.FormValue("slug")
+	if strings.Trim(p.Slug, "/ ") == "" {
+		p.Slug = GenerateSlugFor(p.Title, "posts", p.Id)
+	}
 	p.Markdown = r.FormValue("content")
 	p.Html = utils.Markdown2Html(p.Markdown)
 	p.AllowComment = r.FormValue("comment") == "on"
 	p.Category = r.FormValue("category")
+	p.MetaTitle = strings.TrimSpace(r.FormValue("meta_title"))
+	p.MetaDescription = strings.TrimSpace(r.FormValue("meta_description"))
 	p.IsPublished = r.FormValue("status") == "on"
 }
 
@@ -253,12 +334,21 @@ func (p *Post) UpdateFromJSON(j []byte) error {
 	return nil
 }
 
+// Publish publishes the post, and emits PostSaved. A post which is already
+// published keeps its publish date.
 func (p *Post) Publish(by int64) error {
-	p.PublishedAt = utils.Now()
-	p.PublishedBy = by
+	wasPublished := p.IsPublished
+	if !wasPublished {
+		p.PublishedAt = utils.Now()
+		p.PublishedBy = by
+	}
 	p.IsPublished = true
-	err := meddler.Update(db, "posts", p)
-	return err
+	if err := meddler.Update(db, "posts", p); err != nil {
+		return err
+	}
+	post := *p
+	Emit(PostSaved{Post: &post, WasPublished: wasPublished})
+	return nil
 }
 
 // DeletePostTagsByPostId deletes removes tags associated with the given post
@@ -277,8 +367,14 @@ func DeletePostTagsByPostId(post_id int64) error {
 	return writeDB.Commit()
 }
 
-// DeletePostById deletes the given Post from the DB.
+// DeletePostById deletes the given Post from the DB, and emits PostDeleted.
 func DeletePostById(id int64) error {
+	// The subscribers get the post as it was before it was deleted.
+	post := &Post{Id: id}
+	if post.GetPostById() != nil {
+		post = &Post{Id: id}
+	}
+	event := PostDeleted{Post: post, OldTagIds: post.tagIds()}
 	writeDB, err := db.Begin()
 	if err != nil {
 		writeDB.Rollback()
@@ -297,8 +393,16 @@ func DeletePostById(id int64) error {
 	if err != nil {
 		return err
 	}
+	err = DeletePostMediaByPostId(id)
+	if err != nil {
+		return err
+	}
+	err = DeleteSlugHistoryByPostId(id)
+	if err != nil {
+		return err
+	}
+	Emit(event)
 	return nil
-	//	return DeleteOldTags()
 }
 
 // GetPostById gets the post based on the Post ID.
@@ -344,6 +448,32 @@ func (p *Posts) GetPostsByTag(tagId, page, size int64, onlyPublished bool) (*uti
 	return pager, err
 }
 
+// GetPostsByAuthor returns a new pager based on all the Posts written by the
+// given user. Pages are left out.
+func (p *Posts) GetPostsByAuthor(userId, page, size int64, onlyPublished bool) (*utils.Pager, error) {
+	var (
+		pager *utils.Pager
+		count int64
+		where string
+	)
+	if onlyPublished {
+		where = "published AND"
+	}
+	row := db.QueryRow(fmt.Sprintf(stmtGetPostsCountByAuthor, where), userId)
+	err := row.Scan(&count)
+	if err != nil {
+		utils.LogOnError(err, "Unable to get posts by author.", true)
+		return nil, err
+	}
+	pager = utils.NewPager(page, size, count)
+
+	if !pager.IsValid {
+		return pager, fmt.Errorf("Page not found")
+	}
+	err = meddler.QueryAll(db, p, fmt.Sprintf(stmtGetPostsByAuthor, where), userId, size, pager.Begin)
+	return pager, err
+}
+
 // GetAllPostsByTag gets all the Posts with the associated Tag.
 func (p *Posts) GetAllPostsByTag(tagId int64) error {
 	err := meddler.QueryAll(db, p, stmtGetAllPostsByTag, tagId)
@@ -474,14 +604,7 @@ func GetUnpublishedPosts(offset, limit int) (Posts, error) {
 }
 
 func GetAllPosts(offset, limit int) ([]*Post, error) {
-	pubPosts, err := GetPublishedPosts(offset, limit)
-	if err != nil {
-		return nil, err
-	}
-	unpubPosts, err := GetUnpublishedPosts(offset, limit)
-	if err != nil {
-		return nil, err
-	}
-	posts := append(pubPosts, unpubPosts...)
-	return posts, nil
+	var posts Posts
+	err := meddler.QueryAll(db, &posts, stmtGetAllPostsOffsetLimit, offset, limit)
+	return posts, err
 }
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetRedirectRules = `SELECT * FROM slug_redirects WHERE post_id = 0 ORDER BY source`
+const stmtGetSlugHistory = `SELECT * FROM slug_redirects WHERE post_id != 0 ORDER BY created_at DESC`
+const stmtGetRedirectBySlug = `SELECT * FROM slug_redirects WHERE post_id != 0 AND source = ? ORDER BY id DESC LIMIT 1`
+const stmtDeleteRedirectById = `DELETE FROM slug_redirects WHERE id = ?`
+const stmtDeleteSlugHistoryBySource = `DELETE FROM slug_redirects WHERE post_id != 0 AND source = ?`
+const stmtDeleteSlugHistoryByPostId = `DELETE FROM slug_redirects WHERE post_id = ?`
+
+// A Redirect sends the visitors of an old URL to its new location with a 301.
+// There are two kinds of redirects: the slug history of a post, recorded
+// whenever its slug changes, which has a PostId and always points to the
+// current URL of the post; and the rules added by the admin, typically for
+// content migrated from other systems, which redirect a path or, for prefix
+// rules, every path below it, to Target.
+type Redirect struct {
+	Id        int64      `meddler:"id,pk"`
+	Source    string     `meddler:"source"`
+	Target    string     `meddler:"target"`
+	PostId    int64      `meddler:"post_id"`
+	IsPrefix  bool       `meddler:"prefix"`
+	CreatedAt *time.Time `meddler:"created_at"`
+	CreatedBy int64      `meddler:"created_by"`
+}
+
+// Redirects is a slice of "Redirect"s.
+type Redirects []*Redirect
+
+// reservedPaths can't be redirected, so a rule can never lock the admin out.
+var reservedPaths = []string{"/admin", "/login", "/logout", "/signup", "/api", "/upload"}
+
+// redirectRules caches the rules added by the admin, as they are checked on
+// every request.
+var redirectRules struct {
+	sync.RWMutex
+	loaded bool
+	rules  Redirects
+}
+
+// NewRedirect creates a new redirect rule.
+func NewRedirect(source, target string, prefix bool) *Redirect {
+	return &Redirect{
+		Source:    strings.TrimSpace(source),
+		Target:    strings.TrimSpace(target),
+		IsPrefix:  prefix,
+		CreatedAt: utils.Now(),
+	}
+}
+
+// Post returns the post a slug history redirect points to.
+func (r *Redirect) Post() *Post {
+	post := &Post{Id: r.PostId}
+	post.GetPostById()
+	return post
+}
+
+// Validate checks that the redirect rule is well formed and can't loop.
+func (r *Redirect) Validate() error {
+	if !strings.HasPrefix(r.Source, "/") || r.Source == "/" {
+		return fmt.Errorf("The source should be a path starting with \"/\".")
+	}
+	for _, p := range reservedPaths {
+		if r.Source == p || strings.HasPrefix(r.Source, p+"/") {
+			return fmt.Errorf("%s can not be redirected.", p)
+		}
+	}
+	if r.Target == "" {
+		return fmt.Errorf("The target can not be empty.")
+	}
+	if strings.TrimRight(r.Source, "/") == strings.TrimRight(r.Target, "/") ||
+		(r.IsPrefix && strings.HasPrefix(r.Target, r.Source)) {
+		return fmt.Errorf("The redirect would loop.")
+	}
+	return nil
+}
+
+// Save validates and saves a redirect rule to the DB.
+func (r *Redirect) Save() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	err := meddler.Save(db, "slug_redirects", r)
+	resetRedirectRules()
+	return err
+}
+
+// GetRedirectRules returns the rules added by the admin.
+func (rs *Redirects) GetRedirectRules() error {
+	return meddler.QueryAll(db, rs, stmtGetRedirectRules)
+}
+
+// GetSlugHistory returns the previous slugs of all posts, newest first.
+func (rs *Redirects) GetSlugHistory() error {
+	return meddler.QueryAll(db, rs, stmtGetSlugHistory)
+}
+
+// DeleteRedirectById deletes the redirect with the given ID from the DB.
+func DeleteRedirectById(id int64) error {
+	_, err := db.Exec(stmtDeleteRedirectById, id)
+	resetRedirectRules()
+	return err
+}
+
+// RecordSlugChange remembers the previous slug of a post, so that its old URL
+// keeps working. Any history entry for the new slug is dropped, since the
+// slug now belongs to a post again.
+func RecordSlugChange(postId int64, oldSlug, newSlug string) error {
+	if oldSlug == "" || oldSlug == newSlug {
+		return nil
+	}
+	writeDB, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = writeDB.Exec(stmtDeleteSlugHistoryBySource, newSlug); err != nil {
+		writeDB.Rollback()
+		return err
+	}
+	r := &Redirect{Source: oldSlug, PostId: postId, CreatedAt: utils.Now()}
+	if err = meddler.Insert(writeDB, "slug_redirects", r); err != nil {
+		writeDB.Rollback()
+		return err
+	}
+	return writeDB.Commit()
+}
+
+// DeleteSlugHistoryByPostId forgets the previous slugs of a deleted post.
+func DeleteSlugHistoryByPostId(postId int64) error {
+	_, err := db.Exec(stmtDeleteSlugHistoryByPostId, postId)
+	return err
+}
+
+// GetPostBySlugHistory finds the post that used to have the given slug.
+func GetPostBySlugHistory(slug string) (*Post, error) {
+	r := new(Redirect)
+	if err := meddler.QueryRow(db, r, stmtGetRedirectBySlug, slug); err != nil {
+		return nil, err
+	}
+	post := new(Post)
+	if err := post.GetPostById(r.PostId); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// FindRedirect returns where the given path is redirected to by the rules
+// added by the admin. Exact rules win over prefix rules, and longer prefixes
+// over shorter ones. Trailing slashes are ignored.
+func FindRedirect(path string) (string, bool) {
+	var match *Redirect
+	for _, r := range getRedirectRules() {
+		if r.IsPrefix {
+			if hasPathPrefix(path, r.Source) && (match == nil || match.IsPrefix && len(r.Source) > len(match.Source)) {
+				match = r
+			}
+		} else if strings.TrimRight(path, "/") == strings.TrimRight(r.Source, "/") {
+			match = r
+			break
+		}
+	}
+	if match == nil {
+		return "", false
+	}
+	if match.IsPrefix {
+		return match.Target + strings.TrimPrefix(path, match.Source), true
+	}
+	return match.Target, true
+}
+
+// hasPathPrefix returns whether the path is the prefix or is below it, so that
+// "/blog" matches "/blog/post/" but not "/blogroll/".
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func getRedirectRules() Redirects {
+	redirectRules.RLock()
+	if redirectRules.loaded {
+		defer redirectRules.RUnlock()
+		return redirectRules.rules
+	}
+	redirectRules.RUnlock()
+
+	redirectRules.Lock()
+	defer redirectRules.Unlock()
+	rules := new(Redirects)
+	if err := rules.GetRedirectRules(); err != nil {
+		return nil
+	}
+	redirectRules.rules = *rules
+	redirectRules.loaded = true
+	return redirectRules.rules
+}
+
+func resetRedirectRules() {
+	redirectRules.Lock()
+	redirectRules.loaded = false
+	redirectRules.Unlock()
+}
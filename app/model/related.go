@@ -0,0 +1,245 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetPrevPost = `SELECT * FROM posts WHERE published AND NOT page %s AND (published_at < ? OR (published_at = ? AND id < ?)) ORDER BY published_at DESC, id DESC LIMIT 1`
+const stmtGetNextPost = `SELECT * FROM posts WHERE published AND NOT page %s AND (published_at > ? OR (published_at = ? AND id > ?)) ORDER BY published_at, id LIMIT 1`
+const stmtPostInTag = `AND id IN (SELECT post_id FROM posts_tags WHERE tag_id = ?)`
+const stmtGetAllPostTags = `SELECT post_id, tag_id FROM posts_tags`
+
+// How much the shared tags and the similarity of the text count in the score
+// of related posts.
+const (
+	relatedTagWeight  = 0.6
+	relatedTextWeight = 0.4
+)
+
+// relatedStopWords are too common to tell posts apart.
+var relatedStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true,
+	"you": true, "all": true, "can": true, "was": true, "this": true, "that": true,
+	"with": true, "from": true, "have": true, "they": true, "will": true, "your": true,
+	"what": true, "when": true, "which": true, "there": true, "their": true, "about": true,
+	"into": true, "than": true, "then": true, "them": true, "these": true, "some": true,
+	"的": true, "了": true, "是": true, "在": true, "和": true,
+}
+
+// related caches the index used to find related posts and the posts found,
+// until a post is saved.
+var related struct {
+	sync.Mutex
+	index   *relatedIndex
+	results map[int64][]*Post
+}
+
+type relatedIndex struct {
+	posts   []*Post
+	tags    map[int64]map[int64]bool
+	vectors map[int64]map[string]float64
+}
+
+// PrevPost returns the published post before the given one, or nil if there
+// is none. If a tag ID is given, only the posts with that tag are considered.
+func (p *Post) PrevPost(tagId ...int64) *Post {
+	return p.adjacentPost(stmtGetPrevPost, tagId)
+}
+
+// NextPost returns the published post after the given one, or nil if there is
+// none. If a tag ID is given, only the posts with that tag are considered.
+func (p *Post) NextPost(tagId ...int64) *Post {
+	return p.adjacentPost(stmtGetNextPost, tagId)
+}
+
+func (p *Post) adjacentPost(stmt string, tagId []int64) *Post {
+	if p.PublishedAt == nil {
+		return nil
+	}
+	where := ""
+	args := make([]interface{}, 0, 4)
+	if len(tagId) > 0 {
+		where = stmtPostInTag
+		args = append(args, tagId[0])
+	}
+	args = append(args, p.PublishedAt, p.PublishedAt, p.Id)
+	post := new(Post)
+	if err := meddler.QueryRow(db, post, fmt.Sprintf(stmt, where), args...); err != nil {
+		return nil
+	}
+	return post
+}
+
+// RelatedPosts returns at most size published posts related to the given one,
+// most related first. Posts are scored by the tags they share with it, and by
+// the similarity of their titles and text.
+func (p *Post) RelatedPosts(size int) []*Post {
+	related.Lock()
+	defer related.Unlock()
+	if related.index == nil {
+		index, err := newRelatedIndex()
+		if err != nil {
+			return nil
+		}
+		related.index = index
+		related.results = make(map[int64][]*Post)
+	}
+	posts, ok := related.results[p.Id]
+	if !ok {
+		posts = related.index.find(p)
+		related.results[p.Id] = posts
+	}
+	if len(posts) > size {
+		posts = posts[:size]
+	}
+	return posts
+}
+
+func init() {
+	Subscribe(func(Event) { resetRelatedPosts() }, EventNamePostSaved, EventNamePostDeleted)
+}
+
+// resetRelatedPosts drops the cached related posts, as a post changed.
+func resetRelatedPosts() {
+	related.Lock()
+	related.index = nil
+	related.results = nil
+	related.Unlock()
+}
+
+func newRelatedIndex() (*relatedIndex, error) {
+	posts := new(Posts)
+	if err := posts.GetAllPostList(false, true, "published_at DESC"); err != nil {
+		return nil, err
+	}
+	index := &relatedIndex{
+		posts:   *posts,
+		tags:    make(map[int64]map[int64]bool),
+		vectors: make(map[int64]map[string]float64),
+	}
+	rows, err := db.Query(stmtGetAllPostTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postId, tagId int64
+		if err := rows.Scan(&postId, &tagId); err != nil {
+			return nil, err
+		}
+		if index.tags[postId] == nil {
+			index.tags[postId] = make(map[int64]bool)
+		}
+		index.tags[postId][tagId] = true
+	}
+
+	// Weigh the terms by TF-IDF, so words found in every post don't count.
+	df := make(map[string]int)
+	for _, post := range index.posts {
+		terms := relatedTerms(post)
+		index.vectors[post.Id] = terms
+		for t := range terms {
+			df[t]++
+		}
+	}
+	n := float64(len(index.posts))
+	for _, vector := range index.vectors {
+		var norm float64
+		for t, tf := range vector {
+			w := tf * math.Log(n/float64(df[t]))
+			vector[t] = w
+			norm += w * w
+		}
+		norm = math.Sqrt(norm)
+		for t := range vector {
+			if norm > 0 {
+				vector[t] /= norm
+			}
+		}
+	}
+	return index, rows.Err()
+}
+
+func (index *relatedIndex) find(p *Post) []*Post {
+	type scored struct {
+		post  *Post
+		score float64
+	}
+	tags := index.tags[p.Id]
+	vector := index.vectors[p.Id]
+	results := make([]scored, 0)
+	for _, other := range index.posts {
+		if other.Id == p.Id {
+			continue
+		}
+		var score float64
+		if otherTags := index.tags[other.Id]; len(tags) > 0 && len(otherTags) > 0 {
+			shared := 0
+			for t := range otherTags {
+				if tags[t] {
+					shared++
+				}
+			}
+			score += relatedTagWeight * float64(shared) / float64(len(tags)+len(otherTags)-shared)
+		}
+		var cosine float64
+		for t, w := range index.vectors[other.Id] {
+			cosine += w * vector[t]
+		}
+		score += relatedTextWeight * cosine
+		if score > 0 {
+			results = append(results, scored{other, score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	posts := make([]*Post, len(results))
+	for i, r := range results {
+		posts[i] = r.post
+	}
+	return posts
+}
+
+// relatedTerms counts the words of the title and text of a post, counting
+// the title three times. Han text has no spaces, so it is split into pairs
+// of characters instead of words.
+func relatedTerms(p *Post) map[string]float64 {
+	terms := make(map[string]float64)
+	add := func(s string, weight float64) {
+		var word []rune
+		var prev rune
+		flush := func() {
+			if w := string(word); len(word) > 2 && !relatedStopWords[w] {
+				terms[w] += weight
+			}
+			word = word[:0]
+		}
+		for _, r := range strings.ToLower(s) {
+			if unicode.Is(unicode.Han, r) {
+				flush()
+				if prev != 0 && !relatedStopWords[string(prev)] && !relatedStopWords[string(r)] {
+					terms[string([]rune{prev, r})] += weight
+				}
+				prev = r
+				continue
+			}
+			prev = 0
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				word = append(word, r)
+			} else {
+				flush()
+			}
+		}
+		flush()
+	}
+	add(p.Title, 3)
+	add(utils.Html2Str(p.Html), 1)
+	return terms
+}
@@ -7,6 +7,9 @@ CREATE TABLE IF NOT EXISTS posts (
   slug				varchar(150) NOT NULL,
   markdown          text,
   html              text,
+  toc               text,
+  word_count        INT NOT NULL DEFAULT '0',
+  reading_time      INT NOT NULL DEFAULT '0',
   image             text,
   featured			BOOLEAN,
   page				BOOLEAN,
@@ -117,4 +120,146 @@ CREATE TABLE IF NOT EXISTS messages (
 );
 `
 
-var TableSchemas = [...]string{posts, tokens, users, tags, posts_tags, posts_categories, settings, roles, messages}
+const comments = `
+CREATE TABLE IF NOT EXISTS comments (
+  id             INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  post_id        INT NOT NULL,
+  author         varchar(150) NOT NULL,
+  author_email   varchar(254) NOT NULL,
+  author_avatar  text,
+  author_url     varchar(200) NOT NULL DEFAULT '',
+  author_ip      varchar(100) NOT NULL DEFAULT '',
+  created_at     datetime NOT NULL,
+  content        text NOT NULL,
+  approved       boolean NOT NULL DEFAULT 0,
+  agent          varchar(255) NOT NULL DEFAULT '',
+  type           varchar(20) NOT NULL DEFAULT '',
+  parent         INT NOT NULL DEFAULT '0',
+  user_id        INT NOT NULL DEFAULT '0'
+);
+`
+const media = `
+CREATE TABLE IF NOT EXISTS media (
+  id            INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  name          varchar(255) NOT NULL,
+  path          varchar(255) NOT NULL,
+  mime_type     varchar(100) NOT NULL,
+  size          BIGINT NOT NULL DEFAULT '0',
+  width         INT NOT NULL DEFAULT '0',
+  height        INT NOT NULL DEFAULT '0',
+  alt           varchar(255) NOT NULL DEFAULT '',
+  checksum      char(64) NOT NULL UNIQUE,
+  created_at    datetime NOT NULL,
+  created_by    INT NOT NULL,
+  updated_at    datetime,
+  updated_by    INT
+);
+`
+const media_variants = `
+CREATE TABLE IF NOT EXISTS media_variants (
+  id        INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  media_id  INT NOT NULL,
+  name      varchar(20) NOT NULL,
+  path      varchar(255) NOT NULL,
+  width     INT NOT NULL,
+  height    INT NOT NULL
+);
+`
+const posts_media = `
+CREATE TABLE IF NOT EXISTS posts_media (
+  id        INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  post_id   INT NOT NULL,
+  media_id  INT NOT NULL
+);
+`
+
+const slug_redirects = `
+CREATE TABLE IF NOT EXISTS slug_redirects (
+  id          INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  source      varchar(255) NOT NULL,
+  target      varchar(255) NOT NULL DEFAULT '',
+  post_id     INT NOT NULL DEFAULT '0',
+  prefix      tinyint NOT NULL DEFAULT '0',
+  created_at  datetime NOT NULL,
+  created_by  INT NOT NULL DEFAULT '0',
+  KEY source (source)
+);
+`
+
+const api_tokens = `
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id            INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id       INT NOT NULL,
+  name          varchar(150) NOT NULL,
+  prefix        varchar(20) NOT NULL,
+  hash          char(64) NOT NULL UNIQUE,
+  scopes        varchar(255) NOT NULL DEFAULT '',
+  expires_at    datetime,
+  last_used_at  datetime,
+  created_at    datetime NOT NULL,
+  KEY user_id (user_id)
+);
+`
+
+const webhooks = `
+CREATE TABLE IF NOT EXISTS webhooks (
+  id          INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  url         varchar(255) NOT NULL,
+  events      varchar(255) NOT NULL DEFAULT '',
+  secret      varchar(100) NOT NULL,
+  active      tinyint NOT NULL DEFAULT '1',
+  created_at  datetime NOT NULL,
+  created_by  INT NOT NULL DEFAULT '0'
+);
+`
+
+const webhook_deliveries = `
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  webhook_id       INT NOT NULL,
+  event            varchar(50) NOT NULL,
+  payload          mediumtext NOT NULL,
+  status           varchar(20) NOT NULL DEFAULT 'pending',
+  attempts         INT NOT NULL DEFAULT '0',
+  next_attempt_at  datetime,
+  response_code    INT NOT NULL DEFAULT '0',
+  response_body    text NOT NULL,
+  error            text NOT NULL,
+  created_at       datetime NOT NULL,
+  delivered_at     datetime,
+  KEY status (status, next_attempt_at),
+  KEY webhook_id (webhook_id)
+);
+`
+
+const jobs = `
+CREATE TABLE IF NOT EXISTS jobs (
+  id                INT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  type              varchar(50) NOT NULL,
+  payload           mediumtext NOT NULL,
+  status            varchar(20) NOT NULL DEFAULT 'queued',
+  attempts          INT NOT NULL DEFAULT '0',
+  max_attempts      INT NOT NULL DEFAULT '3',
+  run_at            datetime NOT NULL,
+  interval_seconds  INT NOT NULL DEFAULT '0',
+  unique_key        varchar(100) NOT NULL DEFAULT '',
+  result            mediumtext NOT NULL,
+  error             text NOT NULL,
+  created_at        datetime NOT NULL,
+  started_at        datetime,
+  finished_at       datetime,
+  KEY status (status, run_at),
+  KEY unique_key (unique_key)
+);
+`
+
+var TableSchemas = [...]string{posts, tokens, users, tags, posts_tags, posts_categories, settings, roles, messages, comments, media, media_variants, posts_media, slug_redirects, api_tokens, webhooks, webhook_deliveries, jobs}
+
+// TableColumns are the columns added to the tables after they were first
+// released. CREATE TABLE IF NOT EXISTS doesn't add them to existing DBs, so
+// they are added by addMissingColumns.
+var TableColumns = []struct{ Table, Column, Definition string }{
+	{"posts", "toc", "text AFTER html"},
+	{"posts", "word_count", "INT NOT NULL DEFAULT '0' AFTER toc"},
+	{"posts", "reading_time", "INT NOT NULL DEFAULT '0' AFTER word_count"},
+}
@@ -2,6 +2,9 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/luohao-brian/SimplePosts/app/utils"
@@ -11,6 +14,7 @@ import (
 const stmtGetSetting = `SELECT * FROM settings WHERE ke = ?`
 const stmtSaveSelect = `SELECT id FROM settings WHERE KE = ?`
 const stmtGetSettingsByType = `SELECT * FROM settings WHERE type = ?`
+const stmtDeleteSetting = `DELETE FROM settings WHERE ke = ?`
 
 // A Setting is the data type that stores the blog's configuration options. It
 // is essentially a key-value store for settings, along with a type to help
@@ -103,6 +107,21 @@ func GetSettingValue(k string) string {
 	return setting.Value
 }
 
+// SiteUrl returns the absolute URL of the given path on the site, based on the
+// "site_url" setting.
+func SiteUrl(p string) string {
+	return strings.TrimRight(GetSettingValue("site_url"), "/") + "/" + strings.TrimLeft(p, "/")
+}
+
+// AbsoluteUrl makes a site relative URL absolute, leaving any other URL, such
+// as an image on another host, as is.
+func AbsoluteUrl(u string) string {
+	if strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") {
+		return SiteUrl(u)
+	}
+	return u
+}
+
 // GetCustomSettings returns all custom settings.
 func GetCustomSettings() *Settings {
 	return GetSettingsByType("custom")
@@ -122,7 +141,7 @@ func GetSettingsByType(t string) *Settings {
 	return settings
 }
 
-// Save saves the setting to the DB.
+// Save saves the setting to the DB, and emits SettingChanged.
 func (setting *Setting) Save() error {
 	var id int
 	row := db.QueryRow(stmtSaveSelect, setting.Ke)
@@ -131,8 +150,12 @@ func (setting *Setting) Save() error {
 	} else {
 		setting.Id = id
 	}
-	err := meddler.Save(db, "settings", setting)
-	return err
+	if err := meddler.Save(db, "settings", setting); err != nil {
+		return err
+	}
+	s := *setting
+	Emit(SettingChanged{Setting: &s})
+	return nil
 }
 
 // NewSetting returns a new setting from the given key-value pair.
@@ -155,3 +178,48 @@ func SetSettingIfNotExists(k, v, t string) error {
 	}
 	return err
 }
+
+// ErrSettingNotDeletable is returned by DeleteSetting for the settings with
+// their own rules, such as the permalink and the markdown pipeline, which
+// can only be changed.
+var ErrSettingNotDeletable = errors.New("The setting can not be deleted, only changed.")
+
+// DeleteSetting deletes the setting with the given key, and emits
+// SettingChanged with the deleted setting.
+func DeleteSetting(k string) error {
+	switch k {
+	case "permalink", "permalink_history",
+		settingMarkdownExtensions, settingMarkdownSanitizer, settingMarkdownPostProcessors, settingHighlightStyle:
+		return ErrSettingNotDeletable
+	}
+	s := &Setting{Ke: k}
+	s.GetSetting()
+	if _, err := db.Exec(stmtDeleteSetting, k); err != nil {
+		return err
+	}
+	Emit(SettingChanged{Setting: s})
+	return nil
+}
+
+// SetSettingValue changes the value of the setting with the given key, or
+// adds it with the given type. The settings with their own rules, such as the
+// permalink and the markdown pipeline, are checked by them.
+func SetSettingValue(k, v, t string, by int64) error {
+	switch k {
+	case "permalink":
+		return SetPermalink(Permalink(v))
+	case "permalink_history":
+		return fmt.Errorf("The permalink history can not be changed.")
+	case settingMarkdownExtensions, settingMarkdownSanitizer, settingMarkdownPostProcessors, settingHighlightStyle:
+		return setMarkdownSetting(k, v)
+	}
+	s := &Setting{Ke: k}
+	if s.GetSetting() != nil {
+		s = NewSetting(k, v, t)
+		s.CreatedBy = by
+	}
+	s.Value = v
+	s.UpdatedAt = utils.Now()
+	s.UpdatedBy = by
+	return s.Save()
+}
@@ -1,24 +1,71 @@
 package model
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/luohao-brian/SimplePosts/app/translit"
 )
 
+// reservedSlugs are used by the routes of the blog, so posts can't have them.
+var reservedSlugs = map[string]bool{
+	"rss": true, "feed": true, "tag": true, "tags": true, "author": true,
+	"page": true, "admin": true, "api": true, "login": true, "logout": true,
+	"signup": true, "upload": true, "sitemaps": true, "archive": true,
+}
+
+// rxYearSlug matches the slugs taken by the year archives.
+var rxYearSlug = regexp.MustCompile(`^[0-9]{4}$`)
+
+// isReservedSegment returns whether a path starting with the segment is
+// routed to the blog rather than to a post, such as "/feed/" or a year
+// archive.
+func isReservedSegment(seg string) bool {
+	seg = strings.ToLower(seg)
+	return reservedSlugs[seg] || rxYearSlug.MatchString(seg)
+}
+
+// ValidatePostSlug returns an error if the slug, given to a post, would be
+// shadowed by a route of the blog, such as "/feed/" or a year archive.
+func ValidatePostSlug(slug string) error {
+	if isReservedSegment(strings.SplitN(strings.Trim(slug, "/"), "/", 2)[0]) {
+		return fmt.Errorf("The slug %q is used by the blog, please choose another one.", slug)
+	}
+	return nil
+}
+
+// SetSlugTransliteration changes the transliterator used to generate slugs.
+func SetSlugTransliteration(name string) error {
+	if translit.Get(name) == nil {
+		return fmt.Errorf("Unknown transliteration %q.", name)
+	}
+	return NewSetting("slug_transliteration", name, "blog").Save()
+}
+
 // GenerateSlug generates a URL-friendly slug. The table is one of "posts",
 // "tags", "navigation", or "users".
 func GenerateSlug(input string, table string) string {
+	return GenerateSlugFor(input, table, 0)
+}
+
+// GenerateSlugFor generates a URL-friendly slug like GenerateSlug, but lets
+// the row with the given ID, usually the one being edited, keep its slug.
+func GenerateSlugFor(input string, table string, id int64) string {
 	output := strings.Map(func(r rune) rune {
 		switch {
-		case r == ' ', r == '-':
+		case unicode.IsSpace(r), r == '-':
 			return '-'
 		case r == '_', unicode.IsLetter(r), unicode.IsDigit(r):
 			return r
 		default:
 			return -1
 		}
-	}, strings.ToLower(strings.TrimSpace(input)))
+	}, strings.ToLower(strings.TrimSpace(transliterate(input))))
+	// Collapse the dashes left by transliteration and removed characters
+	output = strings.Join(strings.FieldsFunc(output, func(r rune) bool { return r == '-' }), "-")
 	// Maximum of 75 characters for slugs right now
 	maxLength := 75
 	if len([]rune(output)) > maxLength {
@@ -30,36 +77,53 @@ func GenerateSlug(input string, table string) string {
 				break
 			}
 		}
-		output = string(runes)
+		output = strings.TrimRight(string(runes), "-")
 	}
-	// Don't allow a few specific slugs that are used by the blog
-	if table == "posts" && (output == "rss" || output == "tag" || output == "author" || output == "page" || output == "admin") {
-		output = generateUniqueSlug(output, table, 2)
-	} else if table == "tags" || table == "navigation" { // We want duplicate tag and navigation slugs
+	if table == "tags" || table == "navigation" { // We want duplicate tag and navigation slugs
 		return output
 	}
-	return generateUniqueSlug(output, table, 1)
+	if output == "" {
+		output = strings.TrimSuffix(table, "s")
+	}
+	// Don't allow a few specific slugs that are used by the blog
+	if table == "posts" && isReservedSegment(output) {
+		return generateUniqueSlug(output, table, id, 2)
+	}
+	return generateUniqueSlug(output, table, id, 1)
+}
+
+// transliterate rewrites the input with the transliterator chosen by the
+// "slug_transliteration" setting.
+func transliterate(input string) string {
+	if t := translit.Get(GetSettingValue("slug_transliteration")); t != nil {
+		return t(input)
+	}
+	return input
 }
 
-func generateUniqueSlug(slug string, table string, suffix int) string {
+func generateUniqueSlug(slug string, table string, id int64, suffix int) string {
 	// Recursive function
 	slugToCheck := slug
 	if suffix > 1 { // If this is not the first try, add the suffix and try again
 		slugToCheck = slug + "-" + strconv.Itoa(suffix)
 	}
 	var err error
+	var owner int64
 	if table == "tags" { // Not needed at the moment. Tags with the same name should have the same slug.
 		tag := &Tag{Slug: slugToCheck}
 		err = tag.GetTagBySlug()
+		owner = tag.Id
 	} else if table == "posts" {
 		post := new(Post)
 		err = post.GetPostBySlug(slugToCheck)
+		owner = post.Id
 	} else if table == "users" {
-		u := new(User)
+		u := &User{Slug: slugToCheck}
 		err = u.GetUserBySlug()
+		owner = u.Id
 	}
-	if err == nil {
-		return generateUniqueSlug(slug, table, suffix+1)
+	if err == nil && (id == 0 || owner != id) {
+		return generateUniqueSlug(slug, table, id, suffix+1)
 	}
 	return slugToCheck
 }
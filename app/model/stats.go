@@ -20,12 +20,13 @@ func NewStatis(app *golf.Application) *Statis {
 	s := new(Statis)
 	postNum, _ := GetNumberOfPosts(false, false)
 	pageNum, _ := GetNumberOfPosts(true, false)
+	fileNum, _ := GetNumberOfMedia()
 
 	s.Posts = postNum
 	s.Pages = pageNum
+	s.Files = int(fileNum)
 	s.Sessions = app.SessionManager.Count()
 	// s.Pages = len(contentsIndex["page"])
-	// s.Files = len(files)
 	// s.Version = GetVersion().Version
 	// s.Readers = len(GetReaders())
 	return s
@@ -54,7 +54,9 @@ func NewTag(name, slug string) *Tag {
 	}
 }
 
-// Save saves a Tag to the DB.
+// Save saves a Tag to the DB, unless a tag with the same slug already exists,
+// whose ID is taken. Whether the tag is hidden is decided by its posts, see
+// updateTagsOfPost.
 func (t *Tag) Save() error {
 	oldTag := &Tag{Slug: t.Slug}
 	err := oldTag.GetTagBySlug()
@@ -67,25 +69,6 @@ func (t *Tag) Save() error {
 		return err
 	} else {
 		t.Id = oldTag.Id
-		// If oldTag.Hidden != t.Hidden, we need to decide whether change the hidden status of oldTag
-		if oldTag.Hidden != t.Hidden {
-			if oldTag.Hidden {
-				return t.Update()
-			} else {
-				// oldTag.Hidden is false and t.Hidden is true
-				var posts Posts
-				err := posts.GetAllPostsByTag(oldTag.Id)
-				if err != nil {
-					return err
-				}
-				for _, p := range posts {
-					if p.IsPublished {
-						return nil
-					}
-				}
-				return t.Update()
-			}
-		}
 	}
 	return nil
 }
@@ -115,7 +98,7 @@ func (t *Tag) Insert() error {
 
 // Update updates an existing tag in the DB.
 func (t *Tag) Update() error {
-	err := meddler.Insert(db, "tags", t)
+	err := meddler.Update(db, "tags", t)
 	return err
 }
 
@@ -143,23 +126,99 @@ func (tags *Tags) GetAllTags() error {
 	return err
 }
 
-//DeleteOldTags removes any unused tags from the DB.
-func DeleteOldTags() error {
-	WriteDB, err := db.Begin()
+// GetTagsLastModified returns, for every tag of a published post, the last
+// time one of its published posts was updated.
+func GetTagsLastModified() (map[int64]time.Time, error) {
+	rows, err := db.Query(stmtGetTagsLastModified)
 	if err != nil {
-		WriteDB.Rollback()
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			id      int64
+			updated *time.Time
+		)
+		if err = rows.Scan(&id, &updated); err != nil {
+			return nil, err
+		}
+		if updated != nil {
+			result[id] = *updated
+		}
+	}
+	return result, rows.Err()
+}
+
+func init() {
+	Subscribe(updateTagsOfPost, EventNamePostSaved, EventNamePostDeleted)
+}
+
+// updateTagsOfPost updates the tags a post has or had once it is saved or
+// deleted: a tag is hidden unless one of its posts is published, and the tags
+// the post left without any post are deleted.
+func updateTagsOfPost(e Event) {
+	var post *Post
+	var ids []int64
+	switch e := e.(type) {
+	case PostSaved:
+		post, ids = e.Post, e.OldTagIds
+	case PostDeleted:
+		post, ids = e.Post, e.OldTagIds
+	}
+	current := make(map[int64]bool)
+	for _, id := range post.tagIds() {
+		current[id] = true
+		ids = append(ids, id)
 	}
-	_, err = WriteDB.Exec(stmtDeleteOldTags)
+	seen := make(map[int64]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var posts, published int64
+		if err := db.QueryRow(stmtGetAllPostsCountByTag, id).Scan(&posts); err != nil {
+			log.Printf("[Error]: can not count the posts of tag %d: %v", id, err)
+			continue
+		}
+		if posts == 0 && !current[id] {
+			if err := DeleteTag(id); err != nil {
+				log.Printf("[Error]: can not delete the unused tag %d: %v", id, err)
+			}
+			continue
+		}
+		if err := db.QueryRow(stmtGetPostsCountByTag, id).Scan(&published); err != nil {
+			log.Printf("[Error]: can not count the posts of tag %d: %v", id, err)
+			continue
+		}
+		if _, err := db.Exec(stmtUpdateTagHidden, published == 0, id); err != nil {
+			log.Printf("[Error]: can not update tag %d: %v", id, err)
+		}
+	}
+}
+
+// DeleteTag deletes the tag with the given ID, removing it from its posts.
+func DeleteTag(id int64) error {
+	writeDB, err := db.Begin()
 	if err != nil {
-		WriteDB.Rollback()
 		return err
 	}
-	return WriteDB.Commit()
+	for _, stmt := range []string{stmtDeletePostTagsByTagId, stmtDeleteTagById} {
+		if _, err = writeDB.Exec(stmt, id); err != nil {
+			writeDB.Rollback()
+			return err
+		}
+	}
+	return writeDB.Commit()
 }
 
 const stmtGetTagsByPostId = `SELECT * FROM tags WHERE id IN (SELECT tag_id FROM posts_tags WHERE post_id = ?)`
 const stmtGetTag = `SELECT * FROM tags WHERE id = ?`
 const stmtGetTagBySlug = `SELECT * FROM tags WHERE slug = ?`
 const stmtGetAllTags = `SELECT * FROM tags`
-const stmtDeleteOldTags = `DELETE FROM tags WHERE id IN (SELECT id FROM tags EXCEPT SELECT tag_id FROM posts_tags)`
+const stmtGetTagsLastModified = `SELECT posts_tags.tag_id, MAX(posts.updated_at) FROM posts_tags, posts WHERE posts_tags.post_id = posts.id AND posts.published GROUP BY posts_tags.tag_id`
+const stmtGetAllPostsCountByTag = `SELECT count(*) FROM posts_tags WHERE tag_id = ?`
+const stmtUpdateTagHidden = `UPDATE tags SET hidden = ? WHERE id = ?`
+const stmtDeleteTagById = `DELETE FROM tags WHERE id = ?`
+const stmtDeletePostTagsByTagId = `DELETE FROM posts_tags WHERE tag_id = ?`
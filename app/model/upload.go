@@ -0,0 +1,189 @@
+package model
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// An UploadScanner inspects an uploaded file before it is accepted. The file
+// is still in a temporary location, at the given path. Returning an error
+// rejects the upload.
+type UploadScanner func(path string, m *Media) error
+
+var uploadScanners = []UploadScanner{scanImageDecodes}
+
+// RegisterUploadScanner adds a scanner that is run against every upload, for
+// example to hook up an external virus scanner.
+func RegisterUploadScanner(s UploadScanner) {
+	uploadScanners = append(uploadScanners, s)
+}
+
+// uploadTypes maps the content types that may be uploaded to the extensions
+// that are accepted for them. The first extension is the canonical one.
+var uploadTypes = map[string][]string{
+	"image/jpeg":                {".jpg", ".jpeg"},
+	"image/png":                 {".png"},
+	"image/gif":                 {".gif"},
+	"image/webp":                {".webp"},
+	"application/pdf":           {".pdf"},
+	"application/zip":           {".zip", ".docx", ".xlsx", ".pptx"},
+	"application/x-ole-storage": {".doc", ".xls", ".ppt"},
+	"text/plain; charset=utf-8": {".txt"},
+}
+
+// SaveUpload streams an uploaded file into a collision-free, date-partitioned
+// path below uploadDir, and records it in the media library. The content type
+// is sniffed from the data, and must agree with the extension of the original
+// file name, which in turn must be one of allowedExts. Files larger than
+// maxSize are rejected without being stored. If the same file has been
+// uploaded before, the existing Media is returned instead. The resized
+// variants of images are generated afterwards, by a "media.variants" job.
+func SaveUpload(uploadDir, name string, r io.Reader, maxSize int64, allowedExts []string, by int64) (*Media, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	m := NewMedia(path.Base(name))
+	m.MimeType = utils.SniffContentType(head)
+	ext, err := uploadExt(m.Name, m.MimeType, allowedExts)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir := uploadTmpDir(uploadDir)
+	os.MkdirAll(tmpDir, os.ModePerm)
+	tmp, err := ioutil.TempFile(tmpDir, "upload-")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	hash := sha256.New()
+	src := io.LimitReader(io.MultiReader(bytes.NewReader(head), r), maxSize+1)
+	m.Size, err = io.Copy(io.MultiWriter(tmp, hash), src)
+	tmp.Close()
+	if err == nil && m.Size > maxSize {
+		err = fmt.Errorf("File size should be smaller than %s.", utils.FileSize(maxSize))
+	}
+	if err == nil {
+		m.Checksum = fmt.Sprintf("%x", hash.Sum(nil))
+		for _, scan := range uploadScanners {
+			if err = scan(tmpPath, m); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	existing := &Media{Checksum: m.Checksum}
+	if err := existing.GetMediaByChecksum(); err == nil {
+		os.Remove(tmpPath)
+		return existing, nil
+	}
+
+	dir := path.Join(uploadDir, m.CreatedAt.Format("2006"), m.CreatedAt.Format("01"))
+	m.Path = CreateFilePath(dir, randomName()+ext)
+	if err = os.Rename(tmpPath, m.Path); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if m.IsImage() {
+		if f, err := os.Open(m.Path); err == nil {
+			if cfg, _, err := image.DecodeConfig(f); err == nil {
+				m.Width = cfg.Width
+				m.Height = cfg.Height
+			}
+			f.Close()
+		}
+	}
+	m.CreatedBy = by
+	m.UpdatedBy = by
+	if err = m.Save(); err != nil {
+		os.Remove(m.Path)
+		return nil, err
+	}
+	if m.IsImage() {
+		_, err = EnqueueJob("media.variants", MediaJob{MediaId: m.Id})
+	}
+	return m, err
+}
+
+// uploadTmpDir returns the directory the uploads are kept in until they are
+// scanned. It is next to uploadDir rather than in it, so that the files can't
+// be downloaded before they are accepted, and on the same file system, so
+// that they can be moved into uploadDir.
+func uploadTmpDir(uploadDir string) string {
+	dir, name := path.Split(path.Clean(uploadDir))
+	return path.Join(dir, "."+name+".tmp")
+}
+
+// MediaJob is the payload of the jobs about a media file.
+type MediaJob struct {
+	MediaId int64 `json:"media_id"`
+}
+
+// uploadExt returns the extension the upload is stored with, or an error if
+// the sniffed content type is not allowed or does not match the extension of
+// the original file name.
+func uploadExt(name, contentType string, allowedExts []string) (string, error) {
+	exts, ok := uploadTypes[contentType]
+	if !ok {
+		return "", fmt.Errorf("File type %s is not allowed.", contentType)
+	}
+	ext := strings.ToLower(path.Ext(name))
+	matches := false
+	for _, e := range exts {
+		if e == ext {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		return "", fmt.Errorf("File content does not match its extension %q.", ext)
+	}
+	for _, e := range allowedExts {
+		if strings.ToLower(strings.TrimSpace(e)) == ext {
+			return ext, nil
+		}
+	}
+	return "", fmt.Errorf("Only supports documents, images and zip files.")
+}
+
+// randomName returns a random, URL-safe file name.
+func randomName() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// scanImageDecodes rejects images that can't be decoded, which catches files
+// that only pretend to be images by starting with a valid magic number.
+func scanImageDecodes(p string, m *Media) error {
+	if !m.IsImage() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, err := image.Decode(f); err != nil {
+		return fmt.Errorf("Image can not be decoded: %v", err)
+	}
+	return nil
+}
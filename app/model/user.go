@@ -1,6 +1,7 @@
 package model
 
 import (
+	"log"
 	"time"
 
 	"github.com/luohao-brian/SimplePosts/app/utils"
@@ -9,19 +10,21 @@ import (
 )
 
 const stmtGetUserById = `SELECT * FROM users WHERE id = ?`
+const stmtUpdateLastLogin = `UPDATE users SET last_login = ? WHERE id = ?`
 const stmtGetUserBySlug = `SELECT * FROM users WHERE slug = ?`
 const stmtGetUserByName = `SELECT * FROM users WHERE name = ?`
 const stmtGetUserByEmail = `SELECT * FROM users WHERE email = ?`
 const stmtInsertRoleUser = `INSERT INTO roles_users (id, role_id, user_id) VALUES (?, ?, ?)`
 const stmtGetUsersCountByEmail = `SELECT count(*) FROM users where email = ?`
 const stmtGetNumberOfUsers = `SELECT COUNT(*) FROM users`
+const stmtDeleteUserById = `DELETE FROM users WHERE id = ?`
 
 // A User is a user on the site.
 type User struct {
 	Id             int64      `meddler:"id,pk"`
 	Name           string     `meddler:"name"`
 	Slug           string     `meddler:"slug"`
-	HashedPassword string     `meddler:"password"`
+	HashedPassword string     `meddler:"password" json:"-"`
 	Email          string     `meddler:"email"`
 	Image          string     `meddler:"image"`    // NULL
 	Cover          string     `meddler:"cover"`    // NULL
@@ -39,6 +42,18 @@ type User struct {
 	Role           int        `meddler:"-"` //1 = Administrator, 2 = Editor, 3 = Author, 4 = Owner
 }
 
+func init() {
+	Subscribe(recordLogin, EventNameUserLoggedIn)
+}
+
+// recordLogin records the time the user signed in.
+func recordLogin(e Event) {
+	u := e.(UserLoggedIn).User
+	if _, err := db.Exec(stmtUpdateLastLogin, utils.Now(), u.Id); err != nil {
+		log.Printf("[Error]: can not record the login of user %d: %v", u.Id, err)
+	}
+}
+
 var ghostUser = &User{Id: 0, Name: "Dingo User", Email: "example@example.com"}
 
 // NewUser creates a new user from the given email and name, with the CreatedAt
@@ -118,12 +133,20 @@ func (u *User) CheckPassword(password string) bool {
 	return true
 }
 
-// Avatar returns the Gravatar of the given user, with the Gravatar being
-// 150px by 150px.
+// Avatar returns the uploaded avatar of the given user, or their Gravatar,
+// with the Gravatar being 150px by 150px.
 func (u *User) Avatar() string {
+	if u.Image != "" {
+		return u.Image
+	}
 	return utils.Gravatar(u.Email, "150")
 }
 
+// Url returns the URL of the author page of the given user.
+func (u *User) Url() string {
+	return "/author/" + u.Slug
+}
+
 // GetUserById finds the user by ID in the DB.
 func (u *User) GetUserById() error {
 	err := meddler.QueryRow(db, u, stmtGetUserById, u.Id)
@@ -148,10 +171,18 @@ func (u *User) GetUserByEmail() error {
 	return err
 }
 
-// Insert inserts the user into the DB.
+// Insert inserts the user into the DB, and emits UserCreated.
 func (u *User) Insert() error {
+	if u.Slug == "" {
+		u.Slug = GenerateSlug(u.Name, "users")
+	}
 	err := meddler.Insert(db, "users", u)
-	return err
+	if err != nil {
+		return err
+	}
+	user := *u
+	Emit(UserCreated{User: &user})
+	return nil
 }
 
 // InsertRoleUser assigns a role to the given user based on the given Role ID.
@@ -187,3 +218,21 @@ func GetNumberOfUsers() (int64, error) {
 	err := row.Scan(&count)
 	return count, err
 }
+
+// Users is a slice of "User"s.
+type Users []*User
+
+// GetAllUsers gets all the users in the DB.
+func (users *Users) GetAllUsers() error {
+	return meddler.QueryAll(db, users, stmtGetAllUsers)
+}
+
+// DeleteUser deletes the user with the given ID, and revokes their personal
+// API tokens. Their posts are kept.
+func DeleteUser(id int64) error {
+	if _, err := db.Exec(stmtDeleteAPITokensByUserId, id); err != nil {
+		return err
+	}
+	_, err := db.Exec(stmtDeleteUserById, id)
+	return err
+}
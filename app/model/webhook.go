@@ -0,0 +1,467 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/utils"
+	"github.com/russross/meddler"
+)
+
+const stmtGetAllWebhooks = `SELECT * FROM webhooks ORDER BY created_at`
+const stmtGetActiveWebhooks = `SELECT * FROM webhooks WHERE active`
+const stmtGetWebhookById = `SELECT * FROM webhooks WHERE id = ?`
+const stmtDeleteWebhookById = `DELETE FROM webhooks WHERE id = ?`
+const stmtGetWebhookDeliveryById = `SELECT * FROM webhook_deliveries WHERE id = ?`
+const stmtGetRecentWebhookDeliveries = `SELECT * FROM webhook_deliveries ORDER BY id DESC LIMIT ?`
+const stmtDeleteWebhookDeliveriesByWebhookId = `DELETE FROM webhook_deliveries WHERE webhook_id = ?`
+const stmtDeleteOldWebhookDeliveries = `DELETE FROM webhook_deliveries WHERE created_at < ? AND status != 'pending'`
+
+// The events webhooks can subscribe to.
+const (
+	EventPostCreated     = "post.created"
+	EventPostUpdated     = "post.updated"
+	EventPostPublished   = "post.published"
+	EventPostUnpublished = "post.unpublished"
+	EventPostDeleted     = "post.deleted"
+	EventCommentCreated  = "comment.created"
+	EventCommentApproved = "comment.approved"
+	EventUserCreated     = "user.created"
+)
+
+// WebhookEvents are the events a webhook can subscribe to.
+var WebhookEvents = []string{
+	EventPostCreated, EventPostUpdated, EventPostPublished, EventPostUnpublished, EventPostDeleted,
+	EventCommentCreated, EventCommentApproved, EventUserCreated,
+}
+
+// The statuses of the deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// webhookMaxAttempts is the number of times a delivery is sent before
+	// giving up on it. With webhookBackoff, the last attempt is made about an
+	// hour after the first one.
+	webhookMaxAttempts = 8
+	// webhookBackoff is the wait before the second attempt, doubled after
+	// every failed attempt.
+	webhookBackoff = 30 * time.Second
+	// webhookTimeout is how long the endpoints have to answer.
+	webhookTimeout = 10 * time.Second
+	// webhookLogDays is how long the finished deliveries are kept.
+	webhookLogDays = 30
+	// webhookResponseSize is the size of the responses kept in the log.
+	webhookResponseSize = 1024
+)
+
+// A Webhook is an endpoint the events of the blog are sent to, as JSON
+// POSTed with an HMAC signature made with its secret.
+type Webhook struct {
+	Id        int64      `meddler:"id,pk"`
+	Url       string     `meddler:"url"`
+	Events    string     `meddler:"events"` // Separated by commas
+	Secret    string     `meddler:"secret"`
+	Active    bool       `meddler:"active"`
+	CreatedAt *time.Time `meddler:"created_at"`
+	CreatedBy int64      `meddler:"created_by"`
+}
+
+// Webhooks is a slice of "Webhook"s.
+type Webhooks []*Webhook
+
+// A WebhookDelivery is an event queued for a webhook, and the log of its
+// attempts. Every delivery is sent by a "webhook.deliver" job, which retries
+// it until it succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	Id            int64      `meddler:"id,pk"`
+	WebhookId     int64      `meddler:"webhook_id"`
+	Event         string     `meddler:"event"`
+	Payload       string     `meddler:"payload"`
+	Status        string     `meddler:"status"`
+	Attempts      int        `meddler:"attempts"`
+	NextAttemptAt *time.Time `meddler:"next_attempt_at"`
+	ResponseCode  int        `meddler:"response_code"`
+	ResponseBody  string     `meddler:"response_body"`
+	Error         string     `meddler:"error"`
+	CreatedAt     *time.Time `meddler:"created_at"`
+	DeliveredAt   *time.Time `meddler:"delivered_at"`
+}
+
+// WebhookDeliveries is a slice of "WebhookDelivery"s.
+type WebhookDeliveries []*WebhookDelivery
+
+// webhookEventSeparator separates the events of a webhook in the DB.
+const webhookEventSeparator = ","
+
+// NewWebhook creates a new active webhook. If no secret is given, one is
+// generated when it is saved.
+func NewWebhook(rawurl string, events []string, secret string) *Webhook {
+	return &Webhook{
+		Url:       strings.TrimSpace(rawurl),
+		Events:    strings.Join(events, webhookEventSeparator),
+		Secret:    strings.TrimSpace(secret),
+		Active:    true,
+		CreatedAt: utils.Now(),
+	}
+}
+
+// Validate checks the URL and the events of the webhook.
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("The URL should be an http or https URL.")
+	}
+	if len(w.EventList()) == 0 {
+		return fmt.Errorf("The webhook needs at least one event.")
+	}
+	for _, e := range w.EventList() {
+		if !isWebhookEvent(e) {
+			return fmt.Errorf("Unknown event: %s", e)
+		}
+	}
+	return nil
+}
+
+// Save validates the webhook and saves it to the DB.
+func (w *Webhook) Save() error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		b := make([]byte, 20)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		w.Secret = fmt.Sprintf("%x", b)
+	}
+	return meddler.Save(db, "webhooks", w)
+}
+
+// GetWebhookById gets the webhook based on its ID.
+func (w *Webhook) GetWebhookById() error {
+	return meddler.QueryRow(db, w, stmtGetWebhookById, w.Id)
+}
+
+// GetAllWebhooks gets all the webhooks, oldest first.
+func (webhooks *Webhooks) GetAllWebhooks() error {
+	return meddler.QueryAll(db, webhooks, stmtGetAllWebhooks)
+}
+
+// EventList returns the events the webhook subscribes to.
+func (w *Webhook) EventList() []string {
+	events := make([]string, 0)
+	for _, e := range strings.Split(w.Events, webhookEventSeparator) {
+		if e != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// HasEvent returns whether the webhook subscribes to the given event.
+func (w *Webhook) HasEvent(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature of the body sent in the X-SimplePosts-Signature
+// header: the hex HMAC-SHA256 of the body keyed with the secret of the
+// webhook, prefixed with "sha256=".
+func (w *Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%x", mac.Sum(nil))
+}
+
+// DeleteWebhook deletes the webhook with the given ID and its deliveries.
+func DeleteWebhook(id int64) error {
+	if _, err := db.Exec(stmtDeleteWebhookDeliveriesByWebhookId, id); err != nil {
+		return err
+	}
+	_, err := db.Exec(stmtDeleteWebhookById, id)
+	return err
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// A webhookPayload is the JSON body sent to the webhooks.
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// FireWebhookEvent queues a delivery of the event, holding the given data,
+// for every active webhook subscribing to it. The content is saved whatever
+// happens to its webhooks, so the errors are only logged.
+func FireWebhookEvent(event string, data interface{}) {
+	webhooks := new(Webhooks)
+	if err := meddler.QueryAll(db, webhooks, stmtGetActiveWebhooks); err != nil {
+		log.Printf("[Error]: can not load the webhooks: %v", err)
+		return
+	}
+	var payload []byte
+	for _, w := range *webhooks {
+		if !w.HasEvent(event) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(webhookPayload{Event: event, CreatedAt: *utils.Now(), Data: data})
+			if err != nil {
+				log.Printf("[Error]: can not encode the %s webhook payload: %v", event, err)
+				return
+			}
+		}
+		if err := queueWebhookDelivery(w.Id, event, string(payload)); err != nil {
+			log.Printf("[Error]: can not queue the %s webhook for %s: %v", event, w.Url, err)
+		}
+	}
+}
+
+func queueWebhookDelivery(webhookId int64, event, payload string) error {
+	d := &WebhookDelivery{
+		WebhookId:     webhookId,
+		Event:         event,
+		Payload:       payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: utils.Now(),
+		CreatedAt:     utils.Now(),
+	}
+	if err := meddler.Insert(db, "webhook_deliveries", d); err != nil {
+		return err
+	}
+	_, err := EnqueueJob("webhook.deliver", webhookJob{DeliveryId: d.Id})
+	return err
+}
+
+// GetWebhookDeliveryById gets the delivery based on its ID.
+func (d *WebhookDelivery) GetWebhookDeliveryById() error {
+	return meddler.QueryRow(db, d, stmtGetWebhookDeliveryById, d.Id)
+}
+
+// GetRecentWebhookDeliveries gets the given number of deliveries, newest
+// first.
+func (deliveries *WebhookDeliveries) GetRecentWebhookDeliveries(limit int) error {
+	return meddler.QueryAll(db, deliveries, stmtGetRecentWebhookDeliveries, limit)
+}
+
+// Webhook returns the webhook of the delivery.
+func (d *WebhookDelivery) Webhook() *Webhook {
+	w := &Webhook{Id: d.WebhookId}
+	w.GetWebhookById()
+	return w
+}
+
+// Redeliver queues the payload of the delivery again, as a new delivery so
+// that the log of the first one is kept.
+func (d *WebhookDelivery) Redeliver() error {
+	w := d.Webhook()
+	if w.Url == "" {
+		return fmt.Errorf("The webhook of this delivery was deleted.")
+	}
+	return queueWebhookDelivery(d.WebhookId, d.Event, d.Payload)
+}
+
+// send makes an attempt to deliver the payload to the webhook, and records
+// its outcome. The error of a failed attempt is returned, so that its job
+// retries it with an exponential backoff; last tells whether the job has no
+// attempts left.
+func (d *WebhookDelivery) send(ctx context.Context, client *http.Client, last bool) error {
+	w := d.Webhook()
+	d.Attempts++
+	d.Error, d.ResponseBody, d.ResponseCode = "", "", 0
+	var err error
+	if w.Url == "" {
+		err = PermanentJobError(fmt.Errorf("The webhook was deleted."))
+	} else if !w.Active {
+		err = PermanentJobError(fmt.Errorf("The webhook is disabled."))
+	} else {
+		err = d.post(ctx, client, w)
+	}
+	_, permanent := err.(permanentError)
+	if err == nil {
+		d.Status = DeliverySucceeded
+		d.DeliveredAt = utils.Now()
+	} else {
+		d.Error = err.Error()
+		if last || permanent {
+			d.Status = DeliveryFailed
+		} else {
+			d.Status = DeliveryPending
+			next := utils.Now().Add(webhookBackoff << uint(d.Attempts-1))
+			d.NextAttemptAt = &next
+		}
+	}
+	if uerr := meddler.Update(db, "webhook_deliveries", d); uerr != nil {
+		log.Printf("[Error]: can not record the webhook delivery %d: %v", d.Id, uerr)
+	}
+	return err
+}
+
+func (d *WebhookDelivery) post(ctx context.Context, client *http.Client, w *Webhook) error {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest("POST", w.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SimplePosts-Webhook")
+	req.Header.Set("X-SimplePosts-Event", d.Event)
+	req.Header.Set("X-SimplePosts-Delivery", fmt.Sprint(d.Id))
+	req.Header.Set("X-SimplePosts-Signature", w.Sign(body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, webhookResponseSize))
+	d.ResponseCode = resp.StatusCode
+	d.ResponseBody = string(b)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("The endpoint answered %s.", resp.Status)
+	}
+	return nil
+}
+
+// webhookJob is the payload of the "webhook.deliver" jobs.
+type webhookJob struct {
+	DeliveryId int64 `json:"delivery_id"`
+}
+
+func init() {
+	client := &http.Client{Timeout: webhookTimeout}
+	RegisterJobType(JobType{
+		Name:        "webhook.deliver",
+		MaxAttempts: webhookMaxAttempts,
+		Backoff:     webhookBackoff,
+		Run: func(ctx context.Context, j *Job) (string, error) {
+			var p webhookJob
+			if err := j.Decode(&p); err != nil {
+				return "", PermanentJobError(err)
+			}
+			d := &WebhookDelivery{Id: p.DeliveryId}
+			if err := d.GetWebhookDeliveryById(); err != nil {
+				return "", PermanentJobError(err)
+			}
+			if err := d.send(ctx, client, j.Attempts >= j.MaxAttempts); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Delivered, the endpoint answered %d.", d.ResponseCode), nil
+		},
+	})
+	RegisterJobType(JobType{
+		Name: "webhook.prune",
+		Run: func(ctx context.Context, j *Job) (string, error) {
+			before := utils.Now().AddDate(0, 0, -webhookLogDays)
+			res, err := db.Exec(stmtDeleteOldWebhookDeliveries, before)
+			if err != nil {
+				return "", err
+			}
+			n, _ := res.RowsAffected()
+			return fmt.Sprintf("%d deliveries removed.", n), nil
+		},
+	})
+	RegisterRecurringJob("webhook.prune", "webhook.prune", 24*time.Hour)
+	SubscribeAsync(fireWebhookEvents, EventNamePostSaved, EventNamePostDeleted,
+		EventNameCommentCreated, EventNameCommentApproved, EventNameUserCreated)
+}
+
+// fireWebhookEvents turns the events of the model into the events of the
+// webhooks. A saved post is either created or updated, and also published or
+// unpublished when its status changed.
+func fireWebhookEvents(e Event) {
+	switch e := e.(type) {
+	case PostSaved:
+		data := webhookPost(e.Post)
+		if e.Created {
+			FireWebhookEvent(EventPostCreated, data)
+		} else {
+			FireWebhookEvent(EventPostUpdated, data)
+		}
+		if e.Post.IsPublished && !e.WasPublished {
+			FireWebhookEvent(EventPostPublished, data)
+		} else if !e.Post.IsPublished && e.WasPublished {
+			FireWebhookEvent(EventPostUnpublished, data)
+		}
+	case PostDeleted:
+		FireWebhookEvent(EventPostDeleted, webhookPost(e.Post))
+	case CommentCreated:
+		FireWebhookEvent(EventCommentCreated, webhookComment(e.Comment))
+	case CommentApproved:
+		FireWebhookEvent(EventCommentApproved, webhookComment(e.Comment))
+	case UserCreated:
+		FireWebhookEvent(EventUserCreated, webhookUser(e.User))
+	}
+}
+
+// webhookPost returns the data of the post events.
+func webhookPost(p *Post) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           p.Id,
+		"title":        p.Title,
+		"slug":         p.Slug,
+		"url":          SiteUrl(p.Url() + "/"),
+		"is_page":      p.IsPage,
+		"published":    p.IsPublished,
+		"published_at": p.PublishedAt,
+		"created_at":   p.CreatedAt,
+		"created_by":   p.CreatedBy,
+		"updated_at":   p.UpdatedAt,
+		"updated_by":   p.UpdatedBy,
+	}
+}
+
+// webhookComment returns the data of the comment events, without the email
+// and the IP of the author.
+func webhookComment(c *Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         c.Id,
+		"post_id":    c.PostId,
+		"parent":     c.Parent,
+		"author":     c.Author,
+		"website":    c.Website,
+		"content":    c.Content,
+		"approved":   c.Approved,
+		"created_at": c.CreatedAt,
+	}
+}
+
+// webhookUser returns the data of the user events.
+func webhookUser(u *User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         u.Id,
+		"name":       u.Name,
+		"slug":       u.Slug,
+		"url":        SiteUrl(u.Url() + "/"),
+		"created_at": u.CreatedAt,
+	}
+}
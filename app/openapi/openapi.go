@@ -0,0 +1,246 @@
+// Package openapi builds OpenAPI 3 documents describing the API of the blog,
+// so that clients can be generated from it.
+package openapi
+
+import (
+	"sort"
+	"strings"
+)
+
+// Version is the version of the OpenAPI specification the documents follow.
+const Version = "3.0.3"
+
+// A Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []*Server            `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+	Tags       []*Tag               `json:"tags,omitempty"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// A Server is a base URL of the API.
+type Server struct {
+	Url string `json:"url"`
+}
+
+// A Tag groups operations, usually by resource.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds the schemas and security schemes referred to by the
+// operations.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// A SecurityScheme is a way to authenticate requests.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// A PathItem holds the operations of a path, by lower case HTTP method.
+type PathItem map[string]*Operation
+
+// An Operation is an endpoint of the API.
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// A Parameter is a parameter of an operation, in its path or its query.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// A RequestBody is the body of the requests of an operation, by media type.
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// A Response is a response of an operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// A MediaType holds the schema of a body of the given media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// A Schema describes a JSON value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// New returns an empty document for the API of the given title and version.
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+	}
+}
+
+// AddOperation adds the operation at the given method and path, which may
+// have golf style parameters such as "/api/posts/:post_id".
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	path = PathTemplate(path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+	for _, t := range op.Tags {
+		d.addTag(t)
+	}
+}
+
+// AddSchema adds the given schema to the components and returns a reference
+// to it.
+func (d *Document) AddSchema(name string, s *Schema) *Schema {
+	d.Components.Schemas[name] = s
+	return Ref(name)
+}
+
+func (d *Document) addTag(name string) {
+	for _, t := range d.Tags {
+		if t.Name == name {
+			return
+		}
+	}
+	d.Tags = append(d.Tags, &Tag{Name: name})
+	sort.Slice(d.Tags, func(i, j int) bool { return d.Tags[i].Name < d.Tags[j].Name })
+}
+
+// PathTemplate turns the parameters of a golf route, such as ":post_id", into
+// the ones of OpenAPI, such as "{post_id}".
+func PathTemplate(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// PathParams returns the names of the parameters of a golf route.
+func PathParams(path string) []string {
+	var names []string
+	for _, p := range strings.Split(path, "/") {
+		if strings.HasPrefix(p, ":") {
+			names = append(names, p[1:])
+		}
+	}
+	return names
+}
+
+// String returns the schema of a string.
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Integer returns the schema of a 64 bit integer.
+func Integer() *Schema {
+	return &Schema{Type: "integer", Format: "int64"}
+}
+
+// Boolean returns the schema of a boolean.
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+// DateTime returns the schema of a time in RFC 3339 format.
+func DateTime() *Schema {
+	return &Schema{Type: "string", Format: "date-time"}
+}
+
+// Binary returns the schema of an uploaded file.
+func Binary() *Schema {
+	return &Schema{Type: "string", Format: "binary"}
+}
+
+// Any returns the schema of any value.
+func Any() *Schema {
+	return &Schema{}
+}
+
+// Enum returns the schema of a string which is one of the given values.
+func Enum(values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+// ArrayOf returns the schema of an array of the given items.
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// MapOf returns the schema of an object whose values all follow the given
+// schema.
+func MapOf(values *Schema) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: values}
+}
+
+// Object returns the schema of an object with the given properties.
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// Ref returns a reference to the schema of the given name in the components.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Describe sets the description of the schema and returns it.
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+// OrNull marks the schema as nullable and returns it.
+func (s *Schema) OrNull() *Schema {
+	s.Nullable = true
+	return s
+}
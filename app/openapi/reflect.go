@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaOf returns the schema of the JSON encoding of the given value, as done
+// by encoding/json. Named structs are added to the components and referred
+// to, so that recursive types can be described. Types with their own
+// MarshalJSON are described by their fields, so their schema may have to be
+// amended in the components.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+// Define adds the schema of the given struct to the components under the
+// given name, rather than the name of its type, and returns a reference to
+// it. It is meant for unexported types such as the bodies of requests.
+func (d *Document) Define(name string, v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	d.Components.Schemas[name] = d.structSchema(t)
+	return Ref(name)
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return Any()
+	}
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = DateTime()
+	case t == rawJSONType:
+		s = Any()
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		d.addStruct(t)
+		return Ref(t.Name())
+	case t.Kind() == reflect.Struct:
+		s = d.structSchema(t)
+	default:
+		s = d.kindSchema(t)
+	}
+	if nullable {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (d *Document) kindSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := Integer()
+		if t.Bits() <= 32 {
+			s.Format = "int32"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return String()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded in base64.
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(d.schemaOf(t.Elem()))
+	case reflect.Map:
+		return MapOf(d.schemaOf(t.Elem()))
+	}
+	return Any()
+}
+
+// addStruct adds the schema of the named struct to the components, unless it
+// is already there. A placeholder is added first, in case the struct refers to
+// itself.
+func (d *Document) addStruct(t reflect.Type) {
+	if _, ok := d.Components.Schemas[t.Name()]; ok {
+		return
+	}
+	d.Components.Schemas[t.Name()] = &Schema{Type: "object"}
+	*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := Object(make(map[string]*Schema))
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name, opts := f.Name, ""
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if i := strings.Index(tag, ","); i >= 0 {
+				tag, opts = tag[:i], tag[i:]
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			// The fields of embedded structs are promoted.
+			for k, v := range d.structSchema(ft).Properties {
+				if _, ok := s.Properties[k]; !ok {
+					s.Properties[k] = v
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fs := d.schemaOf(f.Type)
+		if strings.Contains(opts, ",string") && fs.Type != "" {
+			fs = String()
+		}
+		s.Properties[name] = fs
+	}
+	return s
+}
@@ -0,0 +1,262 @@
+// Package seo renders the metadata that search engines and social networks
+// read from the head of a page: the title and description, the canonical URL,
+// Open Graph and Twitter Card tags, and schema.org JSON-LD.
+package seo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/luohao-brian/SimplePosts/app/model"
+	"github.com/luohao-brian/SimplePosts/app/utils"
+)
+
+// descriptionLength is the length of the descriptions generated from the
+// content, when no description is given.
+const descriptionLength = 160
+
+// A Page is the metadata of a single page.
+type Page struct {
+	Title       string
+	Description string
+	Canonical   string
+	Image       string
+	Type        string
+	Robots      string
+	Keywords    []string
+	Published   *time.Time
+	Modified    *time.Time
+	Author      *model.User
+	JSONLD      []interface{}
+}
+
+// Tags renders the metadata of the page described by the template data. The
+// page is recognized by the data passed by the handlers: a "Post" for posts
+// and pages, a "Tag" for tag pages, an "Author" for author pages, and a
+// "Pager" for the home page. The
+// "Canonical" and "Robots" keys override the canonical URL and robots tag.
+func Tags(data map[string]interface{}) template.HTML {
+	return NewPage(data).HTML()
+}
+
+// NewPage builds the metadata of the page described by the template data,
+// falling back to the site settings for anything the page doesn't provide.
+func NewPage(data map[string]interface{}) *Page {
+	site := siteTitle()
+	page := &Page{
+		Title:       site,
+		Description: model.GetSettingValue("site_description"),
+		Image:       model.AbsoluteUrl(model.GetSettingValue("site_image")),
+		Type:        "website",
+	}
+	if title, ok := data["Title"].(string); ok && title != "" && title != "Home" {
+		page.Title = title + " - " + site
+	}
+	pager, _ := data["Pager"].(*utils.Pager)
+
+	if post, ok := data["Post"].(*model.Post); ok && post != nil {
+		page.setPost(post)
+	} else if tag, ok := data["Tag"].(*model.Tag); ok && tag != nil {
+		page.Canonical = pagedUrl(tag.Url()+"/", pager)
+		page.Description = fmt.Sprintf("%s - %s", tag.Name, page.Description)
+		page.JSONLD = append(page.JSONLD, breadcrumbs(
+			crumb{site, model.SiteUrl("/")},
+			crumb{tag.Name, model.SiteUrl(tag.Url() + "/")},
+		))
+	} else if author, ok := data["Author"].(*model.User); ok && author != nil {
+		page.Canonical = pagedUrl(author.Url()+"/", pager)
+		page.Type = "profile"
+		if author.Bio != "" {
+			page.Description = author.Bio
+		}
+		if author.Image != "" {
+			page.Image = model.AbsoluteUrl(author.Image)
+		}
+		person := map[string]interface{}{
+			"@type": "Person",
+			"name":  author.Name,
+			"url":   model.SiteUrl(author.Url() + "/"),
+		}
+		if author.Website != "" {
+			person["sameAs"] = author.Website
+		}
+		page.JSONLD = append(page.JSONLD, map[string]interface{}{
+			"@context":   "https://schema.org",
+			"@type":      "ProfilePage",
+			"mainEntity": person,
+		}, breadcrumbs(
+			crumb{site, model.SiteUrl("/")},
+			crumb{author.Name, model.SiteUrl(author.Url() + "/")},
+		))
+	} else if pager != nil {
+		page.Canonical = pagedUrl("/", pager)
+		page.JSONLD = append(page.JSONLD, map[string]interface{}{
+			"@context":    "https://schema.org",
+			"@type":       "WebSite",
+			"name":        site,
+			"url":         model.SiteUrl("/"),
+			"description": page.Description,
+		})
+	}
+	if canonical, ok := data["Canonical"].(string); ok {
+		page.Canonical = model.SiteUrl(canonical)
+	}
+	if robots, ok := data["Robots"].(string); ok {
+		page.Robots = robots
+	}
+	return page
+}
+
+func (page *Page) setPost(post *model.Post) {
+	site := siteTitle()
+	page.Title = post.Title + " - " + site
+	if post.MetaTitle != "" {
+		page.Title = post.MetaTitle
+	}
+	page.Description = post.MetaDescription
+	if page.Description == "" {
+		page.Description = strings.TrimSpace(utils.Html2Excerpt(post.Html, descriptionLength))
+	}
+	page.Canonical = model.SiteUrl(post.Url() + "/")
+	if post.Image != "" {
+		page.Image = model.AbsoluteUrl(post.Image)
+	}
+	page.Published = post.PublishedAt
+	page.Modified = post.UpdatedAt
+	page.Author = post.Author()
+	for _, t := range post.Tags() {
+		page.Keywords = append(page.Keywords, t.Name)
+	}
+	if post.IsPage {
+		page.JSONLD = append(page.JSONLD, breadcrumbs(
+			crumb{site, model.SiteUrl("/")},
+			crumb{post.Title, page.Canonical},
+		))
+		return
+	}
+
+	page.Type = "article"
+	posting := map[string]interface{}{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"headline":         post.Title,
+		"description":      page.Description,
+		"url":              page.Canonical,
+		"mainEntityOfPage": map[string]string{"@type": "WebPage", "@id": page.Canonical},
+		"author":           map[string]string{"@type": "Person", "name": page.Author.Name},
+		"publisher":        map[string]string{"@type": "Organization", "name": site},
+	}
+	if page.Image != "" {
+		posting["image"] = page.Image
+	}
+	if page.Published != nil {
+		posting["datePublished"] = page.Published.Format(time.RFC3339)
+	}
+	if page.Modified != nil {
+		posting["dateModified"] = page.Modified.Format(time.RFC3339)
+	}
+	if len(page.Keywords) > 0 {
+		posting["keywords"] = strings.Join(page.Keywords, ",")
+	}
+	page.JSONLD = append(page.JSONLD, posting)
+}
+
+// HTML renders the metadata as HTML tags.
+func (page *Page) HTML() template.HTML {
+	var b bytes.Buffer
+	tag := func(format string, args ...string) {
+		escaped := make([]interface{}, len(args))
+		for i, a := range args {
+			escaped[i] = html.EscapeString(a)
+		}
+		fmt.Fprintf(&b, format+"\n", escaped...)
+	}
+	tag(`<title>%s</title>`, page.Title)
+	tag(`<meta name="description" content="%s">`, page.Description)
+	if len(page.Keywords) > 0 {
+		tag(`<meta name="keywords" content="%s">`, strings.Join(page.Keywords, ","))
+	}
+	if page.Robots != "" {
+		tag(`<meta name="robots" content="%s">`, page.Robots)
+	}
+	if page.Canonical != "" {
+		tag(`<link rel="canonical" href="%s">`, page.Canonical)
+		tag(`<meta property="og:url" content="%s">`, page.Canonical)
+	}
+	tag(`<meta property="og:site_name" content="%s">`, siteTitle())
+	tag(`<meta property="og:type" content="%s">`, page.Type)
+	tag(`<meta property="og:title" content="%s">`, page.Title)
+	tag(`<meta property="og:description" content="%s">`, page.Description)
+	card := "summary"
+	if page.Image != "" {
+		card = "summary_large_image"
+		tag(`<meta property="og:image" content="%s">`, page.Image)
+		tag(`<meta name="twitter:image" content="%s">`, page.Image)
+	}
+	if page.Type == "article" {
+		if page.Published != nil {
+			tag(`<meta property="article:published_time" content="%s">`, page.Published.Format(time.RFC3339))
+		}
+		if page.Modified != nil {
+			tag(`<meta property="article:modified_time" content="%s">`, page.Modified.Format(time.RFC3339))
+		}
+		for _, k := range page.Keywords {
+			tag(`<meta property="article:tag" content="%s">`, k)
+		}
+	}
+	tag(`<meta name="twitter:card" content="%s">`, card)
+	if twitter := model.GetSettingValue("twitter"); twitter != "" {
+		tag(`<meta name="twitter:site" content="%s">`, "@"+strings.TrimPrefix(twitter, "@"))
+	}
+	tag(`<meta name="twitter:title" content="%s">`, page.Title)
+	tag(`<meta name="twitter:description" content="%s">`, page.Description)
+	for _, ld := range page.JSONLD {
+		// json.Marshal escapes "<" and ">", so the data can't close the
+		// script element.
+		if j, err := json.Marshal(ld); err == nil {
+			fmt.Fprintf(&b, "<script type=\"application/ld+json\">%s</script>\n", j)
+		}
+	}
+	return template.HTML(b.String())
+}
+
+type crumb struct {
+	name, url string
+}
+
+func breadcrumbs(crumbs ...crumb) map[string]interface{} {
+	items := make([]map[string]interface{}, len(crumbs))
+	for i, c := range crumbs {
+		items[i] = map[string]interface{}{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     c.name,
+			"item":     c.url,
+		}
+	}
+	return map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	}
+}
+
+// pagedUrl returns the absolute URL of the current page of a listing.
+func pagedUrl(base string, pager *utils.Pager) string {
+	if pager == nil || pager.Current <= 1 {
+		return model.SiteUrl(base)
+	}
+	return model.SiteUrl(fmt.Sprintf("%spage/%d/", base, pager.Current))
+}
+
+func siteTitle() string {
+	if title := model.GetSettingValue("site_title"); title != "" {
+		return title
+	}
+	return model.GetSettingValue("title")
+}
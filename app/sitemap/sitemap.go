@@ -0,0 +1,128 @@
+// Package sitemap renders sitemaps following the sitemaps.org protocol,
+// including the Google image extension. URLs are split into as many sitemaps
+// as the protocol limits require, which are then listed in a sitemap index.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// The limits of a single sitemap, set by the protocol.
+const (
+	MaxURLs = 50000
+	MaxSize = 50 * 1024 * 1024
+)
+
+const (
+	header = xml.Header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">` + "\n"
+	footer = `</urlset>` + "\n"
+)
+
+// A URL is a page of the site. Loc and the image locations must be absolute.
+type URL struct {
+	Loc        string
+	LastMod    *time.Time
+	ChangeFreq string
+	Priority   float64
+	Images     []string
+}
+
+// A Sitemap is a single sitemap file, holding at most MaxURLs URLs and
+// MaxSize bytes.
+type Sitemap struct {
+	Name    string
+	LastMod *time.Time
+	urls    [][]byte
+}
+
+type urlElement struct {
+	XMLName    xml.Name       `xml:"url"`
+	Loc        string         `xml:"loc"`
+	LastMod    string         `xml:"lastmod,omitempty"`
+	ChangeFreq string         `xml:"changefreq,omitempty"`
+	Priority   string         `xml:"priority,omitempty"`
+	Images     []imageElement `xml:"image:image"`
+}
+
+type imageElement struct {
+	Loc string `xml:"image:loc"`
+}
+
+// Split renders the URLs into as many sitemaps as needed to stay within the
+// protocol limits. The sitemaps are named after the given name, followed by
+// their number, such as "posts-1".
+func Split(name string, urls []*URL) ([]*Sitemap, error) {
+	sitemaps := make([]*Sitemap, 0)
+	var current *Sitemap
+	size := 0
+	for _, u := range urls {
+		e := &urlElement{Loc: u.Loc, ChangeFreq: u.ChangeFreq}
+		if u.LastMod != nil {
+			e.LastMod = u.LastMod.Format(time.RFC3339)
+		}
+		if u.Priority > 0 {
+			e.Priority = fmt.Sprintf("%.1f", u.Priority)
+		}
+		for _, img := range u.Images {
+			e.Images = append(e.Images, imageElement{Loc: img})
+		}
+		b, err := xml.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, '\n')
+		if current == nil || len(current.urls) >= MaxURLs || size+len(b) > MaxSize-len(header)-len(footer) {
+			current = &Sitemap{Name: fmt.Sprintf("%s-%d", name, len(sitemaps)+1)}
+			sitemaps = append(sitemaps, current)
+			size = 0
+		}
+		current.urls = append(current.urls, b)
+		size += len(b)
+		if u.LastMod != nil && (current.LastMod == nil || u.LastMod.After(*current.LastMod)) {
+			current.LastMod = u.LastMod
+		}
+	}
+	return sitemaps, nil
+}
+
+// XML renders the sitemap.
+func (s *Sitemap) XML() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, u := range s.urls {
+		buf.Write(u)
+	}
+	buf.WriteString(footer)
+	return buf.Bytes()
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name          `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []*sitemapElement `xml:"sitemap"`
+}
+
+type sitemapElement struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Index renders the sitemap index listing the given sitemaps. The location of
+// each sitemap is given by the loc function.
+func Index(sitemaps []*Sitemap, loc func(*Sitemap) string) ([]byte, error) {
+	index := new(sitemapIndex)
+	for _, s := range sitemaps {
+		e := &sitemapElement{Loc: loc(s)}
+		if s.LastMod != nil {
+			e.LastMod = s.LastMod.Format(time.RFC3339)
+		}
+		index.Sitemaps = append(index.Sitemaps, e)
+	}
+	b, err := xml.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
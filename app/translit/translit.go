@@ -0,0 +1,89 @@
+// Package translit transliterates text into Latin letters, so that titles
+// written in other scripts make readable slugs. Transliterators are
+// registered by name, and the one used for slugs is chosen by the
+// "slug_transliteration" setting.
+package translit
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A Transliterator rewrites text into Latin letters. Anything it can't
+// transliterate is left as is.
+type Transliterator func(string) string
+
+var transliterators = make(map[string]Transliterator)
+
+func init() {
+	Register("none", func(s string) string { return s })
+	Register("latin", Latin)
+	Register("pinyin", Pinyin)
+}
+
+// Register makes a transliterator available under the given name.
+func Register(name string, t Transliterator) {
+	transliterators[name] = t
+}
+
+// Get returns the transliterator registered under the given name, or nil.
+func Get(name string) Transliterator {
+	return transliterators[name]
+}
+
+// Names returns the names of all registered transliterators, sorted.
+func Names() []string {
+	names := make([]string, 0, len(transliterators))
+	for name := range transliterators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latinLetters are the letters which don't decompose into a base letter and
+// accents.
+var latinLetters = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D",
+	'ł': "l", 'Ł': "L", 'ħ': "h", 'Ħ': "H", 'ı': "i", 'þ': "th", 'Þ': "TH",
+}
+
+// Latin strips the accents from Latin letters, such as "é" to "e", and spells
+// out the letters without an unaccented form, such as "ß" to "ss".
+func Latin(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if l, ok := latinLetters[r]; ok {
+			b.WriteString(l)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// Pinyin spells out Han characters in Pinyin without tones, one word per
+// character, such as "欢迎" to "huan ying". The rest of the text is
+// transliterated by Latin.
+func Pinyin(s string) string {
+	var b strings.Builder
+	args := pinyin.NewArgs()
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			if py := pinyin.SinglePinyin(r, args); len(py) > 0 {
+				b.WriteString(" " + py[0] + " ")
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return Latin(b.String())
+}
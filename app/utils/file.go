@@ -1,13 +1,17 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 )
 
+var oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
 // FileSize returns the file size as a string, formatted in the way people
 // usually see filenames, ex: "1MB", "3KB", "60B".
 func FileSize(size int64) string {
@@ -21,6 +25,17 @@ func FileSize(size int64) string {
 	return fmt.Sprintf("%f B", s)
 }
 
+// SniffContentType returns the content type of the given data, which should be
+// the first 512 bytes of a file. It recognizes everything that
+// http.DetectContentType does, plus legacy Office documents, which are
+// reported as "application/x-ole-storage".
+func SniffContentType(head []byte) string {
+	if bytes.HasPrefix(head, oleMagic) {
+		return "application/x-ole-storage"
+	}
+	return http.DetectContentType(head)
+}
+
 // IsFile returns whether or not a given path name has a corresponding file
 // name.
 func IsFile(path string) bool {
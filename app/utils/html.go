@@ -1,10 +1,11 @@
 package utils
 
 import (
-	"github.com/russross/blackfriday"
 	"html/template"
 	"regexp"
 	"strings"
+
+	"github.com/luohao-brian/SimplePosts/app/markdown"
 )
 
 // Html2Str converts the given HTML to a string, removing all HTML tags,
@@ -58,10 +59,10 @@ func Html2Excerpt(html string, length int) string {
 	return SubString(Html2Str(html), 0, length)
 }
 
-// Markdown2Html returns the given text as Markdown, using BlackFriday as a
-// markdown compiler.
+// Markdown2Html returns the given Markdown text as sanitized HTML, using the
+// configured markdown pipeline.
 func Markdown2Html(text string) string {
-	return string(blackfriday.MarkdownCommon([]byte(text)))
+	return markdown.Render(text)
 }
 
 // Markdown2HtmlTemplate returns the given text as Markdown, as the template
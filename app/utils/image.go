@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ResizeImage scales the given image down so that it fits inside a box of
+// maxWidth by maxHeight pixels, keeping its aspect ratio. Images that already
+// fit are returned unchanged.
+func ResizeImage(src image.Image, maxWidth, maxHeight int) image.Image {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return src
+	}
+	ratio := float64(maxWidth) / float64(width)
+	if r := float64(maxHeight) / float64(height); r < ratio {
+		ratio = r
+	}
+	w := int(float64(width)*ratio + 0.5)
+	h := int(float64(height)*ratio + 0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// EncodeImage writes the image to w in the given format, which is one of the
+// names returned by image.Decode: "jpeg", "png" or "gif".
+func EncodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+}
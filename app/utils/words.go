@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"math"
+	"unicode"
+)
+
+// Reading speeds used to estimate the reading time of a text. Chinese and
+// Japanese are read by the character rather than by the word.
+const (
+	WordsPerMinute    = 265
+	CJKCharsPerMinute = 500
+)
+
+// CountWords returns the number of words of the given text, and separately,
+// the number of Chinese and Japanese characters, which are written without
+// spaces between words. Korean is written with spaces, so it counts as words.
+func CountWords(text string) (words int, cjk int) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			cjk++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		case r == '\'' || r == '’' || r == '-':
+			// Part of words such as "don't" or "well-known".
+		default:
+			inWord = false
+		}
+	}
+	return words, cjk
+}
+
+// ReadingTime returns the minutes needed to read the given text, rounded up.
+// It is at least a minute unless the text is empty.
+func ReadingTime(text string) int {
+	words, cjk := CountWords(text)
+	minutes := float64(words)/WordsPerMinute + float64(cjk)/CJKCharsPerMinute
+	return int(math.Ceil(minutes))
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
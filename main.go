@@ -10,8 +10,22 @@ func main() {
 	portPtr := flag.String("port", "8000", "The port number for Dingo to listen to.")
 	privKeyPathPtr := flag.String("priv-key", "SimplePosts.rsa", "The private key file path for JWT.")
 	pubKeyPathPtr := flag.String("pub-key", "SimplePosts.rsa.pub", "The public key file path for JWT.")
+	fullPtr := flag.Bool("full", false, "Render every page with the build command, not only the changed ones.")
 	flag.Parse()
 	//Dingo.Init()
 	Dingo.Init(*privKeyPathPtr, *pubKeyPathPtr)
-	Dingo.Run(*portPtr)
+	switch flag.Arg(0) {
+	case "backup":
+		Dingo.Backup(flag.Arg(1))
+	case "restore":
+		Dingo.Restore(flag.Arg(1))
+	case "export":
+		Dingo.Export(flag.Arg(1))
+	case "rerender":
+		Dingo.Rerender()
+	case "build":
+		Dingo.Build(flag.Arg(1), *fullPtr)
+	default:
+		Dingo.Run(*portPtr)
+	}
 }